@@ -0,0 +1,43 @@
+// Command rebuild-decisions replays the decision event log to rebuild the decisions table, reporting any differences
+// with the stored decisions. With -repair the stored decisions are replaced by the rebuilt ones where they differ.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+	"os"
+
+	_ "github.com/lib/pq"
+	"github.com/neiln3121/explore-service/internal/storage"
+)
+
+var (
+	repair = flag.Bool("repair", false, "replace stored decisions which differ from the rebuilt decisions")
+)
+
+func main() {
+	flag.Parse()
+
+	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	repo := storage.New(db)
+	defer repo.Close()
+
+	report, err := repo.RebuildDecisions(context.Background(), *repair)
+	if err != nil {
+		log.Fatalf("failed to rebuild decisions: %v", err)
+	}
+
+	log.Printf("missing decisions: %d, extra decisions: %d, mismatched decisions: %d", report.Missing, report.Extra, report.Mismatched)
+	if report.Repaired {
+		log.Printf("decisions repaired")
+	} else if !report.Consistent() {
+		// Exit with an error so verification can be scripted
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,7 @@
+-- +migrate Up
+
+CREATE INDEX IF NOT EXISTS decisions_matches_idx ON decisions (recipient_id, id DESC) WHERE liked AND mutually_liked;
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS decisions_matches_idx;
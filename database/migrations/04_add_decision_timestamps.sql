@@ -0,0 +1,23 @@
+-- +migrate Up
+
+ALTER TABLE decisions
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITHOUT TIME ZONE,
+    ADD COLUMN IF NOT EXISTS decided_at TIMESTAMP WITHOUT TIME ZONE,
+    ADD COLUMN IF NOT EXISTS matched_at TIMESTAMP WITHOUT TIME ZONE;
+
+-- Existing decisions only have the time they were last updated
+UPDATE decisions SET created_at = updated_at, decided_at = updated_at;
+UPDATE decisions SET matched_at = updated_at WHERE liked AND mutually_liked;
+
+ALTER TABLE decisions
+    ALTER COLUMN created_at SET DEFAULT now(),
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN decided_at SET DEFAULT now(),
+    ALTER COLUMN decided_at SET NOT NULL;
+
+-- +migrate Down
+
+ALTER TABLE decisions
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS decided_at,
+    DROP COLUMN IF EXISTS matched_at;
@@ -0,0 +1,14 @@
+-- +migrate Up
+
+-- The decision replaced by the latest decision, so the latest decision can be undone
+ALTER TABLE decisions
+    ADD COLUMN IF NOT EXISTS previous_liked BOOLEAN,
+    ADD COLUMN IF NOT EXISTS previous_decided_at TIMESTAMP WITHOUT TIME ZONE,
+    ADD COLUMN IF NOT EXISTS undoable BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +migrate Down
+
+ALTER TABLE decisions
+    DROP COLUMN IF EXISTS previous_liked,
+    DROP COLUMN IF EXISTS previous_decided_at,
+    DROP COLUMN IF EXISTS undoable;
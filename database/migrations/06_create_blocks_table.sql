@@ -0,0 +1,12 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS blocks (
+    blocker_id TEXT NOT NULL,
+    blocked_id TEXT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS blocks;
@@ -0,0 +1,26 @@
+-- +migrate Up
+
+-- Append only log of every change to a decision, holding the decision as it was after the change
+CREATE TABLE IF NOT EXISTS decision_events (
+    id BIGSERIAL PRIMARY KEY,
+    recipient_id TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    liked BOOLEAN,
+    decided_at TIMESTAMP WITHOUT TIME ZONE,
+    matched_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS decision_events_actor_idx ON decision_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS decision_events_pair_idx ON decision_events (recipient_id, actor_id, id);
+
+-- Existing decisions are imported so the decisions can be rebuilt from the log
+INSERT INTO decision_events (recipient_id, actor_id, event_type, liked, decided_at, matched_at, created_at)
+SELECT recipient_id, actor_id, 'imported', liked, decided_at, matched_at, created_at
+FROM decisions
+ORDER BY id;
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS decision_events;
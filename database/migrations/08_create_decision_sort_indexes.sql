@@ -0,0 +1,10 @@
+-- +migrate Up
+
+-- Key set pagination of likers sorted by time, the matched at expression must match the one the storage orders by
+CREATE INDEX IF NOT EXISTS decisions_recipient_updated_at_idx ON decisions (recipient_id, liked, updated_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS decisions_recipient_matched_at_idx ON decisions (recipient_id, liked, (COALESCE(matched_at, '-infinity'::timestamp)) DESC, id DESC);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS decisions_recipient_updated_at_idx;
+DROP INDEX IF EXISTS decisions_recipient_matched_at_idx;
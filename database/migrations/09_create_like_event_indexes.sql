@@ -0,0 +1,10 @@
+-- +migrate Up
+
+-- Likes and matches of a user are streamed from the event log in order, the conditions must match the ones the storage filters by
+CREATE INDEX IF NOT EXISTS decision_events_recipient_likes_idx ON decision_events (recipient_id, id) WHERE event_type = 'decided' AND liked;
+CREATE INDEX IF NOT EXISTS decision_events_actor_matches_idx ON decision_events (actor_id, id) WHERE event_type = 'decided' AND liked AND matched_at IS NOT NULL;
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS decision_events_recipient_likes_idx;
+DROP INDEX IF EXISTS decision_events_actor_matches_idx;
@@ -0,0 +1,14 @@
+-- +migrate Up
+
+-- Events for other services, written in the same transaction as the change they describe and removed once published
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    recipient_id TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS outbox;
@@ -0,0 +1,19 @@
+-- +migrate Up
+
+-- Webhook deliveries of outbox events which failed every attempt, kept until they are replayed
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    subscription TEXT NOT NULL,
+    event_id BIGINT NOT NULL,
+    event_type TEXT NOT NULL,
+    recipient_id TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    event_created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    attempts INT NOT NULL,
+    last_error TEXT NOT NULL,
+    failed_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS webhook_dead_letters;
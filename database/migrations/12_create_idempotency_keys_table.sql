@@ -0,0 +1,16 @@
+-- +migrate Up
+
+-- The results of decisions recorded with an idempotency key, so retries get the same result without recording it again
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    actor_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    recipient_id TEXT NOT NULL,
+    liked BOOLEAN NOT NULL,
+    result JSONB NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    PRIMARY KEY (actor_id, key)
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS idempotency_keys;
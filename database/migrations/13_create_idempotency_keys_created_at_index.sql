@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- Expired idempotency keys are purged by their age
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idempotency_keys_created_at_idx;
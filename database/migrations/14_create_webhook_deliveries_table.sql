@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- Outbox events waiting to be delivered to webhook subscriptions, removed once delivered or dead lettered. An event is
+-- only queued once for each subscription, so publishing it again while it waits doesn't deliver it twice.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription TEXT NOT NULL,
+    event_id BIGINT NOT NULL,
+    event_type TEXT NOT NULL,
+    recipient_id TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    event_created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    UNIQUE (subscription, event_id)
+);
+
+-- The deliveries of a subscription are made in the order they were queued
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON webhook_deliveries (subscription, id);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS webhook_deliveries;
@@ -19,10 +19,19 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	ExploreAPI_ListLikedYou_FullMethodName    = "/explore.ExploreAPI/ListLikedYou"
-	ExploreAPI_ListNewLikedYou_FullMethodName = "/explore.ExploreAPI/ListNewLikedYou"
-	ExploreAPI_CountLikedYou_FullMethodName   = "/explore.ExploreAPI/CountLikedYou"
-	ExploreAPI_PutDecision_FullMethodName     = "/explore.ExploreAPI/PutDecision"
+	ExploreAPI_ListLikedYou_FullMethodName            = "/explore.ExploreAPI/ListLikedYou"
+	ExploreAPI_ListNewLikedYou_FullMethodName         = "/explore.ExploreAPI/ListNewLikedYou"
+	ExploreAPI_CountLikedYou_FullMethodName           = "/explore.ExploreAPI/CountLikedYou"
+	ExploreAPI_PutDecision_FullMethodName             = "/explore.ExploreAPI/PutDecision"
+	ExploreAPI_BatchPutDecisions_FullMethodName       = "/explore.ExploreAPI/BatchPutDecisions"
+	ExploreAPI_ListMatches_FullMethodName             = "/explore.ExploreAPI/ListMatches"
+	ExploreAPI_UndoDecision_FullMethodName            = "/explore.ExploreAPI/UndoDecision"
+	ExploreAPI_Unmatch_FullMethodName                 = "/explore.ExploreAPI/Unmatch"
+	ExploreAPI_BlockUser_FullMethodName               = "/explore.ExploreAPI/BlockUser"
+	ExploreAPI_UnblockUser_FullMethodName             = "/explore.ExploreAPI/UnblockUser"
+	ExploreAPI_GetDecisionHistory_FullMethodName      = "/explore.ExploreAPI/GetDecisionHistory"
+	ExploreAPI_WatchLikes_FullMethodName              = "/explore.ExploreAPI/WatchLikes"
+	ExploreAPI_ReplayWebhookDeliveries_FullMethodName = "/explore.ExploreAPI/ReplayWebhookDeliveries"
 )
 
 // ExploreAPIClient is the client API for ExploreAPI service.
@@ -33,6 +42,15 @@ type ExploreAPIClient interface {
 	ListNewLikedYou(ctx context.Context, in *ListLikedYouRequest, opts ...grpc.CallOption) (*ListLikedYouResponse, error)
 	CountLikedYou(ctx context.Context, in *CountLikedYouRequest, opts ...grpc.CallOption) (*CountLikedYouResponse, error)
 	PutDecision(ctx context.Context, in *PutDecisionRequest, opts ...grpc.CallOption) (*PutDecisionResponse, error)
+	BatchPutDecisions(ctx context.Context, in *BatchPutDecisionsRequest, opts ...grpc.CallOption) (*BatchPutDecisionsResponse, error)
+	ListMatches(ctx context.Context, in *ListMatchesRequest, opts ...grpc.CallOption) (*ListMatchesResponse, error)
+	UndoDecision(ctx context.Context, in *UndoDecisionRequest, opts ...grpc.CallOption) (*UndoDecisionResponse, error)
+	Unmatch(ctx context.Context, in *UnmatchRequest, opts ...grpc.CallOption) (*UnmatchResponse, error)
+	BlockUser(ctx context.Context, in *BlockUserRequest, opts ...grpc.CallOption) (*BlockUserResponse, error)
+	UnblockUser(ctx context.Context, in *UnblockUserRequest, opts ...grpc.CallOption) (*UnblockUserResponse, error)
+	GetDecisionHistory(ctx context.Context, in *GetDecisionHistoryRequest, opts ...grpc.CallOption) (*GetDecisionHistoryResponse, error)
+	WatchLikes(ctx context.Context, in *WatchLikesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchLikesResponse], error)
+	ReplayWebhookDeliveries(ctx context.Context, in *ReplayWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ReplayWebhookDeliveriesResponse, error)
 }
 
 type exploreAPIClient struct {
@@ -83,6 +101,105 @@ func (c *exploreAPIClient) PutDecision(ctx context.Context, in *PutDecisionReque
 	return out, nil
 }
 
+func (c *exploreAPIClient) BatchPutDecisions(ctx context.Context, in *BatchPutDecisionsRequest, opts ...grpc.CallOption) (*BatchPutDecisionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchPutDecisionsResponse)
+	err := c.cc.Invoke(ctx, ExploreAPI_BatchPutDecisions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *exploreAPIClient) ListMatches(ctx context.Context, in *ListMatchesRequest, opts ...grpc.CallOption) (*ListMatchesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMatchesResponse)
+	err := c.cc.Invoke(ctx, ExploreAPI_ListMatches_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *exploreAPIClient) UndoDecision(ctx context.Context, in *UndoDecisionRequest, opts ...grpc.CallOption) (*UndoDecisionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UndoDecisionResponse)
+	err := c.cc.Invoke(ctx, ExploreAPI_UndoDecision_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *exploreAPIClient) Unmatch(ctx context.Context, in *UnmatchRequest, opts ...grpc.CallOption) (*UnmatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UnmatchResponse)
+	err := c.cc.Invoke(ctx, ExploreAPI_Unmatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *exploreAPIClient) BlockUser(ctx context.Context, in *BlockUserRequest, opts ...grpc.CallOption) (*BlockUserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BlockUserResponse)
+	err := c.cc.Invoke(ctx, ExploreAPI_BlockUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *exploreAPIClient) UnblockUser(ctx context.Context, in *UnblockUserRequest, opts ...grpc.CallOption) (*UnblockUserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UnblockUserResponse)
+	err := c.cc.Invoke(ctx, ExploreAPI_UnblockUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *exploreAPIClient) GetDecisionHistory(ctx context.Context, in *GetDecisionHistoryRequest, opts ...grpc.CallOption) (*GetDecisionHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetDecisionHistoryResponse)
+	err := c.cc.Invoke(ctx, ExploreAPI_GetDecisionHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *exploreAPIClient) WatchLikes(ctx context.Context, in *WatchLikesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchLikesResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ExploreAPI_ServiceDesc.Streams[0], ExploreAPI_WatchLikes_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchLikesRequest, WatchLikesResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ExploreAPI_WatchLikesClient = grpc.ServerStreamingClient[WatchLikesResponse]
+
+func (c *exploreAPIClient) ReplayWebhookDeliveries(ctx context.Context, in *ReplayWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ReplayWebhookDeliveriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReplayWebhookDeliveriesResponse)
+	err := c.cc.Invoke(ctx, ExploreAPI_ReplayWebhookDeliveries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ExploreAPIServer is the server API for ExploreAPI service.
 // All implementations must embed UnimplementedExploreAPIServer
 // for forward compatibility.
@@ -91,6 +208,15 @@ type ExploreAPIServer interface {
 	ListNewLikedYou(context.Context, *ListLikedYouRequest) (*ListLikedYouResponse, error)
 	CountLikedYou(context.Context, *CountLikedYouRequest) (*CountLikedYouResponse, error)
 	PutDecision(context.Context, *PutDecisionRequest) (*PutDecisionResponse, error)
+	BatchPutDecisions(context.Context, *BatchPutDecisionsRequest) (*BatchPutDecisionsResponse, error)
+	ListMatches(context.Context, *ListMatchesRequest) (*ListMatchesResponse, error)
+	UndoDecision(context.Context, *UndoDecisionRequest) (*UndoDecisionResponse, error)
+	Unmatch(context.Context, *UnmatchRequest) (*UnmatchResponse, error)
+	BlockUser(context.Context, *BlockUserRequest) (*BlockUserResponse, error)
+	UnblockUser(context.Context, *UnblockUserRequest) (*UnblockUserResponse, error)
+	GetDecisionHistory(context.Context, *GetDecisionHistoryRequest) (*GetDecisionHistoryResponse, error)
+	WatchLikes(*WatchLikesRequest, grpc.ServerStreamingServer[WatchLikesResponse]) error
+	ReplayWebhookDeliveries(context.Context, *ReplayWebhookDeliveriesRequest) (*ReplayWebhookDeliveriesResponse, error)
 	mustEmbedUnimplementedExploreAPIServer()
 }
 
@@ -113,6 +239,33 @@ func (UnimplementedExploreAPIServer) CountLikedYou(context.Context, *CountLikedY
 func (UnimplementedExploreAPIServer) PutDecision(context.Context, *PutDecisionRequest) (*PutDecisionResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PutDecision not implemented")
 }
+func (UnimplementedExploreAPIServer) BatchPutDecisions(context.Context, *BatchPutDecisionsRequest) (*BatchPutDecisionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchPutDecisions not implemented")
+}
+func (UnimplementedExploreAPIServer) ListMatches(context.Context, *ListMatchesRequest) (*ListMatchesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMatches not implemented")
+}
+func (UnimplementedExploreAPIServer) UndoDecision(context.Context, *UndoDecisionRequest) (*UndoDecisionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UndoDecision not implemented")
+}
+func (UnimplementedExploreAPIServer) Unmatch(context.Context, *UnmatchRequest) (*UnmatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unmatch not implemented")
+}
+func (UnimplementedExploreAPIServer) BlockUser(context.Context, *BlockUserRequest) (*BlockUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BlockUser not implemented")
+}
+func (UnimplementedExploreAPIServer) UnblockUser(context.Context, *UnblockUserRequest) (*UnblockUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnblockUser not implemented")
+}
+func (UnimplementedExploreAPIServer) GetDecisionHistory(context.Context, *GetDecisionHistoryRequest) (*GetDecisionHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDecisionHistory not implemented")
+}
+func (UnimplementedExploreAPIServer) WatchLikes(*WatchLikesRequest, grpc.ServerStreamingServer[WatchLikesResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchLikes not implemented")
+}
+func (UnimplementedExploreAPIServer) ReplayWebhookDeliveries(context.Context, *ReplayWebhookDeliveriesRequest) (*ReplayWebhookDeliveriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplayWebhookDeliveries not implemented")
+}
 func (UnimplementedExploreAPIServer) mustEmbedUnimplementedExploreAPIServer() {}
 func (UnimplementedExploreAPIServer) testEmbeddedByValue()                    {}
 
@@ -206,6 +359,161 @@ func _ExploreAPI_PutDecision_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ExploreAPI_BatchPutDecisions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchPutDecisionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExploreAPIServer).BatchPutDecisions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExploreAPI_BatchPutDecisions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExploreAPIServer).BatchPutDecisions(ctx, req.(*BatchPutDecisionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExploreAPI_ListMatches_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMatchesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExploreAPIServer).ListMatches(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExploreAPI_ListMatches_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExploreAPIServer).ListMatches(ctx, req.(*ListMatchesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExploreAPI_UndoDecision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UndoDecisionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExploreAPIServer).UndoDecision(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExploreAPI_UndoDecision_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExploreAPIServer).UndoDecision(ctx, req.(*UndoDecisionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExploreAPI_Unmatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnmatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExploreAPIServer).Unmatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExploreAPI_Unmatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExploreAPIServer).Unmatch(ctx, req.(*UnmatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExploreAPI_BlockUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlockUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExploreAPIServer).BlockUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExploreAPI_BlockUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExploreAPIServer).BlockUser(ctx, req.(*BlockUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExploreAPI_UnblockUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnblockUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExploreAPIServer).UnblockUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExploreAPI_UnblockUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExploreAPIServer).UnblockUser(ctx, req.(*UnblockUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExploreAPI_GetDecisionHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDecisionHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExploreAPIServer).GetDecisionHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExploreAPI_GetDecisionHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExploreAPIServer).GetDecisionHistory(ctx, req.(*GetDecisionHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExploreAPI_WatchLikes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchLikesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ExploreAPIServer).WatchLikes(m, &grpc.GenericServerStream[WatchLikesRequest, WatchLikesResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ExploreAPI_WatchLikesServer = grpc.ServerStreamingServer[WatchLikesResponse]
+
+func _ExploreAPI_ReplayWebhookDeliveries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplayWebhookDeliveriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExploreAPIServer).ReplayWebhookDeliveries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExploreAPI_ReplayWebhookDeliveries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExploreAPIServer).ReplayWebhookDeliveries(ctx, req.(*ReplayWebhookDeliveriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ExploreAPI_ServiceDesc is the grpc.ServiceDesc for ExploreAPI service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -229,7 +537,45 @@ var ExploreAPI_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PutDecision",
 			Handler:    _ExploreAPI_PutDecision_Handler,
 		},
+		{
+			MethodName: "BatchPutDecisions",
+			Handler:    _ExploreAPI_BatchPutDecisions_Handler,
+		},
+		{
+			MethodName: "ListMatches",
+			Handler:    _ExploreAPI_ListMatches_Handler,
+		},
+		{
+			MethodName: "UndoDecision",
+			Handler:    _ExploreAPI_UndoDecision_Handler,
+		},
+		{
+			MethodName: "Unmatch",
+			Handler:    _ExploreAPI_Unmatch_Handler,
+		},
+		{
+			MethodName: "BlockUser",
+			Handler:    _ExploreAPI_BlockUser_Handler,
+		},
+		{
+			MethodName: "UnblockUser",
+			Handler:    _ExploreAPI_UnblockUser_Handler,
+		},
+		{
+			MethodName: "GetDecisionHistory",
+			Handler:    _ExploreAPI_GetDecisionHistory_Handler,
+		},
+		{
+			MethodName: "ReplayWebhookDeliveries",
+			Handler:    _ExploreAPI_ReplayWebhookDeliveries_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchLikes",
+			Handler:       _ExploreAPI_WatchLikes_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "explore/explore-service.proto",
 }
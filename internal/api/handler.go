@@ -4,66 +4,212 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
-	"strconv"
+	"log/slog"
+	"sync"
+	"time"
 
 	contract "github.com/neiln3121/explore-service/explore"
+	"github.com/neiln3121/explore-service/internal/auth"
+	"github.com/neiln3121/explore-service/internal/pagination"
 	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/webhook"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.50.4 --with-expecter --exported --name=Store
 type Store interface {
-	PutDecision(ctx context.Context, recipient_id, actor_id string, liked bool) error
-	PutMutualDecisions(ctx context.Context, recipient_id, actor_id string, liked, mutuallyLiked bool) error
+	RecordDecision(ctx context.Context, recipientID, actorID string, liked bool) (*storage.DecisionResult, error)
+	RecordIdempotentDecision(ctx context.Context, key string, ttl time.Duration, recipientID, actorID string, liked bool) (*storage.DecisionResult, error)
 
-	GetLikedDecisions(ctx context.Context, recipientID string, liked bool, token *uint64, limit *uint32) ([]*storage.Liker, error)
-	GetNewLikedDecisions(ctx context.Context, recipientID string, liked bool, token *uint64, limit *uint32) ([]*storage.Liker, error)
+	GetLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error)
+	GetNewLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error)
 	GetLikedDecisionsCount(ctx context.Context, recipientID string, liked bool) (int, error)
-	GetLikedDecision(ctx context.Context, recipientID, actorID string) (bool, error)
+	GetMatches(ctx context.Context, userID string, token *uint64, limit *uint32) ([]*storage.Match, error)
+	UndoDecision(ctx context.Context, recipientID, actorID string, window time.Duration) (*storage.UndoResult, error)
+	Unmatch(ctx context.Context, userID, matchedUserID string) error
+	BlockUser(ctx context.Context, blockerID, blockedID string) error
+	UnblockUser(ctx context.Context, blockerID, blockedID string) error
+	GetDecisionHistory(ctx context.Context, actorID string, recipientID *string, token *uint64, limit *uint32) ([]*storage.DecisionEvent, error)
+	GetLikeEvents(ctx context.Context, userID string, after uint64, limit uint32) ([]*storage.LikeEvent, error)
+	GetLastLikeEventID(ctx context.Context, userID string) (uint64, error)
+}
+
+// Watcher wakes watchers of a user's likes when there may be new like events for them
+type Watcher interface {
+	Subscribe(userID string) (<-chan struct{}, func())
+}
+
+// Replayer replays webhook deliveries which failed every attempt
+type Replayer interface {
+	Replay(ctx context.Context, subscription *string, limit uint32) (delivered, failed int, err error)
+}
+
+// DefaultUndoWindow is how long after a decision it can be undone, unless set with WithUndoWindow
+const DefaultUndoWindow = 5 * time.Minute
+
+// DefaultIdempotencyTTL is how long the result of a decision is kept for retries with its idempotency key, unless set
+// with WithIdempotencyTTL
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKeyLength is the longest idempotency key accepted
+const maxIdempotencyKeyLength = 255
+
+// maxBatchDecisions is the most decisions which can be recorded by one BatchPutDecisions call
+const maxBatchDecisions = 100
+
+const (
+	// watchPollInterval is how often likes are read for a watcher which hasn't been woken, in case a notification was
+	// missed or there is no Watcher
+	watchPollInterval = 10 * time.Second
+	// watchBatchSize is the number of like events read at a time for a watcher
+	watchBatchSize = 100
+)
+
+// Features are parts of the API which can be turned off. Calls to a feature which is off fail as unimplemented.
+type Features struct {
+	Undo            bool
+	DecisionHistory bool
 }
 
 // ExporeAPI is the implementation of the GRPC server
 type ExploreAPI struct {
-	repository Store
+	repository   Store
+	undoWindow   time.Duration
+	tokens       *pagination.Codec
+	logger       *slog.Logger
+	defaultLimit uint32
+	maxLimit     uint32
+	features     Features
+	// authorization requires the caller to be the user of the request, unless it is a service or admin
+	authorization bool
+	watcher       Watcher
+	replayer      Replayer
+	// watchesClosed is closed to end every watch
+	watchesClosed chan struct{}
+	closeWatches  sync.Once
+	// idempotencyTTL is how long decisions are kept for retries with their idempotency key
+	idempotencyTTL time.Duration
 	contract.UnimplementedExploreAPIServer
 }
 
-func New(repository Store) *ExploreAPI {
-	return &ExploreAPI{
-		repository: repository,
+// Option configures optional behaviour of the ExploreAPI
+type Option func(*ExploreAPI)
+
+// WithUndoWindow sets how long after a decision it can be undone
+func WithUndoWindow(window time.Duration) Option {
+	return func(e *ExploreAPI) {
+		e.undoWindow = window
+	}
+}
+
+// WithIdempotencyTTL sets how long the result of a decision is kept for retries with its idempotency key
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(e *ExploreAPI) {
+		e.idempotencyTTL = ttl
+	}
+}
+
+// WithPaginationKey sets the key pagination tokens are encrypted with. Without it, a random key is used, so tokens can't
+// be used across restarts or with other instances of the server.
+func WithPaginationKey(key []byte) Option {
+	return func(e *ExploreAPI) {
+		e.tokens = pagination.NewCodec(key)
+	}
+}
+
+// WithLogger sets the logger errors are logged to, instead of the default logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(e *ExploreAPI) {
+		e.logger = logger
+	}
+}
+
+// WithPaginationLimits sets the page size of lists requested without a limit, and the largest page size which can be
+// requested. A limit of 0 is no limit.
+func WithPaginationLimits(defaultLimit, maxLimit uint32) Option {
+	return func(e *ExploreAPI) {
+		e.defaultLimit = defaultLimit
+		e.maxLimit = maxLimit
+	}
+}
+
+// WithFeatures sets which features are served, instead of all of them
+func WithFeatures(features Features) Option {
+	return func(e *ExploreAPI) {
+		e.features = features
+	}
+}
+
+// WithAuthorization only allows callers to make requests for themselves, unless they are a service or admin. Callers
+// must be authenticated, with auth.UnaryServerInterceptor.
+func WithAuthorization() Option {
+	return func(e *ExploreAPI) {
+		e.authorization = true
+	}
+}
+
+// WithWatcher sets the watcher waking watches of likes when a like is recorded. Without it, watches only see new likes
+// when they next poll.
+func WithWatcher(watcher Watcher) Option {
+	return func(e *ExploreAPI) {
+		e.watcher = watcher
 	}
 }
 
+// WithReplayer sets the replayer of failed webhook deliveries. Without it, ReplayWebhookDeliveries is unimplemented.
+func WithReplayer(replayer Replayer) Option {
+	return func(e *ExploreAPI) {
+		e.replayer = replayer
+	}
+}
+
+func New(repository Store, opts ...Option) *ExploreAPI {
+	e := &ExploreAPI{
+		repository:     repository,
+		undoWindow:     DefaultUndoWindow,
+		idempotencyTTL: DefaultIdempotencyTTL,
+		tokens:         pagination.NewCodec(pagination.NewRandomKey()),
+		logger:         slog.Default(),
+		features: Features{
+			Undo:            true,
+			DecisionHistory: true,
+		},
+		watchesClosed: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
 func (e *ExploreAPI) ListLikedYou(ctx context.Context, req *contract.ListLikedYouRequest) (*contract.ListLikedYouResponse, error) {
-	token, err := validateListLikedYouRequest(req)
+	sort, scope, cursor, limit, err := e.validateListLikedYouRequest(req, contract.ExploreAPI_ListLikedYou_FullMethodName)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	if err := e.authorize(ctx, req.RecipientUserId); err != nil {
+		return nil, err
+	}
 
-	likers, err := e.repository.GetLikedDecisions(ctx, req.RecipientUserId, true, token, req.PaginationLimit)
+	likers, err := e.repository.GetLikedDecisions(ctx, req.RecipientUserId, true, sort, cursor, limit)
 	if err != nil {
-		log.Printf("Internal error on GetLikedDecisions call: %v", err)
+		e.logger.ErrorContext(ctx, "Internal error on GetLikedDecisions call", "error", err)
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get recipient likes, %s", err))
 	}
 
-	responseLikers := make([]*contract.ListLikedYouResponse_Liker, len(likers))
-	for index, liker := range likers {
-		responseLikers[index] = &contract.ListLikedYouResponse_Liker{
-			ActorId:   liker.ActorID,
-			UpdatedAt: uint64(liker.UpdatedAt),
-		}
-	}
+	responseLikers := newResponseLikers(likers)
 
-	// Use ID from last liker as token
+	// Use position of last liker as token
 	var nextToken *string
-	if req.PaginationLimit != nil {
+	if limit != nil {
 		index := len(likers)
 		if index > 0 {
 			index--
-			uintToken := strconv.FormatUint(likers[index].ID, 10)
-			nextToken = &uintToken
+			cursor := likers[index].Cursor
+			encoded := e.tokens.Encode(scope, pagination.Position{ID: cursor.ID, Time: cursor.Time})
+			nextToken = &encoded
 		}
 	}
 	return &contract.ListLikedYouResponse{
@@ -73,33 +219,31 @@ func (e *ExploreAPI) ListLikedYou(ctx context.Context, req *contract.ListLikedYo
 }
 
 func (e *ExploreAPI) ListNewLikedYou(ctx context.Context, req *contract.ListLikedYouRequest) (*contract.ListLikedYouResponse, error) {
-	token, err := validateListLikedYouRequest(req)
+	sort, scope, cursor, limit, err := e.validateListLikedYouRequest(req, contract.ExploreAPI_ListNewLikedYou_FullMethodName)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	if err := e.authorize(ctx, req.RecipientUserId); err != nil {
+		return nil, err
+	}
 
-	likers, err := e.repository.GetNewLikedDecisions(ctx, req.RecipientUserId, true, token, req.PaginationLimit)
+	likers, err := e.repository.GetNewLikedDecisions(ctx, req.RecipientUserId, true, sort, cursor, limit)
 	if err != nil {
-		log.Printf("Internal error on GetNewLikedDecisions call: %v", err)
+		e.logger.ErrorContext(ctx, "Internal error on GetNewLikedDecisions call", "error", err)
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get new recipient likes, %s", err))
 	}
 
-	responseLikers := make([]*contract.ListLikedYouResponse_Liker, len(likers))
-	for index, liker := range likers {
-		responseLikers[index] = &contract.ListLikedYouResponse_Liker{
-			ActorId:   liker.ActorID,
-			UpdatedAt: uint64(liker.UpdatedAt),
-		}
-	}
+	responseLikers := newResponseLikers(likers)
 
-	// Use ID from last liker as token
+	// Use position of last liker as token
 	var nextToken *string
-	if req.PaginationLimit != nil {
+	if limit != nil {
 		index := len(likers)
 		if index > 0 {
 			index--
-			uintToken := strconv.FormatUint(likers[index].ID, 10)
-			nextToken = &uintToken
+			cursor := likers[index].Cursor
+			encoded := e.tokens.Encode(scope, pagination.Position{ID: cursor.ID, Time: cursor.Time})
+			nextToken = &encoded
 		}
 	}
 	return &contract.ListLikedYouResponse{
@@ -112,9 +256,12 @@ func (e *ExploreAPI) CountLikedYou(ctx context.Context, req *contract.CountLiked
 	if req.RecipientUserId == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty recipient ID")
 	}
+	if err := e.authorize(ctx, req.RecipientUserId); err != nil {
+		return nil, err
+	}
 	res, err := e.repository.GetLikedDecisionsCount(ctx, req.RecipientUserId, true)
 	if err != nil {
-		log.Printf("Internal error on GetLikedDecisionsCount call: %v", err)
+		e.logger.ErrorContext(ctx, "Internal error on GetLikedDecisionsCount call", "error", err)
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get recipient liked count, %s", err))
 	}
 	return &contract.CountLikedYouResponse{
@@ -123,52 +270,582 @@ func (e *ExploreAPI) CountLikedYou(ctx context.Context, req *contract.CountLiked
 }
 
 func (e *ExploreAPI) PutDecision(ctx context.Context, req *contract.PutDecisionRequest) (*contract.PutDecisionResponse, error) {
-	firstToLike := false
-	// Determine if there is a decision already from the recipient
-	recipientLiked, err := e.repository.GetLikedDecision(ctx, req.ActorUserId, req.RecipientUserId)
-	if err != nil {
-		if errors.Is(err, storage.ErrDecisionNotFound) {
-			firstToLike = true
-		} else {
-			log.Printf("Internal error on GetLikedDecision call: %v", err)
-			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to determine mutual decision, %s", err))
-		}
+	if err := validateUserPair(req.ActorUserId, req.RecipientUserId); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.IdempotencyKey != nil && (*req.IdempotencyKey == "" || len(*req.IdempotencyKey) > maxIdempotencyKeyLength) {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("idempotency key must be 1 to %d bytes", maxIdempotencyKeyLength))
 	}
+	if err := e.authorize(ctx, req.ActorUserId); err != nil {
+		return nil, err
+	}
+
+	return e.recordDecision(ctx, req.RecipientUserId, req.ActorUserId, req.LikedRecipient, req.IdempotencyKey)
+}
 
-	// If there is no mutual decision, just put a single decision for the recipient
-	if firstToLike {
-		err = e.repository.PutDecision(ctx, req.RecipientUserId, req.ActorUserId, req.LikedRecipient)
+func (e *ExploreAPI) BatchPutDecisions(ctx context.Context, req *contract.BatchPutDecisionsRequest) (*contract.BatchPutDecisionsResponse, error) {
+	if req.ActorUserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty actor ID")
+	}
+	if len(req.Decisions) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no decisions")
+	}
+	if len(req.Decisions) > maxBatchDecisions {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("at most %d decisions can be recorded at once", maxBatchDecisions))
+	}
+	if err := e.authorize(ctx, req.ActorUserId); err != nil {
+		return nil, err
+	}
+
+	// Decisions are recorded one at a time, in order, so a later decision for the same recipient replaces an earlier
+	// one and a decision which fails doesn't stop the others
+	results := make([]*contract.BatchPutDecisionsResponse_Result, len(req.Decisions))
+	for index, decision := range req.Decisions {
+		// The caller won't see the results once it has gone, so the rest of the decisions aren't recorded
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+
+		result := &contract.BatchPutDecisionsResponse_Result{}
+		err := validateUserPair(req.ActorUserId, decision.RecipientUserId)
 		if err != nil {
-			log.Printf("Internal error on PutDecision call: %v", err)
-			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to update decision, %s", err))
+			err = status.Error(codes.InvalidArgument, err.Error())
+		} else {
+			var res *contract.PutDecisionResponse
+			res, err = e.recordDecision(ctx, decision.RecipientUserId, req.ActorUserId, decision.LikedRecipient, nil)
+			if err == nil {
+				result.MutualLikes = res.MutualLikes
+				result.Outcome = res.Outcome
+				result.PreviousLiked = res.PreviousLiked
+			}
 		}
+
+		st := status.Convert(err)
+		result.Code = int32(st.Code())
+		result.Message = st.Message()
+		results[index] = result
+	}
+
+	return &contract.BatchPutDecisionsResponse{
+		Results: results,
+	}, nil
+}
+
+// recordDecision records the decision of the actor for the recipient, returning its outcome. A decision with an
+// idempotency key is only recorded the first time, and retries get the result of the first time.
+func (e *ExploreAPI) recordDecision(ctx context.Context, recipientID, actorID string, liked bool, idempotencyKey *string) (*contract.PutDecisionResponse, error) {
+	// Record the decision and read any decision already given by the recipient in one atomic operation,
+	// so concurrent decisions between the same users can't both be treated as the first
+	var res *storage.DecisionResult
+	var err error
+	if idempotencyKey != nil {
+		res, err = e.repository.RecordIdempotentDecision(ctx, *idempotencyKey, e.idempotencyTTL, recipientID, actorID, liked)
 	} else {
-		// If we have a mutual decision then put the decision for recipient with mutually liked set, and update actor decision for mutually liked
-		err = e.repository.PutMutualDecisions(ctx, req.RecipientUserId, req.ActorUserId, req.LikedRecipient, recipientLiked)
-		if err != nil {
-			log.Printf("Internal error on PutMutualDecisions call: %v", err)
-			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to update mutual decision, %s", err))
+		res, err = e.repository.RecordDecision(ctx, recipientID, actorID, liked)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrIdempotencyKeyReused) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
 		}
+		e.logger.ErrorContext(ctx, "Internal error on RecordDecision call", "error", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to update decision, %s", err))
 	}
 
+	outcome := decisionOutcome(res, liked)
 	return &contract.PutDecisionResponse{
-		MutualLikes: recipientLiked == req.LikedRecipient,
+		MutualLikes:   outcome == contract.DecisionOutcome_DECISION_OUTCOME_MATCH,
+		Outcome:       outcome,
+		PreviousLiked: res.PreviousLiked,
+	}, nil
+}
+
+// decisionOutcome compares the decision of the actor with the decision of the recipient for them
+func decisionOutcome(res *storage.DecisionResult, liked bool) contract.DecisionOutcome {
+	switch {
+	case !res.RecipientDecided:
+		return contract.DecisionOutcome_DECISION_OUTCOME_NO_COUNTERPART_DECISION
+	case liked && res.RecipientLiked:
+		return contract.DecisionOutcome_DECISION_OUTCOME_MATCH
+	case !liked && !res.RecipientLiked:
+		return contract.DecisionOutcome_DECISION_OUTCOME_MUTUAL_PASS
+	case !liked && res.WasMatched:
+		return contract.DecisionOutcome_DECISION_OUTCOME_UNMATCHED
+	}
+	return contract.DecisionOutcome_DECISION_OUTCOME_ONE_SIDED
+}
+
+func (e *ExploreAPI) ListMatches(ctx context.Context, req *contract.ListMatchesRequest) (*contract.ListMatchesResponse, error) {
+	scope := pagination.Scope{
+		Endpoint: contract.ExploreAPI_ListMatches_FullMethodName,
+		Filter:   req.UserId,
+		Sort:     pagination.SortID,
+	}
+	token, limit, err := e.validateListMatchesRequest(req, scope)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := e.authorize(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	matches, err := e.repository.GetMatches(ctx, req.UserId, token, limit)
+	if err != nil {
+		e.logger.ErrorContext(ctx, "Internal error on GetMatches call", "error", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get user matches, %s", err))
+	}
+
+	responseMatches := make([]*contract.ListMatchesResponse_Match, len(matches))
+	for index, match := range matches {
+		responseMatches[index] = &contract.ListMatchesResponse_Match{
+			UserId:    match.UserID,
+			MatchedAt: match.MatchedAt,
+		}
+	}
+
+	// Use ID from last match as token
+	var nextToken *string
+	if limit != nil {
+		index := len(matches)
+		if index > 0 {
+			index--
+			encoded := e.tokens.Encode(scope, pagination.Position{ID: matches[index].ID})
+			nextToken = &encoded
+		}
+	}
+	return &contract.ListMatchesResponse{
+		Matches:             responseMatches,
+		NextPaginationToken: nextToken,
 	}, nil
 }
 
-func validateListLikedYouRequest(req *contract.ListLikedYouRequest) (*uint64, error) {
+func newResponseLikers(likers []*storage.Liker) []*contract.ListLikedYouResponse_Liker {
+	responseLikers := make([]*contract.ListLikedYouResponse_Liker, len(likers))
+	for index, liker := range likers {
+		responseLikers[index] = &contract.ListLikedYouResponse_Liker{
+			ActorId:   liker.ActorID,
+			UpdatedAt: uint64(liker.UpdatedAt),
+			CreatedAt: liker.CreatedAt,
+			DecidedAt: liker.DecidedAt,
+			MatchedAt: liker.MatchedAt,
+		}
+	}
+	return responseLikers
+}
+
+func (e *ExploreAPI) UndoDecision(ctx context.Context, req *contract.UndoDecisionRequest) (*contract.UndoDecisionResponse, error) {
+	if !e.features.Undo {
+		return nil, status.Error(codes.Unimplemented, "undo is disabled")
+	}
+	if req.ActorUserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty actor ID")
+	}
 	if req.RecipientUserId == "" {
-		return nil, fmt.Errorf("empty recipient ID")
+		return nil, status.Error(codes.InvalidArgument, "empty recipient ID")
 	}
-	if req.PaginationToken != nil {
-		if *req.PaginationToken == "" {
-			return nil, fmt.Errorf("empty pagination token")
+	if err := e.authorize(ctx, req.ActorUserId); err != nil {
+		return nil, err
+	}
+
+	res, err := e.repository.UndoDecision(ctx, req.RecipientUserId, req.ActorUserId, e.undoWindow)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrDecisionNotFound):
+			return nil, status.Error(codes.NotFound, "no decision to undo")
+		case errors.Is(err, storage.ErrNothingToUndo), errors.Is(err, storage.ErrUndoWindowExpired):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		e.logger.ErrorContext(ctx, "Internal error on UndoDecision call", "error", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to undo decision, %s", err))
+	}
+
+	var liked *bool
+	if res.Restored {
+		liked = &res.Liked
+	}
+	return &contract.UndoDecisionResponse{
+		LikedRecipient: liked,
+	}, nil
+}
+
+func (e *ExploreAPI) Unmatch(ctx context.Context, req *contract.UnmatchRequest) (*contract.UnmatchResponse, error) {
+	err := validateUserPair(req.UserId, req.MatchedUserId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := e.authorize(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	err = e.repository.Unmatch(ctx, req.UserId, req.MatchedUserId)
+	if err != nil {
+		if errors.Is(err, storage.ErrMatchNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		e.logger.ErrorContext(ctx, "Internal error on Unmatch call", "error", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to unmatch users, %s", err))
+	}
+	return &contract.UnmatchResponse{}, nil
+}
+
+func (e *ExploreAPI) BlockUser(ctx context.Context, req *contract.BlockUserRequest) (*contract.BlockUserResponse, error) {
+	err := validateUserPair(req.BlockerUserId, req.BlockedUserId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := e.authorize(ctx, req.BlockerUserId); err != nil {
+		return nil, err
+	}
+
+	err = e.repository.BlockUser(ctx, req.BlockerUserId, req.BlockedUserId)
+	if err != nil {
+		e.logger.ErrorContext(ctx, "Internal error on BlockUser call", "error", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to block user, %s", err))
+	}
+	return &contract.BlockUserResponse{}, nil
+}
+
+func (e *ExploreAPI) UnblockUser(ctx context.Context, req *contract.UnblockUserRequest) (*contract.UnblockUserResponse, error) {
+	err := validateUserPair(req.BlockerUserId, req.BlockedUserId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := e.authorize(ctx, req.BlockerUserId); err != nil {
+		return nil, err
+	}
+
+	err = e.repository.UnblockUser(ctx, req.BlockerUserId, req.BlockedUserId)
+	if err != nil {
+		if errors.Is(err, storage.ErrBlockNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
 		}
-		res, err := strconv.ParseUint(*req.PaginationToken, 10, 64)
+		e.logger.ErrorContext(ctx, "Internal error on UnblockUser call", "error", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to unblock user, %s", err))
+	}
+	return &contract.UnblockUserResponse{}, nil
+}
+
+var eventTypes = map[string]contract.GetDecisionHistoryResponse_EventType{
+	storage.EventImported:  contract.GetDecisionHistoryResponse_EVENT_TYPE_IMPORTED,
+	storage.EventDecided:   contract.GetDecisionHistoryResponse_EVENT_TYPE_DECIDED,
+	storage.EventUndone:    contract.GetDecisionHistoryResponse_EVENT_TYPE_UNDONE,
+	storage.EventUnmatched: contract.GetDecisionHistoryResponse_EVENT_TYPE_UNMATCHED,
+}
+
+func (e *ExploreAPI) GetDecisionHistory(ctx context.Context, req *contract.GetDecisionHistoryRequest) (*contract.GetDecisionHistoryResponse, error) {
+	if !e.features.DecisionHistory {
+		return nil, status.Error(codes.Unimplemented, "decision history is disabled")
+	}
+	if req.ActorUserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty actor ID")
+	}
+	if err := e.authorize(ctx, req.ActorUserId); err != nil {
+		return nil, err
+	}
+	// History for one recipient is a different list from the history for all recipients
+	filter := req.ActorUserId
+	if req.RecipientUserId != nil {
+		filter = fmt.Sprintf("%s\x00%s", req.ActorUserId, *req.RecipientUserId)
+	}
+	scope := pagination.Scope{
+		Endpoint: contract.ExploreAPI_GetDecisionHistory_FullMethodName,
+		Filter:   filter,
+		Sort:     pagination.SortID,
+	}
+	token, err := e.parsePaginationToken(req.PaginationToken, scope)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	limit, err := e.paginationLimit(req.PaginationLimit)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	events, err := e.repository.GetDecisionHistory(ctx, req.ActorUserId, req.RecipientUserId, token, limit)
+	if err != nil {
+		e.logger.ErrorContext(ctx, "Internal error on GetDecisionHistory call", "error", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get decision history, %s", err))
+	}
+
+	responseEvents := make([]*contract.GetDecisionHistoryResponse_Event, len(events))
+	for index, event := range events {
+		responseEvents[index] = &contract.GetDecisionHistoryResponse_Event{
+			RecipientUserId: event.RecipientID,
+			Type:            eventTypes[event.Type],
+			LikedRecipient:  event.Liked,
+			CreatedAt:       event.CreatedAt,
+		}
+	}
+
+	// Use ID from last event as token
+	var nextToken *string
+	if limit != nil {
+		index := len(events)
+		if index > 0 {
+			index--
+			encoded := e.tokens.Encode(scope, pagination.Position{ID: events[index].ID})
+			nextToken = &encoded
+		}
+	}
+	return &contract.GetDecisionHistoryResponse{
+		Events:              responseEvents,
+		NextPaginationToken: nextToken,
+	}, nil
+}
+
+var likeEventTypes = map[bool]contract.WatchLikesResponse_EventType{
+	false: contract.WatchLikesResponse_EVENT_TYPE_LIKED,
+	true:  contract.WatchLikesResponse_EVENT_TYPE_MATCHED,
+}
+
+// WatchLikes streams the likes of the recipient, and the matches formed by their likes, as they are recorded. Events
+// are read from the event log after the last one sent, so a client resuming with the token of the last event it
+// received gets every event since, however long it was disconnected.
+func (e *ExploreAPI) WatchLikes(req *contract.WatchLikesRequest, stream grpc.ServerStreamingServer[contract.WatchLikesResponse]) error {
+	ctx := stream.Context()
+	if req.RecipientUserId == "" {
+		return status.Error(codes.InvalidArgument, "empty recipient ID")
+	}
+	if err := e.authorize(ctx, req.RecipientUserId); err != nil {
+		return err
+	}
+	scope := pagination.Scope{
+		Endpoint: contract.ExploreAPI_WatchLikes_FullMethodName,
+		Filter:   req.RecipientUserId,
+		Sort:     pagination.SortID,
+	}
+	position, err := e.decodePaginationToken(req.ResumeToken, scope)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Subscribe before reading where the stream starts, so likes recorded in between wake it
+	var woken <-chan struct{}
+	if e.watcher != nil {
+		var unsubscribe func()
+		woken, unsubscribe = e.watcher.Subscribe(req.RecipientUserId)
+		defer unsubscribe()
+	}
+
+	var after uint64
+	if position != nil {
+		after = position.ID
+	} else {
+		after, err = e.repository.GetLastLikeEventID(ctx, req.RecipientUserId)
 		if err != nil {
-			return nil, fmt.Errorf("invalid pagination token: %w", err)
+			e.logger.ErrorContext(ctx, "Internal error on GetLastLikeEventID call", "error", err)
+			return status.Error(codes.Internal, fmt.Sprintf("failed to watch likes, %s", err))
+		}
+	}
+	// Headers are sent once the stream is watching, so clients know likes recorded from then on will be sent
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			events, err := e.repository.GetLikeEvents(ctx, req.RecipientUserId, after, watchBatchSize)
+			if err != nil {
+				if ctx.Err() != nil {
+					return status.FromContextError(ctx.Err()).Err()
+				}
+				e.logger.ErrorContext(ctx, "Internal error on GetLikeEvents call", "error", err)
+				return status.Error(codes.Internal, fmt.Sprintf("failed to watch likes, %s", err))
+			}
+			for _, event := range events {
+				err := stream.Send(&contract.WatchLikesResponse{
+					UserId:      event.UserID,
+					Type:        likeEventTypes[event.MatchedAt != nil],
+					CreatedAt:   event.CreatedAt,
+					ResumeToken: e.tokens.Encode(scope, pagination.Position{ID: event.ID}),
+				})
+				if err != nil {
+					return err
+				}
+				after = event.ID
+			}
+			if len(events) < watchBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-woken:
+		case <-ticker.C:
+		case <-e.watchesClosed:
+			// Clients reconnect with their last token, to another instance if this one is shutting down
+			return status.Error(codes.Unavailable, "watch closed, resume from the last event")
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// CloseWatches ends every watch of likes, and any started afterwards once it has caught up. Watches never finish on
+// their own, so they are closed before the server stops, rather than it waiting for them.
+func (e *ExploreAPI) CloseWatches() {
+	e.closeWatches.Do(func() {
+		close(e.watchesClosed)
+	})
+}
+
+// ReplayWebhookDeliveries makes one more attempt at the webhook deliveries which failed every attempt, optionally only
+// those of one subscription. Only admins can replay deliveries, as they aren't for any one user.
+func (e *ExploreAPI) ReplayWebhookDeliveries(ctx context.Context, req *contract.ReplayWebhookDeliveriesRequest) (*contract.ReplayWebhookDeliveriesResponse, error) {
+	if e.replayer == nil {
+		return nil, status.Error(codes.Unimplemented, "webhooks aren't configured")
+	}
+	if req.Subscription != nil && *req.Subscription == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty subscription")
+	}
+	if err := e.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	var limit uint32
+	if req.Limit != nil {
+		limit = *req.Limit
+	}
+	delivered, failed, err := e.replayer.Replay(ctx, req.Subscription, limit)
+	if err != nil {
+		if errors.Is(err, webhook.ErrUnknownSubscription) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		e.logger.ErrorContext(ctx, "Internal error on ReplayWebhookDeliveries call", "error", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to replay webhook deliveries, %s", err))
+	}
+	return &contract.ReplayWebhookDeliveriesResponse{
+		Delivered: uint32(delivered),
+		Failed:    uint32(failed),
+	}, nil
+}
+
+// authorize checks the caller can make the request for the user, when callers are authenticated
+func (e *ExploreAPI) authorize(ctx context.Context, userID string) error {
+	if !e.authorization {
+		return nil
+	}
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing credentials")
+	}
+	if !principal.CanActFor(userID) {
+		return status.Error(codes.PermissionDenied, fmt.Sprintf("not allowed to act for user %s", userID))
+	}
+	return nil
+}
+
+// authorizeAdmin only allows callers with the admin role, when authorization is on
+func (e *ExploreAPI) authorizeAdmin(ctx context.Context) error {
+	if !e.authorization {
+		return nil
+	}
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing credentials")
+	}
+	if !principal.HasRole(auth.RoleAdmin) {
+		return status.Error(codes.PermissionDenied, "requires the admin role")
+	}
+	return nil
+}
+
+// validateUserPair checks both users of a request between two users are set and aren't the same user
+func validateUserPair(userID, otherUserID string) error {
+	if userID == "" || otherUserID == "" {
+		return fmt.Errorf("empty user ID")
+	}
+	if userID == otherUserID {
+		return fmt.Errorf("user IDs must be different")
+	}
+	return nil
+}
+
+var sorts = map[contract.ListLikedYouRequest_Sort]storage.Sort{
+	contract.ListLikedYouRequest_SORT_UNSPECIFIED: storage.SortID,
+	contract.ListLikedYouRequest_SORT_ID:          storage.SortID,
+	contract.ListLikedYouRequest_SORT_UPDATED_AT:  storage.SortUpdatedAt,
+	contract.ListLikedYouRequest_SORT_MATCHED_AT:  storage.SortMatchedAt,
+}
+
+// validateListLikedYouRequest returns the sort of the list, the scope of its pagination tokens, the cursor it
+// continues from and its page size
+func (e *ExploreAPI) validateListLikedYouRequest(req *contract.ListLikedYouRequest, endpoint string) (storage.Sort, pagination.Scope, *storage.Cursor, *uint32, error) {
+	if req.RecipientUserId == "" {
+		return 0, pagination.Scope{}, nil, nil, fmt.Errorf("empty recipient ID")
+	}
+	sort, ok := sorts[req.Sort]
+	if !ok {
+		return 0, pagination.Scope{}, nil, nil, fmt.Errorf("unknown sort %v", req.Sort)
+	}
+	limit, err := e.paginationLimit(req.PaginationLimit)
+	if err != nil {
+		return 0, pagination.Scope{}, nil, nil, err
+	}
+
+	scope := pagination.Scope{
+		Endpoint: endpoint,
+		Filter:   req.RecipientUserId,
+		Sort:     sort.String(),
+	}
+	position, err := e.decodePaginationToken(req.PaginationToken, scope)
+	if err != nil {
+		return 0, pagination.Scope{}, nil, nil, err
+	}
+	if position == nil {
+		return sort, scope, nil, limit, nil
+	}
+	return sort, scope, &storage.Cursor{ID: position.ID, Time: position.Time}, limit, nil
+}
+
+func (e *ExploreAPI) validateListMatchesRequest(req *contract.ListMatchesRequest, scope pagination.Scope) (*uint64, *uint32, error) {
+	if req.UserId == "" {
+		return nil, nil, fmt.Errorf("empty user ID")
+	}
+	limit, err := e.paginationLimit(req.PaginationLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	token, err := e.parsePaginationToken(req.PaginationToken, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, limit, nil
+}
+
+// paginationLimit returns the page size of a list, the default limit if the request doesn't have one. Lists without a
+// limit aren't paginated.
+func (e *ExploreAPI) paginationLimit(limit *uint32) (*uint32, error) {
+	if limit == nil {
+		if e.defaultLimit == 0 {
+			return nil, nil
+		}
+		defaultLimit := e.defaultLimit
+		return &defaultLimit, nil
+	}
+	if e.maxLimit != 0 && *limit > e.maxLimit {
+		return nil, fmt.Errorf("pagination limit must be at most %d", e.maxLimit)
+	}
+	return limit, nil
+}
+
+// parsePaginationToken returns the ID the list continues from, checking the token was issued by this server for the
+// same list
+func (e *ExploreAPI) parsePaginationToken(token *string, scope pagination.Scope) (*uint64, error) {
+	position, err := e.decodePaginationToken(token, scope)
+	if err != nil || position == nil {
+		return nil, err
+	}
+	return &position.ID, nil
+}
+
+func (e *ExploreAPI) decodePaginationToken(token *string, scope pagination.Scope) (*pagination.Position, error) {
+	if token != nil {
+		if *token == "" {
+			return nil, fmt.Errorf("empty pagination token")
 		}
-		return &res, nil
+		return e.tokens.Decode(*token, scope)
 	}
 
 	return nil, nil
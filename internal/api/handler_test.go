@@ -4,26 +4,52 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	contract "github.com/neiln3121/explore-service/explore"
 	"github.com/neiln3121/explore-service/internal/api"
 	"github.com/neiln3121/explore-service/internal/api/mocks"
+	"github.com/neiln3121/explore-service/internal/auth"
+	"github.com/neiln3121/explore-service/internal/pagination"
 	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/webhook"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 )
 
 var (
 	errorDB                    = errors.New("db error")
 	testPaginationLimit        = uint32(1)
-	testValidPaginationToken   = "2"
+	testPaginationKey          = []byte("test-pagination-key")
 	testUintPaginationToken    = uint64(2)
 	testInvalidPaginationToken = "a"
+	testMatchedAt              = uint64(3)
+	testCursorTime             = int64(3000000)
 )
 
+// testPaginationToken creates the token the API issues for the position in the list
+func testPaginationToken(key []byte, endpoint, filter string, id uint64) *string {
+	return testSortedPaginationToken(key, endpoint, filter, pagination.SortID, pagination.Position{ID: id})
+}
+
+func testSortedPaginationToken(key []byte, endpoint, filter, sort string, position pagination.Position) *string {
+	token := pagination.NewCodec(key).Encode(pagination.Scope{
+		Endpoint: endpoint,
+		Filter:   filter,
+		Sort:     sort,
+	}, position)
+	return &token
+}
+
 type mockCall struct {
 	recipientID     string
 	paginationToken *uint64
 	paginationLimit *uint32
+	sort            storage.Sort
+	cursor          *storage.Cursor
 }
 
 func Test_GetCountLikedYou(t *testing.T) {
@@ -90,7 +116,7 @@ func Test_GetListLikedYou(t *testing.T) {
 	ctx := context.Background()
 
 	store := mocks.NewStore(t)
-	api := api.New(store)
+	api := api.New(store, api.WithPaginationKey(testPaginationKey))
 
 	testCases := []struct {
 		description             string
@@ -133,6 +159,34 @@ func Test_GetListLikedYou(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "valid - timestamps",
+			request: &contract.ListLikedYouRequest{
+				RecipientUserId: "1",
+			},
+			mockCall: &mockCall{
+				recipientID: "1",
+			},
+			mockResponse: []*storage.Liker{
+				{
+					ID:        1,
+					ActorID:   "actor-1",
+					UpdatedAt: 4,
+					CreatedAt: 1,
+					DecidedAt: 2,
+					MatchedAt: &testMatchedAt,
+				},
+			},
+			expectedResult: []*contract.ListLikedYouResponse_Liker{
+				{
+					ActorId:   "actor-1",
+					UpdatedAt: 4,
+					CreatedAt: 1,
+					DecidedAt: 2,
+					MatchedAt: &testMatchedAt,
+				},
+			},
+		},
 		{
 			description: "db error",
 			request: &contract.ListLikedYouRequest{
@@ -148,12 +202,12 @@ func Test_GetListLikedYou(t *testing.T) {
 			description: "valid pagination token",
 			request: &contract.ListLikedYouRequest{
 				RecipientUserId: "1",
-				PaginationToken: &testValidPaginationToken,
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListLikedYou_FullMethodName, "1", 2),
 				PaginationLimit: &testPaginationLimit,
 			},
 			mockCall: &mockCall{
 				recipientID:     "1",
-				paginationToken: &testUintPaginationToken,
+				cursor:          &storage.Cursor{ID: testUintPaginationToken},
 				paginationLimit: &testPaginationLimit,
 			},
 			mockResponse: []*storage.Liker{
@@ -166,6 +220,7 @@ func Test_GetListLikedYou(t *testing.T) {
 					ID:        2,
 					ActorID:   "actor-2",
 					UpdatedAt: 2,
+					Cursor:    storage.Cursor{ID: 2},
 				},
 			},
 			expectedResult: []*contract.ListLikedYouResponse_Liker{
@@ -178,7 +233,7 @@ func Test_GetListLikedYou(t *testing.T) {
 					UpdatedAt: 2,
 				},
 			},
-			expectedPaginationToken: &testValidPaginationToken,
+			expectedPaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListLikedYou_FullMethodName, "1", 2),
 		},
 		{
 			description: "invalid pagination token",
@@ -187,7 +242,82 @@ func Test_GetListLikedYou(t *testing.T) {
 				PaginationToken: &testInvalidPaginationToken,
 				PaginationLimit: &testPaginationLimit,
 			},
-			expectedError: "rpc error: code = InvalidArgument desc = invalid pagination token: strconv.ParseUint: parsing \"a\": invalid syntax",
+			expectedError: "rpc error: code = InvalidArgument desc = invalid pagination token",
+		},
+		{
+			description: "pagination token for another recipient",
+			request: &contract.ListLikedYouRequest{
+				RecipientUserId: "1",
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListLikedYou_FullMethodName, "2", 2),
+				PaginationLimit: &testPaginationLimit,
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = pagination token was issued for a different request",
+		},
+		{
+			description: "pagination token for another endpoint",
+			request: &contract.ListLikedYouRequest{
+				RecipientUserId: "1",
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListNewLikedYou_FullMethodName, "1", 2),
+				PaginationLimit: &testPaginationLimit,
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = pagination token was issued for a different request",
+		},
+		{
+			description: "sorted by updated at",
+			request: &contract.ListLikedYouRequest{
+				RecipientUserId: "1",
+				PaginationToken: testSortedPaginationToken(testPaginationKey, contract.ExploreAPI_ListLikedYou_FullMethodName, "1", "updated_at", pagination.Position{ID: 3, Time: &testCursorTime}),
+				PaginationLimit: &testPaginationLimit,
+				Sort:            contract.ListLikedYouRequest_SORT_UPDATED_AT,
+			},
+			mockCall: &mockCall{
+				recipientID:     "1",
+				sort:            storage.SortUpdatedAt,
+				cursor:          &storage.Cursor{ID: 3, Time: &testCursorTime},
+				paginationLimit: &testPaginationLimit,
+			},
+			mockResponse: []*storage.Liker{
+				{
+					ID:        2,
+					ActorID:   "actor-2",
+					UpdatedAt: 2,
+					Cursor:    storage.Cursor{ID: 2, Time: &testCursorTime},
+				},
+			},
+			expectedResult: []*contract.ListLikedYouResponse_Liker{
+				{
+					ActorId:   "actor-2",
+					UpdatedAt: 2,
+				},
+			},
+			expectedPaginationToken: testSortedPaginationToken(testPaginationKey, contract.ExploreAPI_ListLikedYou_FullMethodName, "1", "updated_at", pagination.Position{ID: 2, Time: &testCursorTime}),
+		},
+		{
+			description: "pagination token for another sort",
+			request: &contract.ListLikedYouRequest{
+				RecipientUserId: "1",
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListLikedYou_FullMethodName, "1", 2),
+				PaginationLimit: &testPaginationLimit,
+				Sort:            contract.ListLikedYouRequest_SORT_MATCHED_AT,
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = pagination token was issued for a different request",
+		},
+		{
+			description: "unknown sort",
+			request: &contract.ListLikedYouRequest{
+				RecipientUserId: "1",
+				Sort:            contract.ListLikedYouRequest_Sort(99),
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = unknown sort 99",
+		},
+		{
+			description: "forged pagination token",
+			request: &contract.ListLikedYouRequest{
+				RecipientUserId: "1",
+				PaginationToken: testPaginationToken([]byte("other-key"), contract.ExploreAPI_ListLikedYou_FullMethodName, "1", 2),
+				PaginationLimit: &testPaginationLimit,
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = invalid pagination token",
 		},
 	}
 
@@ -198,7 +328,8 @@ func Test_GetListLikedYou(t *testing.T) {
 					ctx,
 					tc.mockCall.recipientID,
 					true,
-					tc.mockCall.paginationToken,
+					tc.mockCall.sort,
+					tc.mockCall.cursor,
 					tc.mockCall.paginationLimit,
 				).Return(tc.mockResponse, tc.mockError).Once()
 			}
@@ -221,7 +352,7 @@ func Test_GetListNewLikedYou(t *testing.T) {
 	ctx := context.Background()
 
 	store := mocks.NewStore(t)
-	api := api.New(store)
+	api := api.New(store, api.WithPaginationKey(testPaginationKey))
 
 	testCases := []struct {
 		description             string
@@ -279,12 +410,12 @@ func Test_GetListNewLikedYou(t *testing.T) {
 			description: "valid pagination token",
 			request: &contract.ListLikedYouRequest{
 				RecipientUserId: "1",
-				PaginationToken: &testValidPaginationToken,
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListNewLikedYou_FullMethodName, "1", 2),
 				PaginationLimit: &testPaginationLimit,
 			},
 			mockCall: &mockCall{
 				recipientID:     "1",
-				paginationToken: &testUintPaginationToken,
+				cursor:          &storage.Cursor{ID: testUintPaginationToken},
 				paginationLimit: &testPaginationLimit,
 			},
 			mockResponse: []*storage.Liker{
@@ -297,6 +428,7 @@ func Test_GetListNewLikedYou(t *testing.T) {
 					ID:        2,
 					ActorID:   "actor-2",
 					UpdatedAt: 2,
+					Cursor:    storage.Cursor{ID: 2},
 				},
 			},
 			expectedResult: []*contract.ListLikedYouResponse_Liker{
@@ -309,7 +441,7 @@ func Test_GetListNewLikedYou(t *testing.T) {
 					UpdatedAt: 2,
 				},
 			},
-			expectedPaginationToken: &testValidPaginationToken,
+			expectedPaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListNewLikedYou_FullMethodName, "1", 2),
 		},
 		{
 			description: "invalid pagination token",
@@ -318,7 +450,16 @@ func Test_GetListNewLikedYou(t *testing.T) {
 				PaginationToken: &testInvalidPaginationToken,
 				PaginationLimit: &testPaginationLimit,
 			},
-			expectedError: "rpc error: code = InvalidArgument desc = invalid pagination token: strconv.ParseUint: parsing \"a\": invalid syntax",
+			expectedError: "rpc error: code = InvalidArgument desc = invalid pagination token",
+		},
+		{
+			description: "pagination token for another endpoint",
+			request: &contract.ListLikedYouRequest{
+				RecipientUserId: "1",
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListLikedYou_FullMethodName, "1", 2),
+				PaginationLimit: &testPaginationLimit,
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = pagination token was issued for a different request",
 		},
 	}
 
@@ -329,7 +470,8 @@ func Test_GetListNewLikedYou(t *testing.T) {
 					ctx,
 					tc.mockCall.recipientID,
 					true,
-					tc.mockCall.paginationToken,
+					tc.mockCall.sort,
+					tc.mockCall.cursor,
 					tc.mockCall.paginationLimit,
 				).Return(tc.mockResponse, tc.mockError).Once()
 			}
@@ -350,26 +492,21 @@ func Test_GetListNewLikedYou(t *testing.T) {
 }
 
 func Test_PutDecision(t *testing.T) {
-	type mockLikedDecisionResponse struct {
-		liked bool
-		err   error
-	}
-
 	ctx := context.Background()
 
 	store := mocks.NewStore(t)
 	api := api.New(store)
+	liked, passed := true, false
 
 	testCases := []struct {
 		description string
 		request     *contract.PutDecisionRequest
 
-		mockGetLikedDecisionResponse mockLikedDecisionResponse
-		shouldPutDecision            bool
-		shouldPutMutualDecision      bool
-		mockError                    error
-		expectedResult               bool
-		expectedError                string
+		noMockCall       bool
+		mockResponse     *storage.DecisionResult
+		mockError        error
+		expectedResponse *contract.PutDecisionResponse
+		expectedError    string
 	}{
 		{
 			description: "valid - first like",
@@ -378,117 +515,1369 @@ func Test_PutDecision(t *testing.T) {
 				ActorUserId:     "actor-1",
 				LikedRecipient:  true,
 			},
-			mockGetLikedDecisionResponse: mockLikedDecisionResponse{
-				err: storage.ErrDecisionNotFound,
+			mockResponse: &storage.DecisionResult{},
+			expectedResponse: &contract.PutDecisionResponse{
+				Outcome: contract.DecisionOutcome_DECISION_OUTCOME_NO_COUNTERPART_DECISION,
+			},
+		},
+		{
+			description: "valid - first pass",
+			request: &contract.PutDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+				LikedRecipient:  false,
+			},
+			mockResponse: &storage.DecisionResult{},
+			expectedResponse: &contract.PutDecisionResponse{
+				Outcome: contract.DecisionOutcome_DECISION_OUTCOME_NO_COUNTERPART_DECISION,
 			},
-			shouldPutDecision: true,
-			expectedResult:    false,
 		},
 		{
-			description: "db error - first like",
+			description: "valid - mutual likes",
 			request: &contract.PutDecisionRequest{
 				RecipientUserId: "recipient-1",
 				ActorUserId:     "actor-1",
 				LikedRecipient:  true,
 			},
-			mockGetLikedDecisionResponse: mockLikedDecisionResponse{
-				err: errorDB,
+			mockResponse: &storage.DecisionResult{
+				RecipientDecided: true,
+				RecipientLiked:   true,
+			},
+			expectedResponse: &contract.PutDecisionResponse{
+				MutualLikes: true,
+				Outcome:     contract.DecisionOutcome_DECISION_OUTCOME_MATCH,
 			},
-			expectedError: "rpc error: code = Internal desc = failed to determine mutual decision, db error",
 		},
 		{
-			description: "db error - put decision",
+			description: "valid - recipient doesn't like back",
 			request: &contract.PutDecisionRequest{
 				RecipientUserId: "recipient-1",
 				ActorUserId:     "actor-1",
 				LikedRecipient:  true,
 			},
-			mockGetLikedDecisionResponse: mockLikedDecisionResponse{
-				err: storage.ErrDecisionNotFound,
+			mockResponse: &storage.DecisionResult{
+				RecipientDecided: true,
+				RecipientLiked:   false,
+			},
+			expectedResponse: &contract.PutDecisionResponse{
+				Outcome: contract.DecisionOutcome_DECISION_OUTCOME_ONE_SIDED,
 			},
-			shouldPutDecision: true,
-			mockError:         errorDB,
-			expectedError:     "rpc error: code = Internal desc = failed to update decision, db error",
 		},
 		{
-			description: "valid - mutual likes",
+			description: "valid - pass on recipient who likes the actor",
+			request: &contract.PutDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+				LikedRecipient:  false,
+			},
+			mockResponse: &storage.DecisionResult{
+				RecipientDecided: true,
+				RecipientLiked:   true,
+			},
+			expectedResponse: &contract.PutDecisionResponse{
+				Outcome: contract.DecisionOutcome_DECISION_OUTCOME_ONE_SIDED,
+			},
+		},
+		{
+			description: "valid - mutual passes",
+			request: &contract.PutDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+				LikedRecipient:  false,
+			},
+			mockResponse: &storage.DecisionResult{
+				RecipientDecided: true,
+				RecipientLiked:   false,
+			},
+			expectedResponse: &contract.PutDecisionResponse{
+				Outcome: contract.DecisionOutcome_DECISION_OUTCOME_MUTUAL_PASS,
+			},
+		},
+		{
+			description: "valid - pass after matching",
+			request: &contract.PutDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+				LikedRecipient:  false,
+			},
+			mockResponse: &storage.DecisionResult{
+				RecipientDecided: true,
+				RecipientLiked:   true,
+				WasMatched:       true,
+				PreviousLiked:    &liked,
+			},
+			expectedResponse: &contract.PutDecisionResponse{
+				Outcome:       contract.DecisionOutcome_DECISION_OUTCOME_UNMATCHED,
+				PreviousLiked: &liked,
+			},
+		},
+		{
+			description: "valid - like repeated after matching",
 			request: &contract.PutDecisionRequest{
 				RecipientUserId: "recipient-1",
 				ActorUserId:     "actor-1",
 				LikedRecipient:  true,
 			},
-			mockGetLikedDecisionResponse: mockLikedDecisionResponse{
-				liked: true,
+			mockResponse: &storage.DecisionResult{
+				RecipientDecided: true,
+				RecipientLiked:   true,
+				WasMatched:       true,
+				PreviousLiked:    &liked,
+			},
+			expectedResponse: &contract.PutDecisionResponse{
+				MutualLikes:   true,
+				Outcome:       contract.DecisionOutcome_DECISION_OUTCOME_MATCH,
+				PreviousLiked: &liked,
 			},
-			shouldPutMutualDecision: true,
-			expectedResult:          true,
 		},
 		{
-			description: "valid - recipient doesn't like back",
+			description: "valid - pass changed to like",
 			request: &contract.PutDecisionRequest{
 				RecipientUserId: "recipient-1",
 				ActorUserId:     "actor-1",
 				LikedRecipient:  true,
 			},
-			mockGetLikedDecisionResponse: mockLikedDecisionResponse{
-				liked: false,
+			mockResponse: &storage.DecisionResult{
+				PreviousLiked: &passed,
+			},
+			expectedResponse: &contract.PutDecisionResponse{
+				Outcome:       contract.DecisionOutcome_DECISION_OUTCOME_NO_COUNTERPART_DECISION,
+				PreviousLiked: &passed,
 			},
-			shouldPutMutualDecision: true,
-			expectedResult:          false,
 		},
 		{
-			description: "db error - put mutual decision",
+			description: "db error - record decision",
 			request: &contract.PutDecisionRequest{
 				RecipientUserId: "recipient-1",
 				ActorUserId:     "actor-1",
 				LikedRecipient:  true,
 			},
-			mockGetLikedDecisionResponse: mockLikedDecisionResponse{
-				liked: true,
+			mockError:     errorDB,
+			expectedError: "rpc error: code = Internal desc = failed to update decision, db error",
+		},
+		{
+			description: "invalid - empty recipient ID",
+			request: &contract.PutDecisionRequest{
+				ActorUserId:    "actor-1",
+				LikedRecipient: true,
+			},
+			noMockCall:    true,
+			expectedError: "rpc error: code = InvalidArgument desc = empty user ID",
+		},
+		{
+			description: "invalid - decision on self",
+			request: &contract.PutDecisionRequest{
+				RecipientUserId: "actor-1",
+				ActorUserId:     "actor-1",
+				LikedRecipient:  true,
 			},
-			shouldPutMutualDecision: true,
-			mockError:               errorDB,
-			expectedError:           "rpc error: code = Internal desc = failed to update mutual decision, db error",
+			noMockCall:    true,
+			expectedError: "rpc error: code = InvalidArgument desc = user IDs must be different",
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
-			store.EXPECT().GetLikedDecision(
-				ctx,
-				tc.request.ActorUserId,
-				tc.request.RecipientUserId,
-			).Return(tc.mockGetLikedDecisionResponse.liked, tc.mockGetLikedDecisionResponse.err).Once()
-
-			if tc.shouldPutDecision {
-				store.EXPECT().PutDecision(
+			if !tc.noMockCall {
+				store.EXPECT().RecordDecision(
 					ctx,
 					tc.request.RecipientUserId,
 					tc.request.ActorUserId,
 					tc.request.LikedRecipient,
-				).Return(tc.mockError).Once()
+				).Return(tc.mockResponse, tc.mockError).Once()
 			}
 
-			if tc.shouldPutMutualDecision {
-				store.EXPECT().PutMutualDecisions(
-					ctx,
-					tc.request.RecipientUserId,
-					tc.request.ActorUserId,
-					tc.request.LikedRecipient,
-					tc.mockGetLikedDecisionResponse.liked,
-				).Return(tc.mockError).Once()
+			res, err := api.PutDecision(ctx, tc.request)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedResponse, res)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, res)
 			}
 
-			res, err := api.PutDecision(ctx, tc.request)
+		})
+	}
+}
+
+func Test_PutDecisionIdempotency(t *testing.T) {
+	ctx := context.Background()
+	key := "swipe-1"
+	empty := ""
+
+	testCases := []struct {
+		description    string
+		idempotencyKey *string
+		noMockCall     bool
+		mockError      error
+		expectedError  string
+	}{
+		{
+			description:    "recorded once",
+			idempotencyKey: &key,
+		},
+		{
+			description:    "key used for another decision",
+			idempotencyKey: &key,
+			mockError:      storage.ErrIdempotencyKeyReused,
+			expectedError:  "rpc error: code = AlreadyExists desc = idempotency key was used for a different decision",
+		},
+		{
+			description:    "empty key",
+			idempotencyKey: &empty,
+			noMockCall:     true,
+			expectedError:  "rpc error: code = InvalidArgument desc = idempotency key must be 1 to 255 bytes",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			store := mocks.NewStore(t)
+			api := api.New(store, api.WithIdempotencyTTL(time.Hour))
+			if !tc.noMockCall {
+				store.EXPECT().RecordIdempotentDecision(ctx, *tc.idempotencyKey, time.Hour, "recipient-1", "actor-1", true).
+					Return(&storage.DecisionResult{RecipientDecided: true, RecipientLiked: true}, tc.mockError).Once()
+			}
+
+			res, err := api.PutDecision(ctx, &contract.PutDecisionRequest{
+				ActorUserId:     "actor-1",
+				RecipientUserId: "recipient-1",
+				LikedRecipient:  true,
+				IdempotencyKey:  tc.idempotencyKey,
+			})
 
 			if tc.expectedError == "" {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.expectedResult, res.MutualLikes)
+				assert.True(t, res.MutualLikes)
 			} else {
 				assert.EqualError(t, err, tc.expectedError)
 				assert.Nil(t, res)
 			}
+		})
+	}
+}
+
+func Test_BatchPutDecisions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("results are in order", func(t *testing.T) {
+		store := mocks.NewStore(t)
+		api := api.New(store)
+		store.EXPECT().RecordDecision(ctx, "recipient-1", "actor-1", true).Return(&storage.DecisionResult{}, nil).Once()
+		store.EXPECT().RecordDecision(ctx, "recipient-2", "actor-1", true).Return(&storage.DecisionResult{
+			RecipientDecided: true,
+			RecipientLiked:   true,
+		}, nil).Once()
+		store.EXPECT().RecordDecision(ctx, "recipient-3", "actor-1", false).Return(nil, errorDB).Once()
+
+		res, err := api.BatchPutDecisions(ctx, &contract.BatchPutDecisionsRequest{
+			ActorUserId: "actor-1",
+			Decisions: []*contract.BatchPutDecisionsRequest_Decision{
+				{RecipientUserId: "recipient-1", LikedRecipient: true},
+				{RecipientUserId: "recipient-2", LikedRecipient: true},
+				{RecipientUserId: "actor-1", LikedRecipient: true},
+				{RecipientUserId: "recipient-3", LikedRecipient: false},
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []*contract.BatchPutDecisionsResponse_Result{
+			{Outcome: contract.DecisionOutcome_DECISION_OUTCOME_NO_COUNTERPART_DECISION},
+			{MutualLikes: true, Outcome: contract.DecisionOutcome_DECISION_OUTCOME_MATCH},
+			{Code: int32(codes.InvalidArgument), Message: "user IDs must be different"},
+			{Code: int32(codes.Internal), Message: "failed to update decision, db error"},
+		}, res.Results)
+	})
+
+	testCases := []struct {
+		description   string
+		request       *contract.BatchPutDecisionsRequest
+		principal     *auth.Principal
+		expectedError string
+	}{
+		{
+			description: "empty actor",
+			request: &contract.BatchPutDecisionsRequest{
+				Decisions: []*contract.BatchPutDecisionsRequest_Decision{{RecipientUserId: "recipient-1"}},
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = empty actor ID",
+		},
+		{
+			description: "no decisions",
+			request: &contract.BatchPutDecisionsRequest{
+				ActorUserId: "actor-1",
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = no decisions",
+		},
+		{
+			description: "too many decisions",
+			request: &contract.BatchPutDecisionsRequest{
+				ActorUserId: "actor-1",
+				Decisions:   make([]*contract.BatchPutDecisionsRequest_Decision, 101),
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = at most 100 decisions can be recorded at once",
+		},
+		{
+			description: "another user",
+			request: &contract.BatchPutDecisionsRequest{
+				ActorUserId: "actor-1",
+				Decisions:   []*contract.BatchPutDecisionsRequest_Decision{{RecipientUserId: "recipient-1"}},
+			},
+			principal:     &auth.Principal{Subject: "recipient-1"},
+			expectedError: "rpc error: code = PermissionDenied desc = not allowed to act for user actor-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			api := api.New(mocks.NewStore(t), api.WithAuthorization())
+			ctx := ctx
+			if tc.principal != nil {
+				ctx = auth.WithPrincipal(ctx, tc.principal)
+			}
 
+			res, err := api.BatchPutDecisions(ctx, tc.request)
+
+			assert.EqualError(t, err, tc.expectedError)
+			assert.Nil(t, res)
 		})
 	}
 }
+
+func Test_ListMatches(t *testing.T) {
+	ctx := context.Background()
+
+	store := mocks.NewStore(t)
+	api := api.New(store, api.WithPaginationKey(testPaginationKey))
+
+	testCases := []struct {
+		description             string
+		request                 *contract.ListMatchesRequest
+		mockCall                *mockCall
+		mockResponse            []*storage.Match
+		mockError               error
+		expectedResult          []*contract.ListMatchesResponse_Match
+		expectedPaginationToken *string
+		expectedError           string
+	}{
+		{
+			description: "valid",
+			request: &contract.ListMatchesRequest{
+				UserId: "1",
+			},
+			mockCall: &mockCall{
+				recipientID: "1",
+			},
+			mockResponse: []*storage.Match{
+				{
+					ID:        1,
+					UserID:    "user-1",
+					MatchedAt: 1,
+				},
+				{
+					ID:        2,
+					UserID:    "user-2",
+					MatchedAt: 2,
+				},
+			},
+			expectedResult: []*contract.ListMatchesResponse_Match{
+				{
+					UserId:    "user-1",
+					MatchedAt: 1,
+				},
+				{
+					UserId:    "user-2",
+					MatchedAt: 2,
+				},
+			},
+		},
+		{
+			description: "db error",
+			request: &contract.ListMatchesRequest{
+				UserId: "1",
+			},
+			mockCall: &mockCall{
+				recipientID: "1",
+			},
+			mockError:     errorDB,
+			expectedError: "rpc error: code = Internal desc = failed to get user matches, db error",
+		},
+		{
+			description: "valid pagination token",
+			request: &contract.ListMatchesRequest{
+				UserId:          "1",
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListMatches_FullMethodName, "1", 2),
+				PaginationLimit: &testPaginationLimit,
+			},
+			mockCall: &mockCall{
+				recipientID:     "1",
+				paginationToken: &testUintPaginationToken,
+				paginationLimit: &testPaginationLimit,
+			},
+			mockResponse: []*storage.Match{
+				{
+					ID:        2,
+					UserID:    "user-2",
+					MatchedAt: 2,
+				},
+			},
+			expectedResult: []*contract.ListMatchesResponse_Match{
+				{
+					UserId:    "user-2",
+					MatchedAt: 2,
+				},
+			},
+			expectedPaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListMatches_FullMethodName, "1", 2),
+		},
+		{
+			description: "invalid pagination token",
+			request: &contract.ListMatchesRequest{
+				UserId:          "1",
+				PaginationToken: &testInvalidPaginationToken,
+				PaginationLimit: &testPaginationLimit,
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = invalid pagination token",
+		},
+		{
+			description: "pagination token for another user",
+			request: &contract.ListMatchesRequest{
+				UserId:          "1",
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListMatches_FullMethodName, "2", 2),
+				PaginationLimit: &testPaginationLimit,
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = pagination token was issued for a different request",
+		},
+		{
+			description: "invalid request",
+			request: &contract.ListMatchesRequest{
+				UserId: "",
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = empty user ID",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tc.mockCall != nil {
+				store.EXPECT().GetMatches(
+					ctx,
+					tc.mockCall.recipientID,
+					tc.mockCall.paginationToken,
+					tc.mockCall.paginationLimit,
+				).Return(tc.mockResponse, tc.mockError).Once()
+			}
+
+			res, err := api.ListMatches(ctx, tc.request)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedResult, res.Matches)
+				assert.Equal(t, tc.expectedPaginationToken, res.NextPaginationToken)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, res)
+			}
+
+		})
+	}
+}
+
+func Test_UndoDecision(t *testing.T) {
+	ctx := context.Background()
+
+	store := mocks.NewStore(t)
+	api := api.New(store, api.WithUndoWindow(time.Minute))
+
+	liked := true
+
+	testCases := []struct {
+		description    string
+		request        *contract.UndoDecisionRequest
+		noMockCall     bool
+		mockResponse   *storage.UndoResult
+		mockError      error
+		expectedResult *bool
+		expectedError  string
+	}{
+		{
+			description: "valid - decision removed",
+			request: &contract.UndoDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+			},
+			mockResponse: &storage.UndoResult{},
+		},
+		{
+			description: "valid - earlier decision restored",
+			request: &contract.UndoDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+			},
+			mockResponse: &storage.UndoResult{
+				Restored: true,
+				Liked:    true,
+			},
+			expectedResult: &liked,
+		},
+		{
+			description: "no decision",
+			request: &contract.UndoDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+			},
+			mockError:     storage.ErrDecisionNotFound,
+			expectedError: "rpc error: code = NotFound desc = no decision to undo",
+		},
+		{
+			description: "already undone",
+			request: &contract.UndoDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+			},
+			mockError:     storage.ErrNothingToUndo,
+			expectedError: "rpc error: code = FailedPrecondition desc = last decision has already been undone",
+		},
+		{
+			description: "outside undo window",
+			request: &contract.UndoDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+			},
+			mockError:     storage.ErrUndoWindowExpired,
+			expectedError: "rpc error: code = FailedPrecondition desc = last decision is too old to undo",
+		},
+		{
+			description: "db error",
+			request: &contract.UndoDecisionRequest{
+				RecipientUserId: "recipient-1",
+				ActorUserId:     "actor-1",
+			},
+			mockError:     errorDB,
+			expectedError: "rpc error: code = Internal desc = failed to undo decision, db error",
+		},
+		{
+			description: "invalid request",
+			request: &contract.UndoDecisionRequest{
+				RecipientUserId: "recipient-1",
+			},
+			noMockCall:    true,
+			expectedError: "rpc error: code = InvalidArgument desc = empty actor ID",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if !tc.noMockCall {
+				store.EXPECT().UndoDecision(
+					ctx,
+					tc.request.RecipientUserId,
+					tc.request.ActorUserId,
+					time.Minute,
+				).Return(tc.mockResponse, tc.mockError).Once()
+			}
+
+			res, err := api.UndoDecision(ctx, tc.request)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedResult, res.LikedRecipient)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, res)
+			}
+
+		})
+	}
+}
+
+func Test_Unmatch(t *testing.T) {
+	ctx := context.Background()
+
+	store := mocks.NewStore(t)
+	api := api.New(store)
+
+	testCases := []struct {
+		description   string
+		request       *contract.UnmatchRequest
+		noMockCall    bool
+		mockError     error
+		expectedError string
+	}{
+		{
+			description: "valid",
+			request: &contract.UnmatchRequest{
+				UserId:        "user-1",
+				MatchedUserId: "user-2",
+			},
+		},
+		{
+			description: "not matched",
+			request: &contract.UnmatchRequest{
+				UserId:        "user-1",
+				MatchedUserId: "user-2",
+			},
+			mockError:     storage.ErrMatchNotFound,
+			expectedError: "rpc error: code = NotFound desc = users have not matched",
+		},
+		{
+			description: "db error",
+			request: &contract.UnmatchRequest{
+				UserId:        "user-1",
+				MatchedUserId: "user-2",
+			},
+			mockError:     errorDB,
+			expectedError: "rpc error: code = Internal desc = failed to unmatch users, db error",
+		},
+		{
+			description: "invalid request",
+			request: &contract.UnmatchRequest{
+				UserId: "user-1",
+			},
+			noMockCall:    true,
+			expectedError: "rpc error: code = InvalidArgument desc = empty user ID",
+		},
+		{
+			description: "same user",
+			request: &contract.UnmatchRequest{
+				UserId:        "user-1",
+				MatchedUserId: "user-1",
+			},
+			noMockCall:    true,
+			expectedError: "rpc error: code = InvalidArgument desc = user IDs must be different",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if !tc.noMockCall {
+				store.EXPECT().Unmatch(ctx, tc.request.UserId, tc.request.MatchedUserId).Return(tc.mockError).Once()
+			}
+
+			res, err := api.Unmatch(ctx, tc.request)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.NotNil(t, res)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, res)
+			}
+
+		})
+	}
+}
+
+func Test_BlockUser(t *testing.T) {
+	ctx := context.Background()
+
+	store := mocks.NewStore(t)
+	api := api.New(store)
+
+	testCases := []struct {
+		description   string
+		request       *contract.BlockUserRequest
+		noMockCall    bool
+		mockError     error
+		expectedError string
+	}{
+		{
+			description: "valid",
+			request: &contract.BlockUserRequest{
+				BlockerUserId: "user-1",
+				BlockedUserId: "user-2",
+			},
+		},
+		{
+			description: "db error",
+			request: &contract.BlockUserRequest{
+				BlockerUserId: "user-1",
+				BlockedUserId: "user-2",
+			},
+			mockError:     errorDB,
+			expectedError: "rpc error: code = Internal desc = failed to block user, db error",
+		},
+		{
+			description: "same user",
+			request: &contract.BlockUserRequest{
+				BlockerUserId: "user-1",
+				BlockedUserId: "user-1",
+			},
+			noMockCall:    true,
+			expectedError: "rpc error: code = InvalidArgument desc = user IDs must be different",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if !tc.noMockCall {
+				store.EXPECT().BlockUser(ctx, tc.request.BlockerUserId, tc.request.BlockedUserId).Return(tc.mockError).Once()
+			}
+
+			res, err := api.BlockUser(ctx, tc.request)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.NotNil(t, res)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, res)
+			}
+
+		})
+	}
+}
+
+func Test_UnblockUser(t *testing.T) {
+	ctx := context.Background()
+
+	store := mocks.NewStore(t)
+	api := api.New(store)
+
+	testCases := []struct {
+		description   string
+		request       *contract.UnblockUserRequest
+		noMockCall    bool
+		mockError     error
+		expectedError string
+	}{
+		{
+			description: "valid",
+			request: &contract.UnblockUserRequest{
+				BlockerUserId: "user-1",
+				BlockedUserId: "user-2",
+			},
+		},
+		{
+			description: "not blocked",
+			request: &contract.UnblockUserRequest{
+				BlockerUserId: "user-1",
+				BlockedUserId: "user-2",
+			},
+			mockError:     storage.ErrBlockNotFound,
+			expectedError: "rpc error: code = NotFound desc = user has not been blocked",
+		},
+		{
+			description: "db error",
+			request: &contract.UnblockUserRequest{
+				BlockerUserId: "user-1",
+				BlockedUserId: "user-2",
+			},
+			mockError:     errorDB,
+			expectedError: "rpc error: code = Internal desc = failed to unblock user, db error",
+		},
+		{
+			description: "invalid request",
+			request: &contract.UnblockUserRequest{
+				BlockedUserId: "user-2",
+			},
+			noMockCall:    true,
+			expectedError: "rpc error: code = InvalidArgument desc = empty user ID",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if !tc.noMockCall {
+				store.EXPECT().UnblockUser(ctx, tc.request.BlockerUserId, tc.request.BlockedUserId).Return(tc.mockError).Once()
+			}
+
+			res, err := api.UnblockUser(ctx, tc.request)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.NotNil(t, res)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, res)
+			}
+
+		})
+	}
+}
+
+func Test_GetDecisionHistory(t *testing.T) {
+	ctx := context.Background()
+
+	store := mocks.NewStore(t)
+	api := api.New(store, api.WithPaginationKey(testPaginationKey))
+
+	liked := true
+	recipientID := "recipient-1"
+
+	testCases := []struct {
+		description             string
+		request                 *contract.GetDecisionHistoryRequest
+		mockCall                *mockCall
+		mockResponse            []*storage.DecisionEvent
+		mockError               error
+		expectedResult          []*contract.GetDecisionHistoryResponse_Event
+		expectedPaginationToken *string
+		expectedError           string
+	}{
+		{
+			description: "valid",
+			request: &contract.GetDecisionHistoryRequest{
+				ActorUserId:     "1",
+				RecipientUserId: &recipientID,
+			},
+			mockCall: &mockCall{
+				recipientID: "1",
+			},
+			mockResponse: []*storage.DecisionEvent{
+				{
+					ID:          1,
+					RecipientID: recipientID,
+					Type:        storage.EventDecided,
+					Liked:       &liked,
+					CreatedAt:   1,
+				},
+				{
+					ID:          2,
+					RecipientID: recipientID,
+					Type:        storage.EventUndone,
+					CreatedAt:   2,
+				},
+			},
+			expectedResult: []*contract.GetDecisionHistoryResponse_Event{
+				{
+					RecipientUserId: recipientID,
+					Type:            contract.GetDecisionHistoryResponse_EVENT_TYPE_DECIDED,
+					LikedRecipient:  &liked,
+					CreatedAt:       1,
+				},
+				{
+					RecipientUserId: recipientID,
+					Type:            contract.GetDecisionHistoryResponse_EVENT_TYPE_UNDONE,
+					CreatedAt:       2,
+				},
+			},
+		},
+		{
+			description: "db error",
+			request: &contract.GetDecisionHistoryRequest{
+				ActorUserId:     "1",
+				RecipientUserId: &recipientID,
+			},
+			mockCall: &mockCall{
+				recipientID: "1",
+			},
+			mockError:     errorDB,
+			expectedError: "rpc error: code = Internal desc = failed to get decision history, db error",
+		},
+		{
+			description: "valid pagination token",
+			request: &contract.GetDecisionHistoryRequest{
+				ActorUserId:     "1",
+				RecipientUserId: &recipientID,
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_GetDecisionHistory_FullMethodName, "1\x00"+recipientID, 2),
+				PaginationLimit: &testPaginationLimit,
+			},
+			mockCall: &mockCall{
+				recipientID:     "1",
+				paginationToken: &testUintPaginationToken,
+				paginationLimit: &testPaginationLimit,
+			},
+			mockResponse: []*storage.DecisionEvent{
+				{
+					ID:          2,
+					RecipientID: recipientID,
+					Type:        storage.EventUnmatched,
+					Liked:       &liked,
+					CreatedAt:   2,
+				},
+			},
+			expectedResult: []*contract.GetDecisionHistoryResponse_Event{
+				{
+					RecipientUserId: recipientID,
+					Type:            contract.GetDecisionHistoryResponse_EVENT_TYPE_UNMATCHED,
+					LikedRecipient:  &liked,
+					CreatedAt:       2,
+				},
+			},
+			expectedPaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_GetDecisionHistory_FullMethodName, "1\x00"+recipientID, 2),
+		},
+		{
+			description: "invalid pagination token",
+			request: &contract.GetDecisionHistoryRequest{
+				ActorUserId:     "1",
+				PaginationToken: &testInvalidPaginationToken,
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = invalid pagination token",
+		},
+		{
+			description: "pagination token for all recipients",
+			request: &contract.GetDecisionHistoryRequest{
+				ActorUserId:     "1",
+				RecipientUserId: &recipientID,
+				PaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_GetDecisionHistory_FullMethodName, "1", 2),
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = pagination token was issued for a different request",
+		},
+		{
+			description: "invalid request",
+			request: &contract.GetDecisionHistoryRequest{
+				ActorUserId: "",
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = empty actor ID",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tc.mockCall != nil {
+				store.EXPECT().GetDecisionHistory(
+					ctx,
+					tc.mockCall.recipientID,
+					tc.request.RecipientUserId,
+					tc.mockCall.paginationToken,
+					tc.mockCall.paginationLimit,
+				).Return(tc.mockResponse, tc.mockError).Once()
+			}
+
+			res, err := api.GetDecisionHistory(ctx, tc.request)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedResult, res.Events)
+				assert.Equal(t, tc.expectedPaginationToken, res.NextPaginationToken)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, res)
+			}
+
+		})
+	}
+}
+
+func Test_PaginationLimits(t *testing.T) {
+	ctx := context.Background()
+
+	store := mocks.NewStore(t)
+	api := api.New(store, api.WithPaginationKey(testPaginationKey), api.WithPaginationLimits(2, 10))
+
+	defaultLimit := uint32(2)
+	maxLimit := uint32(10)
+	overLimit := uint32(11)
+
+	testCases := []struct {
+		description             string
+		request                 *contract.ListMatchesRequest
+		mockCall                *mockCall
+		mockResponse            []*storage.Match
+		expectedPaginationToken *string
+		expectedError           string
+	}{
+		{
+			description: "default limit",
+			request: &contract.ListMatchesRequest{
+				UserId: "1",
+			},
+			mockCall: &mockCall{
+				recipientID:     "1",
+				paginationLimit: &defaultLimit,
+			},
+			mockResponse: []*storage.Match{
+				{
+					ID:     3,
+					UserID: "user-3",
+				},
+			},
+			expectedPaginationToken: testPaginationToken(testPaginationKey, contract.ExploreAPI_ListMatches_FullMethodName, "1", 3),
+		},
+		{
+			description: "max limit",
+			request: &contract.ListMatchesRequest{
+				UserId:          "1",
+				PaginationLimit: &maxLimit,
+			},
+			mockCall: &mockCall{
+				recipientID:     "1",
+				paginationLimit: &maxLimit,
+			},
+		},
+		{
+			description: "over max limit",
+			request: &contract.ListMatchesRequest{
+				UserId:          "1",
+				PaginationLimit: &overLimit,
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = pagination limit must be at most 10",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tc.mockCall != nil {
+				store.EXPECT().GetMatches(
+					ctx,
+					tc.mockCall.recipientID,
+					tc.mockCall.paginationToken,
+					tc.mockCall.paginationLimit,
+				).Return(tc.mockResponse, nil).Once()
+			}
+
+			res, err := api.ListMatches(ctx, tc.request)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedPaginationToken, res.NextPaginationToken)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Nil(t, res)
+			}
+		})
+	}
+}
+
+func Test_DisabledFeatures(t *testing.T) {
+	ctx := context.Background()
+
+	store := mocks.NewStore(t)
+	api := api.New(store, api.WithFeatures(api.Features{}))
+
+	_, err := api.UndoDecision(ctx, &contract.UndoDecisionRequest{
+		ActorUserId:     "1",
+		RecipientUserId: "2",
+	})
+	assert.EqualError(t, err, "rpc error: code = Unimplemented desc = undo is disabled")
+
+	_, err = api.GetDecisionHistory(ctx, &contract.GetDecisionHistoryRequest{
+		ActorUserId: "1",
+	})
+	assert.EqualError(t, err, "rpc error: code = Unimplemented desc = decision history is disabled")
+}
+
+func Test_Authorization(t *testing.T) {
+	store := mocks.NewStore(t)
+	api := api.New(store, api.WithAuthorization())
+
+	testCases := []struct {
+		description   string
+		principal     *auth.Principal
+		noMockCall    bool
+		expectedError string
+	}{
+		{
+			description: "actor",
+			principal:   &auth.Principal{Subject: "actor-1"},
+		},
+		{
+			description: "service acting for the actor",
+			principal:   &auth.Principal{Subject: "matcher", Roles: []string{auth.RoleService}},
+		},
+		{
+			description: "admin acting for the actor",
+			principal:   &auth.Principal{Subject: "operator", Roles: []string{auth.RoleAdmin}},
+		},
+		{
+			description:   "another user",
+			principal:     &auth.Principal{Subject: "recipient-1", Roles: []string{"user"}},
+			noMockCall:    true,
+			expectedError: "rpc error: code = PermissionDenied desc = not allowed to act for user actor-1",
+		},
+		{
+			description:   "unauthenticated",
+			noMockCall:    true,
+			expectedError: "rpc error: code = Unauthenticated desc = missing credentials",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.principal != nil {
+				ctx = auth.WithPrincipal(ctx, tc.principal)
+			}
+			if !tc.noMockCall {
+				store.EXPECT().RecordDecision(ctx, "recipient-1", "actor-1", true).Return(&storage.DecisionResult{}, nil).Once()
+			}
+
+			_, err := api.PutDecision(ctx, &contract.PutDecisionRequest{
+				ActorUserId:     "actor-1",
+				RecipientUserId: "recipient-1",
+				LikedRecipient:  true,
+			})
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+
+	t.Run("lists are for the recipient", func(t *testing.T) {
+		ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "actor-1"})
+
+		_, err := api.ListLikedYou(ctx, &contract.ListLikedYouRequest{
+			RecipientUserId: "recipient-1",
+		})
+
+		assert.EqualError(t, err, "rpc error: code = PermissionDenied desc = not allowed to act for user recipient-1")
+	})
+}
+
+// watchStream collects the events sent on it, and cancels its context once it has been sent the expected number
+type watchStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	cancel   context.CancelFunc
+	expected int
+	events   []*contract.WatchLikesResponse
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *watchStream) Send(res *contract.WatchLikesResponse) error {
+	s.events = append(s.events, res)
+	if len(s.events) == s.expected {
+		s.cancel()
+	}
+	return nil
+}
+
+func Test_WatchLikes(t *testing.T) {
+	store := mocks.NewStore(t)
+	api := api.New(store, api.WithPaginationKey(testPaginationKey))
+
+	testCases := []struct {
+		description        string
+		request            *contract.WatchLikesRequest
+		mockLastEventID    *uint64
+		mockLastEventError error
+		mockAfter          *uint64
+		mockResponse       []*storage.LikeEvent
+		mockError          error
+		expectedResult     []*contract.WatchLikesResponse
+		expectedError      string
+	}{
+		{
+			description: "from now",
+			request: &contract.WatchLikesRequest{
+				RecipientUserId: "1",
+			},
+			mockLastEventID: &testUintPaginationToken,
+			mockAfter:       &testUintPaginationToken,
+			mockResponse: []*storage.LikeEvent{
+				{
+					ID:        3,
+					UserID:    "2",
+					CreatedAt: 1,
+				},
+				{
+					ID:        4,
+					UserID:    "3",
+					MatchedAt: &testMatchedAt,
+					CreatedAt: 3,
+				},
+			},
+			expectedResult: []*contract.WatchLikesResponse{
+				{
+					UserId:      "2",
+					Type:        contract.WatchLikesResponse_EVENT_TYPE_LIKED,
+					CreatedAt:   1,
+					ResumeToken: *testPaginationToken(testPaginationKey, contract.ExploreAPI_WatchLikes_FullMethodName, "1", 3),
+				},
+				{
+					UserId:      "3",
+					Type:        contract.WatchLikesResponse_EVENT_TYPE_MATCHED,
+					CreatedAt:   3,
+					ResumeToken: *testPaginationToken(testPaginationKey, contract.ExploreAPI_WatchLikes_FullMethodName, "1", 4),
+				},
+			},
+			// The stream only ends when the client goes away
+			expectedError: "rpc error: code = Canceled desc = context canceled",
+		},
+		{
+			description: "resumed",
+			request: &contract.WatchLikesRequest{
+				RecipientUserId: "1",
+				ResumeToken:     testPaginationToken(testPaginationKey, contract.ExploreAPI_WatchLikes_FullMethodName, "1", 2),
+			},
+			mockAfter: &testUintPaginationToken,
+			mockResponse: []*storage.LikeEvent{
+				{
+					ID:        3,
+					UserID:    "2",
+					CreatedAt: 1,
+				},
+			},
+			expectedResult: []*contract.WatchLikesResponse{
+				{
+					UserId:      "2",
+					Type:        contract.WatchLikesResponse_EVENT_TYPE_LIKED,
+					CreatedAt:   1,
+					ResumeToken: *testPaginationToken(testPaginationKey, contract.ExploreAPI_WatchLikes_FullMethodName, "1", 3),
+				},
+			},
+			expectedError: "rpc error: code = Canceled desc = context canceled",
+		},
+		{
+			description: "db error",
+			request: &contract.WatchLikesRequest{
+				RecipientUserId: "1",
+			},
+			mockLastEventID: &testUintPaginationToken,
+			mockAfter:       &testUintPaginationToken,
+			mockError:       errorDB,
+			expectedError:   "rpc error: code = Internal desc = failed to watch likes, db error",
+		},
+		{
+			description: "db error reading the last event",
+			request: &contract.WatchLikesRequest{
+				RecipientUserId: "1",
+			},
+			mockLastEventError: errorDB,
+			expectedError:      "rpc error: code = Internal desc = failed to watch likes, db error",
+		},
+		{
+			description: "resume token for another recipient",
+			request: &contract.WatchLikesRequest{
+				RecipientUserId: "1",
+				ResumeToken:     testPaginationToken(testPaginationKey, contract.ExploreAPI_WatchLikes_FullMethodName, "2", 2),
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = pagination token was issued for a different request",
+		},
+		{
+			description: "invalid request",
+			request: &contract.WatchLikesRequest{
+				RecipientUserId: "",
+			},
+			expectedError: "rpc error: code = InvalidArgument desc = empty recipient ID",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tc.mockLastEventID != nil || tc.mockLastEventError != nil {
+				var id uint64
+				if tc.mockLastEventID != nil {
+					id = *tc.mockLastEventID
+				}
+				store.EXPECT().GetLastLikeEventID(mock.Anything, tc.request.RecipientUserId).Return(id, tc.mockLastEventError).Once()
+			}
+			if tc.mockAfter != nil {
+				store.EXPECT().GetLikeEvents(mock.Anything, tc.request.RecipientUserId, *tc.mockAfter, uint32(100)).Return(tc.mockResponse, tc.mockError).Once()
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream := &watchStream{ctx: ctx, cancel: cancel, expected: len(tc.expectedResult)}
+
+			err := api.WatchLikes(tc.request, stream)
+
+			assert.EqualError(t, err, tc.expectedError)
+			assert.Equal(t, tc.expectedResult, stream.events)
+		})
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		store.EXPECT().GetLastLikeEventID(mock.Anything, "1").Return(0, nil).Once()
+		store.EXPECT().GetLikeEvents(mock.Anything, "1", uint64(0), uint32(100)).Return(nil, nil).Once()
+		api.CloseWatches()
+
+		err := api.WatchLikes(&contract.WatchLikesRequest{RecipientUserId: "1"}, &watchStream{ctx: context.Background()})
+
+		assert.EqualError(t, err, "rpc error: code = Unavailable desc = watch closed, resume from the last event")
+	})
+}
+
+// replayerFunc replays deliveries with a function
+type replayerFunc func(ctx context.Context, subscription *string, limit uint32) (int, int, error)
+
+func (f replayerFunc) Replay(ctx context.Context, subscription *string, limit uint32) (int, int, error) {
+	return f(ctx, subscription, limit)
+}
+
+func Test_ReplayWebhookDeliveries(t *testing.T) {
+	admin := &auth.Principal{Subject: "operator", Roles: []string{auth.RoleAdmin}}
+	partner := "partner"
+	empty := ""
+	limit := uint32(10)
+
+	testCases := []struct {
+		description      string
+		principal        *auth.Principal
+		req              *contract.ReplayWebhookDeliveriesRequest
+		replayErr        error
+		expectedResponse *contract.ReplayWebhookDeliveriesResponse
+		expectedError    string
+	}{
+		{
+			description:      "replayed",
+			principal:        admin,
+			req:              &contract.ReplayWebhookDeliveriesRequest{Subscription: &partner, Limit: &limit},
+			expectedResponse: &contract.ReplayWebhookDeliveriesResponse{Delivered: 2, Failed: 1},
+		},
+		{
+			description:   "not an admin",
+			principal:     &auth.Principal{Subject: "matcher", Roles: []string{auth.RoleService}},
+			req:           &contract.ReplayWebhookDeliveriesRequest{},
+			expectedError: "rpc error: code = PermissionDenied desc = requires the admin role",
+		},
+		{
+			description:   "unauthenticated",
+			req:           &contract.ReplayWebhookDeliveriesRequest{},
+			expectedError: "rpc error: code = Unauthenticated desc = missing credentials",
+		},
+		{
+			description:   "empty subscription",
+			principal:     admin,
+			req:           &contract.ReplayWebhookDeliveriesRequest{Subscription: &empty},
+			expectedError: "rpc error: code = InvalidArgument desc = empty subscription",
+		},
+		{
+			description:   "unknown subscription",
+			principal:     admin,
+			req:           &contract.ReplayWebhookDeliveriesRequest{Subscription: &partner},
+			replayErr:     webhook.ErrUnknownSubscription,
+			expectedError: "rpc error: code = NotFound desc = unknown webhook subscription",
+		},
+		{
+			description:   "store error",
+			principal:     admin,
+			req:           &contract.ReplayWebhookDeliveriesRequest{},
+			replayErr:     errorDB,
+			expectedError: "rpc error: code = Internal desc = failed to replay webhook deliveries, db error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.principal != nil {
+				ctx = auth.WithPrincipal(ctx, tc.principal)
+			}
+			replayer := replayerFunc(func(ctx context.Context, subscription *string, limit uint32) (int, int, error) {
+				assert.Equal(t, tc.req.Subscription, subscription)
+				assert.Equal(t, tc.req.GetLimit(), limit)
+				return 2, 1, tc.replayErr
+			})
+			api := api.New(mocks.NewStore(t), api.WithAuthorization(), api.WithReplayer(replayer))
+
+			res, err := api.ReplayWebhookDeliveries(ctx, tc.req)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedResponse, res)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+
+	t.Run("webhooks aren't configured", func(t *testing.T) {
+		api := api.New(mocks.NewStore(t))
+
+		_, err := api.ReplayWebhookDeliveries(context.Background(), &contract.ReplayWebhookDeliveriesRequest{})
+
+		assert.EqualError(t, err, "rpc error: code = Unimplemented desc = webhooks aren't configured")
+	})
+}
@@ -7,6 +7,8 @@ import (
 
 	storage "github.com/neiln3121/explore-service/internal/storage"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // Store is an autogenerated mock type for the Store type
@@ -22,27 +24,77 @@ func (_m *Store) EXPECT() *Store_Expecter {
 	return &Store_Expecter{mock: &_m.Mock}
 }
 
-// GetLikedDecision provides a mock function with given fields: ctx, recipientID, actorID
-func (_m *Store) GetLikedDecision(ctx context.Context, recipientID string, actorID string) (bool, error) {
-	ret := _m.Called(ctx, recipientID, actorID)
+// BlockUser provides a mock function with given fields: ctx, blockerID, blockedID
+func (_m *Store) BlockUser(ctx context.Context, blockerID string, blockedID string) error {
+	ret := _m.Called(ctx, blockerID, blockedID)
 
 	if len(ret) == 0 {
-		panic("no return value specified for GetLikedDecision")
+		panic("no return value specified for BlockUser")
 	}
 
-	var r0 bool
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, blockerID, blockedID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Store_BlockUser_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'BlockUser'
+type Store_BlockUser_Call struct {
+	*mock.Call
+}
+
+// BlockUser is a helper method to define mock.On call
+//   - ctx context.Context
+//   - blockerID string
+//   - blockedID string
+func (_e *Store_Expecter) BlockUser(ctx interface{}, blockerID interface{}, blockedID interface{}) *Store_BlockUser_Call {
+	return &Store_BlockUser_Call{Call: _e.mock.On("BlockUser", ctx, blockerID, blockedID)}
+}
+
+func (_c *Store_BlockUser_Call) Run(run func(ctx context.Context, blockerID string, blockedID string)) *Store_BlockUser_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *Store_BlockUser_Call) Return(_a0 error) *Store_BlockUser_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Store_BlockUser_Call) RunAndReturn(run func(context.Context, string, string) error) *Store_BlockUser_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetDecisionHistory provides a mock function with given fields: ctx, actorID, recipientID, token, limit
+func (_m *Store) GetDecisionHistory(ctx context.Context, actorID string, recipientID *string, token *uint64, limit *uint32) ([]*storage.DecisionEvent, error) {
+	ret := _m.Called(ctx, actorID, recipientID, token, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetDecisionHistory")
+	}
+
+	var r0 []*storage.DecisionEvent
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) (bool, error)); ok {
-		return rf(ctx, recipientID, actorID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *string, *uint64, *uint32) ([]*storage.DecisionEvent, error)); ok {
+		return rf(ctx, actorID, recipientID, token, limit)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) bool); ok {
-		r0 = rf(ctx, recipientID, actorID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *string, *uint64, *uint32) []*storage.DecisionEvent); ok {
+		r0 = rf(ctx, actorID, recipientID, token, limit)
 	} else {
-		r0 = ret.Get(0).(bool)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*storage.DecisionEvent)
+		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
-		r1 = rf(ctx, recipientID, actorID)
+	if rf, ok := ret.Get(1).(func(context.Context, string, *string, *uint64, *uint32) error); ok {
+		r1 = rf(ctx, actorID, recipientID, token, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -50,39 +102,159 @@ func (_m *Store) GetLikedDecision(ctx context.Context, recipientID string, actor
 	return r0, r1
 }
 
-// Store_GetLikedDecision_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetLikedDecision'
-type Store_GetLikedDecision_Call struct {
+// Store_GetDecisionHistory_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetDecisionHistory'
+type Store_GetDecisionHistory_Call struct {
 	*mock.Call
 }
 
-// GetLikedDecision is a helper method to define mock.On call
+// GetDecisionHistory is a helper method to define mock.On call
 //   - ctx context.Context
-//   - recipientID string
 //   - actorID string
-func (_e *Store_Expecter) GetLikedDecision(ctx interface{}, recipientID interface{}, actorID interface{}) *Store_GetLikedDecision_Call {
-	return &Store_GetLikedDecision_Call{Call: _e.mock.On("GetLikedDecision", ctx, recipientID, actorID)}
+//   - recipientID *string
+//   - token *uint64
+//   - limit *uint32
+func (_e *Store_Expecter) GetDecisionHistory(ctx interface{}, actorID interface{}, recipientID interface{}, token interface{}, limit interface{}) *Store_GetDecisionHistory_Call {
+	return &Store_GetDecisionHistory_Call{Call: _e.mock.On("GetDecisionHistory", ctx, actorID, recipientID, token, limit)}
 }
 
-func (_c *Store_GetLikedDecision_Call) Run(run func(ctx context.Context, recipientID string, actorID string)) *Store_GetLikedDecision_Call {
+func (_c *Store_GetDecisionHistory_Call) Run(run func(ctx context.Context, actorID string, recipientID *string, token *uint64, limit *uint32)) *Store_GetDecisionHistory_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(string))
+		run(args[0].(context.Context), args[1].(string), args[2].(*string), args[3].(*uint64), args[4].(*uint32))
 	})
 	return _c
 }
 
-func (_c *Store_GetLikedDecision_Call) Return(_a0 bool, _a1 error) *Store_GetLikedDecision_Call {
+func (_c *Store_GetDecisionHistory_Call) Return(_a0 []*storage.DecisionEvent, _a1 error) *Store_GetDecisionHistory_Call {
 	_c.Call.Return(_a0, _a1)
 	return _c
 }
 
-func (_c *Store_GetLikedDecision_Call) RunAndReturn(run func(context.Context, string, string) (bool, error)) *Store_GetLikedDecision_Call {
+func (_c *Store_GetDecisionHistory_Call) RunAndReturn(run func(context.Context, string, *string, *uint64, *uint32) ([]*storage.DecisionEvent, error)) *Store_GetDecisionHistory_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// GetLikedDecisions provides a mock function with given fields: ctx, recipientID, liked, token, limit
-func (_m *Store) GetLikedDecisions(ctx context.Context, recipientID string, liked bool, token *uint64, limit *uint32) ([]*storage.Liker, error) {
-	ret := _m.Called(ctx, recipientID, liked, token, limit)
+// GetLastLikeEventID provides a mock function with given fields: ctx, userID
+func (_m *Store) GetLastLikeEventID(ctx context.Context, userID string) (uint64, error) {
+	ret := _m.Called(ctx, userID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetLastLikeEventID")
+	}
+
+	var r0 uint64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (uint64, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) uint64); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Get(0).(uint64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Store_GetLastLikeEventID_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetLastLikeEventID'
+type Store_GetLastLikeEventID_Call struct {
+	*mock.Call
+}
+
+// GetLastLikeEventID is a helper method to define mock.On call
+//   - ctx context.Context
+//   - userID string
+func (_e *Store_Expecter) GetLastLikeEventID(ctx interface{}, userID interface{}) *Store_GetLastLikeEventID_Call {
+	return &Store_GetLastLikeEventID_Call{Call: _e.mock.On("GetLastLikeEventID", ctx, userID)}
+}
+
+func (_c *Store_GetLastLikeEventID_Call) Run(run func(ctx context.Context, userID string)) *Store_GetLastLikeEventID_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Store_GetLastLikeEventID_Call) Return(_a0 uint64, _a1 error) *Store_GetLastLikeEventID_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Store_GetLastLikeEventID_Call) RunAndReturn(run func(context.Context, string) (uint64, error)) *Store_GetLastLikeEventID_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetLikeEvents provides a mock function with given fields: ctx, userID, after, limit
+func (_m *Store) GetLikeEvents(ctx context.Context, userID string, after uint64, limit uint32) ([]*storage.LikeEvent, error) {
+	ret := _m.Called(ctx, userID, after, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetLikeEvents")
+	}
+
+	var r0 []*storage.LikeEvent
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, uint64, uint32) ([]*storage.LikeEvent, error)); ok {
+		return rf(ctx, userID, after, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, uint64, uint32) []*storage.LikeEvent); ok {
+		r0 = rf(ctx, userID, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*storage.LikeEvent)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, uint64, uint32) error); ok {
+		r1 = rf(ctx, userID, after, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Store_GetLikeEvents_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetLikeEvents'
+type Store_GetLikeEvents_Call struct {
+	*mock.Call
+}
+
+// GetLikeEvents is a helper method to define mock.On call
+//   - ctx context.Context
+//   - userID string
+//   - after uint64
+//   - limit uint32
+func (_e *Store_Expecter) GetLikeEvents(ctx interface{}, userID interface{}, after interface{}, limit interface{}) *Store_GetLikeEvents_Call {
+	return &Store_GetLikeEvents_Call{Call: _e.mock.On("GetLikeEvents", ctx, userID, after, limit)}
+}
+
+func (_c *Store_GetLikeEvents_Call) Run(run func(ctx context.Context, userID string, after uint64, limit uint32)) *Store_GetLikeEvents_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(uint64), args[3].(uint32))
+	})
+	return _c
+}
+
+func (_c *Store_GetLikeEvents_Call) Return(_a0 []*storage.LikeEvent, _a1 error) *Store_GetLikeEvents_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Store_GetLikeEvents_Call) RunAndReturn(run func(context.Context, string, uint64, uint32) ([]*storage.LikeEvent, error)) *Store_GetLikeEvents_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetLikedDecisions provides a mock function with given fields: ctx, recipientID, liked, sort, cursor, limit
+func (_m *Store) GetLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error) {
+	ret := _m.Called(ctx, recipientID, liked, sort, cursor, limit)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetLikedDecisions")
@@ -90,19 +262,19 @@ func (_m *Store) GetLikedDecisions(ctx context.Context, recipientID string, like
 
 	var r0 []*storage.Liker
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, bool, *uint64, *uint32) ([]*storage.Liker, error)); ok {
-		return rf(ctx, recipientID, liked, token, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool, storage.Sort, *storage.Cursor, *uint32) ([]*storage.Liker, error)); ok {
+		return rf(ctx, recipientID, liked, sort, cursor, limit)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, bool, *uint64, *uint32) []*storage.Liker); ok {
-		r0 = rf(ctx, recipientID, liked, token, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool, storage.Sort, *storage.Cursor, *uint32) []*storage.Liker); ok {
+		r0 = rf(ctx, recipientID, liked, sort, cursor, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*storage.Liker)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, bool, *uint64, *uint32) error); ok {
-		r1 = rf(ctx, recipientID, liked, token, limit)
+	if rf, ok := ret.Get(1).(func(context.Context, string, bool, storage.Sort, *storage.Cursor, *uint32) error); ok {
+		r1 = rf(ctx, recipientID, liked, sort, cursor, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -119,15 +291,16 @@ type Store_GetLikedDecisions_Call struct {
 //   - ctx context.Context
 //   - recipientID string
 //   - liked bool
-//   - token *uint64
+//   - sort storage.Sort
+//   - cursor *storage.Cursor
 //   - limit *uint32
-func (_e *Store_Expecter) GetLikedDecisions(ctx interface{}, recipientID interface{}, liked interface{}, token interface{}, limit interface{}) *Store_GetLikedDecisions_Call {
-	return &Store_GetLikedDecisions_Call{Call: _e.mock.On("GetLikedDecisions", ctx, recipientID, liked, token, limit)}
+func (_e *Store_Expecter) GetLikedDecisions(ctx interface{}, recipientID interface{}, liked interface{}, sort interface{}, cursor interface{}, limit interface{}) *Store_GetLikedDecisions_Call {
+	return &Store_GetLikedDecisions_Call{Call: _e.mock.On("GetLikedDecisions", ctx, recipientID, liked, sort, cursor, limit)}
 }
 
-func (_c *Store_GetLikedDecisions_Call) Run(run func(ctx context.Context, recipientID string, liked bool, token *uint64, limit *uint32)) *Store_GetLikedDecisions_Call {
+func (_c *Store_GetLikedDecisions_Call) Run(run func(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32)) *Store_GetLikedDecisions_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(bool), args[3].(*uint64), args[4].(*uint32))
+		run(args[0].(context.Context), args[1].(string), args[2].(bool), args[3].(storage.Sort), args[4].(*storage.Cursor), args[5].(*uint32))
 	})
 	return _c
 }
@@ -137,7 +310,7 @@ func (_c *Store_GetLikedDecisions_Call) Return(_a0 []*storage.Liker, _a1 error)
 	return _c
 }
 
-func (_c *Store_GetLikedDecisions_Call) RunAndReturn(run func(context.Context, string, bool, *uint64, *uint32) ([]*storage.Liker, error)) *Store_GetLikedDecisions_Call {
+func (_c *Store_GetLikedDecisions_Call) RunAndReturn(run func(context.Context, string, bool, storage.Sort, *storage.Cursor, *uint32) ([]*storage.Liker, error)) *Store_GetLikedDecisions_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -200,9 +373,70 @@ func (_c *Store_GetLikedDecisionsCount_Call) RunAndReturn(run func(context.Conte
 	return _c
 }
 
-// GetNewLikedDecisions provides a mock function with given fields: ctx, recipientID, liked, token, limit
-func (_m *Store) GetNewLikedDecisions(ctx context.Context, recipientID string, liked bool, token *uint64, limit *uint32) ([]*storage.Liker, error) {
-	ret := _m.Called(ctx, recipientID, liked, token, limit)
+// GetMatches provides a mock function with given fields: ctx, userID, token, limit
+func (_m *Store) GetMatches(ctx context.Context, userID string, token *uint64, limit *uint32) ([]*storage.Match, error) {
+	ret := _m.Called(ctx, userID, token, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetMatches")
+	}
+
+	var r0 []*storage.Match
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *uint64, *uint32) ([]*storage.Match, error)); ok {
+		return rf(ctx, userID, token, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, *uint64, *uint32) []*storage.Match); ok {
+		r0 = rf(ctx, userID, token, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*storage.Match)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, *uint64, *uint32) error); ok {
+		r1 = rf(ctx, userID, token, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Store_GetMatches_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetMatches'
+type Store_GetMatches_Call struct {
+	*mock.Call
+}
+
+// GetMatches is a helper method to define mock.On call
+//   - ctx context.Context
+//   - userID string
+//   - token *uint64
+//   - limit *uint32
+func (_e *Store_Expecter) GetMatches(ctx interface{}, userID interface{}, token interface{}, limit interface{}) *Store_GetMatches_Call {
+	return &Store_GetMatches_Call{Call: _e.mock.On("GetMatches", ctx, userID, token, limit)}
+}
+
+func (_c *Store_GetMatches_Call) Run(run func(ctx context.Context, userID string, token *uint64, limit *uint32)) *Store_GetMatches_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(*uint64), args[3].(*uint32))
+	})
+	return _c
+}
+
+func (_c *Store_GetMatches_Call) Return(_a0 []*storage.Match, _a1 error) *Store_GetMatches_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Store_GetMatches_Call) RunAndReturn(run func(context.Context, string, *uint64, *uint32) ([]*storage.Match, error)) *Store_GetMatches_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetNewLikedDecisions provides a mock function with given fields: ctx, recipientID, liked, sort, cursor, limit
+func (_m *Store) GetNewLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error) {
+	ret := _m.Called(ctx, recipientID, liked, sort, cursor, limit)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetNewLikedDecisions")
@@ -210,19 +444,19 @@ func (_m *Store) GetNewLikedDecisions(ctx context.Context, recipientID string, l
 
 	var r0 []*storage.Liker
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, bool, *uint64, *uint32) ([]*storage.Liker, error)); ok {
-		return rf(ctx, recipientID, liked, token, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool, storage.Sort, *storage.Cursor, *uint32) ([]*storage.Liker, error)); ok {
+		return rf(ctx, recipientID, liked, sort, cursor, limit)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, bool, *uint64, *uint32) []*storage.Liker); ok {
-		r0 = rf(ctx, recipientID, liked, token, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool, storage.Sort, *storage.Cursor, *uint32) []*storage.Liker); ok {
+		r0 = rf(ctx, recipientID, liked, sort, cursor, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*storage.Liker)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, bool, *uint64, *uint32) error); ok {
-		r1 = rf(ctx, recipientID, liked, token, limit)
+	if rf, ok := ret.Get(1).(func(context.Context, string, bool, storage.Sort, *storage.Cursor, *uint32) error); ok {
+		r1 = rf(ctx, recipientID, liked, sort, cursor, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -239,15 +473,16 @@ type Store_GetNewLikedDecisions_Call struct {
 //   - ctx context.Context
 //   - recipientID string
 //   - liked bool
-//   - token *uint64
+//   - sort storage.Sort
+//   - cursor *storage.Cursor
 //   - limit *uint32
-func (_e *Store_Expecter) GetNewLikedDecisions(ctx interface{}, recipientID interface{}, liked interface{}, token interface{}, limit interface{}) *Store_GetNewLikedDecisions_Call {
-	return &Store_GetNewLikedDecisions_Call{Call: _e.mock.On("GetNewLikedDecisions", ctx, recipientID, liked, token, limit)}
+func (_e *Store_Expecter) GetNewLikedDecisions(ctx interface{}, recipientID interface{}, liked interface{}, sort interface{}, cursor interface{}, limit interface{}) *Store_GetNewLikedDecisions_Call {
+	return &Store_GetNewLikedDecisions_Call{Call: _e.mock.On("GetNewLikedDecisions", ctx, recipientID, liked, sort, cursor, limit)}
 }
 
-func (_c *Store_GetNewLikedDecisions_Call) Run(run func(ctx context.Context, recipientID string, liked bool, token *uint64, limit *uint32)) *Store_GetNewLikedDecisions_Call {
+func (_c *Store_GetNewLikedDecisions_Call) Run(run func(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32)) *Store_GetNewLikedDecisions_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(bool), args[3].(*uint64), args[4].(*uint32))
+		run(args[0].(context.Context), args[1].(string), args[2].(bool), args[3].(storage.Sort), args[4].(*storage.Cursor), args[5].(*uint32))
 	})
 	return _c
 }
@@ -257,22 +492,146 @@ func (_c *Store_GetNewLikedDecisions_Call) Return(_a0 []*storage.Liker, _a1 erro
 	return _c
 }
 
-func (_c *Store_GetNewLikedDecisions_Call) RunAndReturn(run func(context.Context, string, bool, *uint64, *uint32) ([]*storage.Liker, error)) *Store_GetNewLikedDecisions_Call {
+func (_c *Store_GetNewLikedDecisions_Call) RunAndReturn(run func(context.Context, string, bool, storage.Sort, *storage.Cursor, *uint32) ([]*storage.Liker, error)) *Store_GetNewLikedDecisions_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RecordDecision provides a mock function with given fields: ctx, recipientID, actorID, liked
+func (_m *Store) RecordDecision(ctx context.Context, recipientID string, actorID string, liked bool) (*storage.DecisionResult, error) {
+	ret := _m.Called(ctx, recipientID, actorID, liked)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecordDecision")
+	}
+
+	var r0 *storage.DecisionResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool) (*storage.DecisionResult, error)); ok {
+		return rf(ctx, recipientID, actorID, liked)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool) *storage.DecisionResult); ok {
+		r0 = rf(ctx, recipientID, actorID, liked)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*storage.DecisionResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, bool) error); ok {
+		r1 = rf(ctx, recipientID, actorID, liked)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Store_RecordDecision_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RecordDecision'
+type Store_RecordDecision_Call struct {
+	*mock.Call
+}
+
+// RecordDecision is a helper method to define mock.On call
+//   - ctx context.Context
+//   - recipientID string
+//   - actorID string
+//   - liked bool
+func (_e *Store_Expecter) RecordDecision(ctx interface{}, recipientID interface{}, actorID interface{}, liked interface{}) *Store_RecordDecision_Call {
+	return &Store_RecordDecision_Call{Call: _e.mock.On("RecordDecision", ctx, recipientID, actorID, liked)}
+}
+
+func (_c *Store_RecordDecision_Call) Run(run func(ctx context.Context, recipientID string, actorID string, liked bool)) *Store_RecordDecision_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(bool))
+	})
+	return _c
+}
+
+func (_c *Store_RecordDecision_Call) Return(_a0 *storage.DecisionResult, _a1 error) *Store_RecordDecision_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Store_RecordDecision_Call) RunAndReturn(run func(context.Context, string, string, bool) (*storage.DecisionResult, error)) *Store_RecordDecision_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RecordIdempotentDecision provides a mock function with given fields: ctx, key, ttl, recipientID, actorID, liked
+func (_m *Store) RecordIdempotentDecision(ctx context.Context, key string, ttl time.Duration, recipientID string, actorID string, liked bool) (*storage.DecisionResult, error) {
+	ret := _m.Called(ctx, key, ttl, recipientID, actorID, liked)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecordIdempotentDecision")
+	}
+
+	var r0 *storage.DecisionResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration, string, string, bool) (*storage.DecisionResult, error)); ok {
+		return rf(ctx, key, ttl, recipientID, actorID, liked)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration, string, string, bool) *storage.DecisionResult); ok {
+		r0 = rf(ctx, key, ttl, recipientID, actorID, liked)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*storage.DecisionResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Duration, string, string, bool) error); ok {
+		r1 = rf(ctx, key, ttl, recipientID, actorID, liked)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Store_RecordIdempotentDecision_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RecordIdempotentDecision'
+type Store_RecordIdempotentDecision_Call struct {
+	*mock.Call
+}
+
+// RecordIdempotentDecision is a helper method to define mock.On call
+//   - ctx context.Context
+//   - key string
+//   - ttl time.Duration
+//   - recipientID string
+//   - actorID string
+//   - liked bool
+func (_e *Store_Expecter) RecordIdempotentDecision(ctx interface{}, key interface{}, ttl interface{}, recipientID interface{}, actorID interface{}, liked interface{}) *Store_RecordIdempotentDecision_Call {
+	return &Store_RecordIdempotentDecision_Call{Call: _e.mock.On("RecordIdempotentDecision", ctx, key, ttl, recipientID, actorID, liked)}
+}
+
+func (_c *Store_RecordIdempotentDecision_Call) Run(run func(ctx context.Context, key string, ttl time.Duration, recipientID string, actorID string, liked bool)) *Store_RecordIdempotentDecision_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(time.Duration), args[3].(string), args[4].(string), args[5].(bool))
+	})
+	return _c
+}
+
+func (_c *Store_RecordIdempotentDecision_Call) Return(_a0 *storage.DecisionResult, _a1 error) *Store_RecordIdempotentDecision_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Store_RecordIdempotentDecision_Call) RunAndReturn(run func(context.Context, string, time.Duration, string, string, bool) (*storage.DecisionResult, error)) *Store_RecordIdempotentDecision_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// PutDecision provides a mock function with given fields: ctx, recipient_id, actor_id, liked
-func (_m *Store) PutDecision(ctx context.Context, recipient_id string, actor_id string, liked bool) error {
-	ret := _m.Called(ctx, recipient_id, actor_id, liked)
+// UnblockUser provides a mock function with given fields: ctx, blockerID, blockedID
+func (_m *Store) UnblockUser(ctx context.Context, blockerID string, blockedID string) error {
+	ret := _m.Called(ctx, blockerID, blockedID)
 
 	if len(ret) == 0 {
-		panic("no return value specified for PutDecision")
+		panic("no return value specified for UnblockUser")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool) error); ok {
-		r0 = rf(ctx, recipient_id, actor_id, liked)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, blockerID, blockedID)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -280,48 +639,108 @@ func (_m *Store) PutDecision(ctx context.Context, recipient_id string, actor_id
 	return r0
 }
 
-// Store_PutDecision_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PutDecision'
-type Store_PutDecision_Call struct {
+// Store_UnblockUser_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UnblockUser'
+type Store_UnblockUser_Call struct {
 	*mock.Call
 }
 
-// PutDecision is a helper method to define mock.On call
+// UnblockUser is a helper method to define mock.On call
 //   - ctx context.Context
-//   - recipient_id string
-//   - actor_id string
-//   - liked bool
-func (_e *Store_Expecter) PutDecision(ctx interface{}, recipient_id interface{}, actor_id interface{}, liked interface{}) *Store_PutDecision_Call {
-	return &Store_PutDecision_Call{Call: _e.mock.On("PutDecision", ctx, recipient_id, actor_id, liked)}
+//   - blockerID string
+//   - blockedID string
+func (_e *Store_Expecter) UnblockUser(ctx interface{}, blockerID interface{}, blockedID interface{}) *Store_UnblockUser_Call {
+	return &Store_UnblockUser_Call{Call: _e.mock.On("UnblockUser", ctx, blockerID, blockedID)}
 }
 
-func (_c *Store_PutDecision_Call) Run(run func(ctx context.Context, recipient_id string, actor_id string, liked bool)) *Store_PutDecision_Call {
+func (_c *Store_UnblockUser_Call) Run(run func(ctx context.Context, blockerID string, blockedID string)) *Store_UnblockUser_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(bool))
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
 	})
 	return _c
 }
 
-func (_c *Store_PutDecision_Call) Return(_a0 error) *Store_PutDecision_Call {
+func (_c *Store_UnblockUser_Call) Return(_a0 error) *Store_UnblockUser_Call {
 	_c.Call.Return(_a0)
 	return _c
 }
 
-func (_c *Store_PutDecision_Call) RunAndReturn(run func(context.Context, string, string, bool) error) *Store_PutDecision_Call {
+func (_c *Store_UnblockUser_Call) RunAndReturn(run func(context.Context, string, string) error) *Store_UnblockUser_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// PutMutualDecisions provides a mock function with given fields: ctx, recipient_id, actor_id, liked, mutuallyLiked
-func (_m *Store) PutMutualDecisions(ctx context.Context, recipient_id string, actor_id string, liked bool, mutuallyLiked bool) error {
-	ret := _m.Called(ctx, recipient_id, actor_id, liked, mutuallyLiked)
+// UndoDecision provides a mock function with given fields: ctx, recipientID, actorID, window
+func (_m *Store) UndoDecision(ctx context.Context, recipientID string, actorID string, window time.Duration) (*storage.UndoResult, error) {
+	ret := _m.Called(ctx, recipientID, actorID, window)
 
 	if len(ret) == 0 {
-		panic("no return value specified for PutMutualDecisions")
+		panic("no return value specified for UndoDecision")
+	}
+
+	var r0 *storage.UndoResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Duration) (*storage.UndoResult, error)); ok {
+		return rf(ctx, recipientID, actorID, window)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Duration) *storage.UndoResult); ok {
+		r0 = rf(ctx, recipientID, actorID, window)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*storage.UndoResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Duration) error); ok {
+		r1 = rf(ctx, recipientID, actorID, window)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Store_UndoDecision_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UndoDecision'
+type Store_UndoDecision_Call struct {
+	*mock.Call
+}
+
+// UndoDecision is a helper method to define mock.On call
+//   - ctx context.Context
+//   - recipientID string
+//   - actorID string
+//   - window time.Duration
+func (_e *Store_Expecter) UndoDecision(ctx interface{}, recipientID interface{}, actorID interface{}, window interface{}) *Store_UndoDecision_Call {
+	return &Store_UndoDecision_Call{Call: _e.mock.On("UndoDecision", ctx, recipientID, actorID, window)}
+}
+
+func (_c *Store_UndoDecision_Call) Run(run func(ctx context.Context, recipientID string, actorID string, window time.Duration)) *Store_UndoDecision_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(time.Duration))
+	})
+	return _c
+}
+
+func (_c *Store_UndoDecision_Call) Return(_a0 *storage.UndoResult, _a1 error) *Store_UndoDecision_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Store_UndoDecision_Call) RunAndReturn(run func(context.Context, string, string, time.Duration) (*storage.UndoResult, error)) *Store_UndoDecision_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Unmatch provides a mock function with given fields: ctx, userID, matchedUserID
+func (_m *Store) Unmatch(ctx context.Context, userID string, matchedUserID string) error {
+	ret := _m.Called(ctx, userID, matchedUserID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Unmatch")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, bool, bool) error); ok {
-		r0 = rf(ctx, recipient_id, actor_id, liked, mutuallyLiked)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, userID, matchedUserID)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -329,34 +748,32 @@ func (_m *Store) PutMutualDecisions(ctx context.Context, recipient_id string, ac
 	return r0
 }
 
-// Store_PutMutualDecisions_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PutMutualDecisions'
-type Store_PutMutualDecisions_Call struct {
+// Store_Unmatch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Unmatch'
+type Store_Unmatch_Call struct {
 	*mock.Call
 }
 
-// PutMutualDecisions is a helper method to define mock.On call
+// Unmatch is a helper method to define mock.On call
 //   - ctx context.Context
-//   - recipient_id string
-//   - actor_id string
-//   - liked bool
-//   - mutuallyLiked bool
-func (_e *Store_Expecter) PutMutualDecisions(ctx interface{}, recipient_id interface{}, actor_id interface{}, liked interface{}, mutuallyLiked interface{}) *Store_PutMutualDecisions_Call {
-	return &Store_PutMutualDecisions_Call{Call: _e.mock.On("PutMutualDecisions", ctx, recipient_id, actor_id, liked, mutuallyLiked)}
+//   - userID string
+//   - matchedUserID string
+func (_e *Store_Expecter) Unmatch(ctx interface{}, userID interface{}, matchedUserID interface{}) *Store_Unmatch_Call {
+	return &Store_Unmatch_Call{Call: _e.mock.On("Unmatch", ctx, userID, matchedUserID)}
 }
 
-func (_c *Store_PutMutualDecisions_Call) Run(run func(ctx context.Context, recipient_id string, actor_id string, liked bool, mutuallyLiked bool)) *Store_PutMutualDecisions_Call {
+func (_c *Store_Unmatch_Call) Run(run func(ctx context.Context, userID string, matchedUserID string)) *Store_Unmatch_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(bool), args[4].(bool))
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
 	})
 	return _c
 }
 
-func (_c *Store_PutMutualDecisions_Call) Return(_a0 error) *Store_PutMutualDecisions_Call {
+func (_c *Store_Unmatch_Call) Return(_a0 error) *Store_Unmatch_Call {
 	_c.Call.Return(_a0)
 	return _c
 }
 
-func (_c *Store_PutMutualDecisions_Call) RunAndReturn(run func(context.Context, string, string, bool, bool) error) *Store_PutMutualDecisions_Call {
+func (_c *Store_Unmatch_Call) RunAndReturn(run func(context.Context, string, string) error) *Store_Unmatch_Call {
 	_c.Call.Return(run)
 	return _c
 }
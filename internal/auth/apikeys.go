@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/metadata"
+	"gopkg.in/yaml.v3"
+)
+
+// APIKeyHeader is the metadata API keys are sent in
+const APIKeyHeader = "x-api-key"
+
+// APIKey is a key in an API keys file. Only the hash of the key is stored, so the file doesn't contain the keys.
+type APIKey struct {
+	// SHA256 is the hex encoded SHA-256 hash of the key
+	SHA256  string   `yaml:"sha256"`
+	Subject string   `yaml:"subject"`
+	Roles   []string `yaml:"roles"`
+}
+
+// APIKeys authenticates callers by a static key sent in the x-api-key metadata
+type APIKeys struct {
+	principals map[[sha256.Size]byte]*Principal
+}
+
+// NewAPIKeys creates an authenticator for the keys
+func NewAPIKeys(keys []APIKey) (*APIKeys, error) {
+	a := &APIKeys{
+		principals: map[[sha256.Size]byte]*Principal{},
+	}
+	for index, key := range keys {
+		decoded, err := hex.DecodeString(key.SHA256)
+		if err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("API key %d: sha256 must be a hex encoded SHA-256 hash", index)
+		}
+		if key.Subject == "" {
+			return nil, fmt.Errorf("API key %d: empty subject", index)
+		}
+		hash := [sha256.Size]byte(decoded)
+		if _, ok := a.principals[hash]; ok {
+			return nil, fmt.Errorf("API key %d: duplicate key", index)
+		}
+		a.principals[hash] = &Principal{
+			Subject: key.Subject,
+			Roles:   key.Roles,
+		}
+	}
+	return a, nil
+}
+
+// LoadAPIKeys creates an authenticator for the keys in a YAML file, which is a list of keys
+func LoadAPIKeys(file string) (*APIKeys, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	var keys []APIKey
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&keys); err != nil {
+		return nil, fmt.Errorf("invalid API keys file %s: %w", file, err)
+	}
+	return NewAPIKeys(keys)
+}
+
+func (a *APIKeys) Authenticate(_ context.Context, md metadata.MD) (*Principal, error) {
+	values := md.Get(APIKeyHeader)
+	if len(values) == 0 {
+		return nil, ErrNoCredentials
+	}
+	// Keys are looked up by their hash, so the lookup doesn't reveal anything about the keys
+	principal, ok := a.principals[sha256.Sum256([]byte(values[0]))]
+	if !ok {
+		return nil, errors.New("unknown API key")
+	}
+	return principal, nil
+}
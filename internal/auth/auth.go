@@ -0,0 +1,130 @@
+// Package auth authenticates the callers of the API, and records who they are in the context of their requests
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/neiln3121/explore-service/internal/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Roles which allow a caller to act for any user
+const (
+	// RoleService is given to other services, which act for users
+	RoleService = "service"
+	// RoleAdmin is given to operators
+	RoleAdmin = "admin"
+)
+
+// ErrNoCredentials is returned by authenticators when the request doesn't have the credentials they check
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is an authenticated caller
+type Principal struct {
+	// Subject is the ID of the user the caller is
+	Subject string
+	Roles   []string
+}
+
+// HasRole returns whether the caller has the role
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// CanActFor returns whether the caller can make requests for the user, which it can if it is the user or a service
+// or admin
+func (p *Principal) CanActFor(userID string) bool {
+	return p.Subject == userID || p.HasRole(RoleService) || p.HasRole(RoleAdmin)
+}
+
+// Authenticator checks the credentials in the metadata of a request, returning ErrNoCredentials if there aren't any
+type Authenticator interface {
+	Authenticate(ctx context.Context, md metadata.MD) (*Principal, error)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context with the authenticated caller
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the authenticated caller of the request
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// UnaryServerInterceptor rejects requests the authenticator doesn't authenticate, and adds the caller to the context
+// of those it does. Requests to the public services, such as the health service, aren't authenticated.
+func UnaryServerInterceptor(authenticator Authenticator, logger *slog.Logger, publicServices ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, info.FullMethod, authenticator, logger, publicServices)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the UnaryServerInterceptor for streams
+func StreamServerInterceptor(authenticator Authenticator, logger *slog.Logger, publicServices ...string) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), info.FullMethod, authenticator, logger, publicServices)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// serverStream is a stream with the context of its handler replaced
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate returns the context of the request with the caller, unless the method is of a public service
+func authenticate(ctx context.Context, method string, authenticator Authenticator, logger *slog.Logger, publicServices []string) (context.Context, error) {
+	for _, service := range publicServices {
+		if strings.HasPrefix(method, "/"+service+"/") {
+			return ctx, nil
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	principal, err := authenticator.Authenticate(ctx, md)
+	if err != nil {
+		if errors.Is(err, ErrNoCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "missing credentials")
+		}
+		// The reason isn't returned, so callers can't probe why their credentials were rejected
+		logger.InfoContext(ctx, "rejected credentials", "error", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+
+	ctx = logging.WithAttrs(ctx, slog.String("subject", principal.Subject))
+	return WithPrincipal(ctx, principal), nil
+}
+
+// bearerToken returns the token of the authorization header with the scheme
+func bearerToken(md metadata.MD, scheme string) (string, bool) {
+	for _, value := range md.Get("authorization") {
+		prefix, token, ok := strings.Cut(value, " ")
+		if ok && strings.EqualFold(prefix, scheme) && token != "" {
+			return token, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,356 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/neiln3121/explore-service/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func writeFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	return path
+}
+
+func hashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func Test_UnaryServerInterceptor(t *testing.T) {
+	keys, err := auth.NewAPIKeys([]auth.APIKey{
+		{SHA256: hashKey("user-key"), Subject: "user-1"},
+	})
+	require.NoError(t, err)
+	interceptor := auth.UnaryServerInterceptor(keys, slog.New(slog.NewTextHandler(io.Discard, nil)), "grpc.health.v1.Health")
+
+	testCases := []struct {
+		description       string
+		method            string
+		md                metadata.MD
+		expectedPrincipal *auth.Principal
+		expectedError     string
+	}{
+		{
+			description:       "authenticated",
+			method:            "/explore.ExploreAPI/PutDecision",
+			md:                metadata.Pairs(auth.APIKeyHeader, "user-key"),
+			expectedPrincipal: &auth.Principal{Subject: "user-1"},
+		},
+		{
+			description:   "missing credentials",
+			method:        "/explore.ExploreAPI/PutDecision",
+			expectedError: "rpc error: code = Unauthenticated desc = missing credentials",
+		},
+		{
+			description:   "invalid credentials",
+			method:        "/explore.ExploreAPI/PutDecision",
+			md:            metadata.Pairs(auth.APIKeyHeader, "other-key"),
+			expectedError: "rpc error: code = Unauthenticated desc = invalid credentials",
+		},
+		{
+			description: "public service",
+			method:      "/grpc.health.v1.Health/Check",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+			var principal *auth.Principal
+			handler := func(ctx context.Context, req any) (any, error) {
+				principal, _ = auth.FromContext(ctx)
+				return "response", nil
+			}
+
+			res, err := interceptor(ctx, "request", &grpc.UnaryServerInfo{FullMethod: tc.method}, handler)
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, "response", res)
+				assert.Equal(t, tc.expectedPrincipal, principal)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func Test_LoadAPIKeys(t *testing.T) {
+	file := writeFile(t, "keys.yaml", []byte(`
+- sha256: `+hashKey("service-key")+`
+  subject: matcher
+  roles: [service]
+`))
+
+	keys, err := auth.LoadAPIKeys(file)
+	require.NoError(t, err)
+
+	principal, err := keys.Authenticate(context.Background(), metadata.Pairs(auth.APIKeyHeader, "service-key"))
+	require.NoError(t, err)
+	assert.Equal(t, &auth.Principal{Subject: "matcher", Roles: []string{auth.RoleService}}, principal)
+	assert.True(t, principal.CanActFor("user-1"))
+
+	_, err = keys.Authenticate(context.Background(), metadata.MD{})
+	assert.ErrorIs(t, err, auth.ErrNoCredentials)
+
+	_, err = auth.NewAPIKeys([]auth.APIKey{{SHA256: "service-key", Subject: "matcher"}})
+	assert.EqualError(t, err, "API key 0: sha256 must be a hex encoded SHA-256 hash")
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func Test_JWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]any{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeInt(ecKey.X), "y": encodeInt(ecKey.Y), "alg": "ES256"},
+			{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(edPublic)},
+		},
+	})
+	require.NoError(t, err)
+	authenticator, err := auth.LoadJWT(auth.JWTConfig{
+		JWKSFile: writeFile(t, "jwks.json", jwks),
+		Issuer:   "https://issuer.example.org",
+		Audience: "explore",
+	})
+	require.NoError(t, err)
+
+	claims := func(subject string, expiresIn time.Duration, roles ...string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":   subject,
+			"iss":   "https://issuer.example.org",
+			"aud":   "explore",
+			"exp":   time.Now().Add(expiresIn).Unix(),
+			"roles": roles,
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key any, claims jwt.Claims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	testCases := []struct {
+		description       string
+		token             string
+		expectedPrincipal *auth.Principal
+		expectedError     string
+	}{
+		{
+			description:       "RSA",
+			token:             sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims("user-1", time.Minute)),
+			expectedPrincipal: &auth.Principal{Subject: "user-1"},
+		},
+		{
+			description:       "EC with roles",
+			token:             sign(jwt.SigningMethodES256, "ec", ecKey, claims("matcher", time.Minute, auth.RoleService)),
+			expectedPrincipal: &auth.Principal{Subject: "matcher", Roles: []string{auth.RoleService}},
+		},
+		{
+			description:       "Ed25519",
+			token:             sign(jwt.SigningMethodEdDSA, "ed", edKey, claims("user-1", time.Minute)),
+			expectedPrincipal: &auth.Principal{Subject: "user-1"},
+		},
+		{
+			description:   "expired",
+			token:         sign(jwt.SigningMethodES256, "ec", ecKey, claims("user-1", -time.Minute)),
+			expectedError: "token has invalid claims: token is expired",
+		},
+		{
+			description:   "signed by another key",
+			token:         sign(jwt.SigningMethodES256, "ec", otherKey, claims("user-1", time.Minute)),
+			expectedError: "token signature is invalid: crypto/ecdsa: verification error",
+		},
+		{
+			description:   "unknown key",
+			token:         sign(jwt.SigningMethodES256, "other", otherKey, claims("user-1", time.Minute)),
+			expectedError: `token is unverifiable: error while executing keyfunc: unknown key "other"`,
+		},
+		{
+			description:   "algorithm of another key type",
+			token:         sign(jwt.SigningMethodHS256, "rsa", []byte("secret"), claims("user-1", time.Minute)),
+			expectedError: "token signature is invalid: signing method HS256 is invalid",
+		},
+		{
+			description: "another issuer",
+			token: sign(jwt.SigningMethodES256, "ec", ecKey, jwt.MapClaims{
+				"sub": "user-1",
+				"iss": "https://other.example.org",
+				"aud": "explore",
+				"exp": time.Now().Add(time.Minute).Unix(),
+			}),
+			expectedError: "token has invalid claims: token has invalid issuer",
+		},
+		{
+			description:   "no subject",
+			token:         sign(jwt.SigningMethodES256, "ec", ecKey, claims("", time.Minute)),
+			expectedError: "token has no subject",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(context.Background(), metadata.Pairs("authorization", "Bearer "+tc.token))
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedPrincipal, principal)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+
+	_, err = authenticator.Authenticate(context.Background(), metadata.MD{})
+	assert.ErrorIs(t, err, auth.ErrNoCredentials)
+}
+
+// serverStream is a stream with only a context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func Test_StreamServerInterceptor(t *testing.T) {
+	keys, err := auth.NewAPIKeys([]auth.APIKey{
+		{SHA256: hashKey("user-key"), Subject: "user-1"},
+	})
+	require.NoError(t, err)
+	interceptor := auth.StreamServerInterceptor(keys, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	info := &grpc.StreamServerInfo{FullMethod: "/explore.ExploreAPI/WatchLikes"}
+
+	var principal *auth.Principal
+	handler := func(srv any, stream grpc.ServerStream) error {
+		principal, _ = auth.FromContext(stream.Context())
+		return nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth.APIKeyHeader, "user-key"))
+	err = interceptor(nil, &serverStream{ctx: ctx}, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, &auth.Principal{Subject: "user-1"}, principal)
+
+	err = interceptor(nil, &serverStream{ctx: context.Background()}, info, handler)
+	assert.EqualError(t, err, "rpc error: code = Unauthenticated desc = missing credentials")
+}
+
+// withClientCertificate returns a context with a peer which presented the certificate, as verified by mutual TLS
+func withClientCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	return peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	})
+}
+
+func Test_ClientCertificates(t *testing.T) {
+	file := writeFile(t, "identities.yaml", []byte(`
+- identity: spiffe://example.org/matcher
+  roles: [service]
+- identity: ops
+  subject: operator-1
+  roles: [admin]
+`))
+	certificates, err := auth.LoadClientCertificates(file)
+	require.NoError(t, err)
+	keys, err := auth.NewAPIKeys([]auth.APIKey{{SHA256: hashKey("user-key"), Subject: "user-1"}})
+	require.NoError(t, err)
+	authenticator := auth.FirstOf(certificates, keys)
+	spiffeID, err := url.Parse("spiffe://example.org/matcher")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		description       string
+		ctx               context.Context
+		md                metadata.MD
+		expectedPrincipal *auth.Principal
+		expectedError     error
+	}{
+		{
+			description:       "SPIFFE ID",
+			ctx:               withClientCertificate(context.Background(), &x509.Certificate{Subject: pkix.Name{CommonName: "matcher"}, URIs: []*url.URL{spiffeID}}),
+			expectedPrincipal: &auth.Principal{Subject: "spiffe://example.org/matcher", Roles: []string{auth.RoleService}},
+		},
+		{
+			description:       "common name",
+			ctx:               withClientCertificate(context.Background(), &x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}),
+			expectedPrincipal: &auth.Principal{Subject: "operator-1", Roles: []string{auth.RoleAdmin}},
+		},
+		{
+			description:       "unlisted certificate falls back to an API key",
+			ctx:               withClientCertificate(context.Background(), &x509.Certificate{Subject: pkix.Name{CommonName: "app"}}),
+			md:                metadata.Pairs(auth.APIKeyHeader, "user-key"),
+			expectedPrincipal: &auth.Principal{Subject: "user-1"},
+		},
+		{
+			description:   "unlisted certificate",
+			ctx:           withClientCertificate(context.Background(), &x509.Certificate{Subject: pkix.Name{CommonName: "app"}}),
+			expectedError: auth.ErrNoCredentials,
+		},
+		{
+			description:   "no certificate",
+			ctx:           context.Background(),
+			expectedError: auth.ErrNoCredentials,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(tc.ctx, tc.md)
+
+			if tc.expectedError == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedPrincipal, principal)
+			} else {
+				assert.ErrorIs(t, err, tc.expectedError)
+			}
+		})
+	}
+
+	_, err = auth.NewClientCertificates([]auth.ClientIdentity{{Identity: "ops"}, {Identity: "ops"}})
+	assert.EqualError(t, err, "client identity ops: duplicate identity")
+}
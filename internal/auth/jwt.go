@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+)
+
+// JWTConfig configures which tokens are accepted
+type JWTConfig struct {
+	// JWKSFile is a JSON Web Key Set of the keys tokens can be signed with
+	JWKSFile string
+	// Issuer is the iss claim tokens must have, if set
+	Issuer string
+	// Audience is the aud claim tokens must include, if set
+	Audience string
+}
+
+// JWT authenticates callers by a JSON Web Token sent as a bearer token in the authorization metadata. The subject of
+// the token is the user, and its roles claim their roles.
+type JWT struct {
+	keys   map[string]*jsonWebKey
+	parser *jwt.Parser
+}
+
+// jwtClaims are the claims of the tokens
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+// jsonWebKey is a public key from a JWKS
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	key crypto.PublicKey
+}
+
+// algorithms are the signing methods tokens can be signed with, by the type of key they are signed with
+var algorithms = map[string][]string{
+	"RSA": {"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"},
+	"EC":  {"ES256", "ES384", "ES512"},
+	"OKP": {"EdDSA"},
+}
+
+// LoadJWT creates an authenticator for tokens signed with the keys in the JWKS file
+func LoadJWT(cfg JWTConfig) (*JWT, error) {
+	content, err := os.ReadFile(cfg.JWKSFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	var set struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS %s: %w", cfg.JWKSFile, err)
+	}
+
+	keys := map[string]*jsonWebKey{}
+	var methods []string
+	for index, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		key.key, err = key.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %d: %w", index, err)
+		}
+		if _, ok := keys[key.Kid]; ok {
+			return nil, fmt.Errorf("invalid JWKS key %d: duplicate kid %q", index, key.Kid)
+		}
+		keys[key.Kid] = key
+		methods = append(methods, algorithms[key.Kty]...)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys in JWKS %s", cfg.JWKSFile)
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	return &JWT{
+		keys:   keys,
+		parser: jwt.NewParser(opts...),
+	}, nil
+}
+
+func (j *JWT) Authenticate(_ context.Context, md metadata.MD) (*Principal, error) {
+	token, ok := bearerToken(md, "Bearer")
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	var claims jwtClaims
+	_, err := j.parser.ParseWithClaims(token, &claims, j.keyFor)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return &Principal{
+		Subject: claims.Subject,
+		Roles:   claims.Roles,
+	}, nil
+}
+
+// keyFor returns the key the token must be signed with, checking its algorithm can be used with the key
+func (j *JWT) keyFor(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	alg := token.Method.Alg()
+	if key.Alg != "" && key.Alg != alg {
+		return nil, fmt.Errorf("key %q can't be used with %s", kid, alg)
+	}
+	for _, method := range algorithms[key.Kty] {
+		if method == alg {
+			return key.key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q can't be used with %s", kid, alg)
+}
+
+// publicKey decodes the public key of the JWK
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point isn't on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid x")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
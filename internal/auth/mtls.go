@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/neiln3121/explore-service/internal/tlsconfig"
+	"google.golang.org/grpc/metadata"
+	"gopkg.in/yaml.v3"
+)
+
+// ClientIdentity is a client certificate identity in a client identities file
+type ClientIdentity struct {
+	// Identity is the SPIFFE ID of the certificate, or its common name if it doesn't have one
+	Identity string `yaml:"identity"`
+	// Subject is the user the client is, the identity if not set
+	Subject string   `yaml:"subject"`
+	Roles   []string `yaml:"roles"`
+}
+
+// ClientCertificates authenticates callers by the identity of the client certificate verified by mutual TLS. Clients
+// with an identity which isn't listed are treated as having no credentials, so they can be authenticated another way.
+type ClientCertificates struct {
+	principals map[string]*Principal
+}
+
+// NewClientCertificates creates an authenticator for the identities
+func NewClientCertificates(identities []ClientIdentity) (*ClientCertificates, error) {
+	c := &ClientCertificates{
+		principals: map[string]*Principal{},
+	}
+	for index, identity := range identities {
+		if identity.Identity == "" {
+			return nil, fmt.Errorf("client identity %d: empty identity", index)
+		}
+		if _, ok := c.principals[identity.Identity]; ok {
+			return nil, fmt.Errorf("client identity %s: duplicate identity", identity.Identity)
+		}
+		subject := identity.Subject
+		if subject == "" {
+			subject = identity.Identity
+		}
+		c.principals[identity.Identity] = &Principal{
+			Subject: subject,
+			Roles:   identity.Roles,
+		}
+	}
+	return c, nil
+}
+
+// LoadClientCertificates creates an authenticator for the identities in a YAML file, which is a list of identities
+func LoadClientCertificates(file string) (*ClientCertificates, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client identities: %w", err)
+	}
+	var identities []ClientIdentity
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&identities); err != nil {
+		return nil, fmt.Errorf("invalid client identities file %s: %w", file, err)
+	}
+	return NewClientCertificates(identities)
+}
+
+func (c *ClientCertificates) Authenticate(ctx context.Context, _ metadata.MD) (*Principal, error) {
+	identity, ok := tlsconfig.ClientIdentity(ctx)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	principal, ok := c.principals[identity.Name()]
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	return principal, nil
+}
+
+// FirstOf authenticates callers with the first of the authenticators which finds credentials in the request
+func FirstOf(authenticators ...Authenticator) Authenticator {
+	return firstOf(authenticators)
+}
+
+type firstOf []Authenticator
+
+func (f firstOf) Authenticate(ctx context.Context, md metadata.MD) (*Principal, error) {
+	for _, authenticator := range f {
+		principal, err := authenticator.Authenticate(ctx, md)
+		if !errors.Is(err, ErrNoCredentials) {
+			return principal, err
+		}
+	}
+	return nil, ErrNoCredentials
+}
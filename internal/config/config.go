@@ -0,0 +1,458 @@
+// Package config loads the configuration of the server. Settings are taken from defaults, then a YAML file, then
+// environment variables and finally flags, each overriding the one before.
+//
+// Every setting has an environment variable and a flag named after its path in the file. For example database.url in
+// the file is EXPLORE_DATABASE_URL in the environment and -database.url as a flag.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/outbox"
+	"github.com/neiln3121/explore-service/internal/tracing"
+	"github.com/neiln3121/explore-service/internal/webhook"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of every environment variable setting
+const EnvPrefix = "EXPLORE_"
+
+// Ways callers can be authenticated
+const (
+	AuthNone    = "none"
+	AuthJWT     = "jwt"
+	AuthAPIKeys = "api_keys"
+	// AuthMTLS authenticates callers only by their client certificates
+	AuthMTLS = "mtls"
+)
+
+// Stores decisions can be kept in
+const (
+	StorePostgres = "postgres"
+	// StoreMemory keeps decisions in memory, they are lost when the server stops
+	StoreMemory = "memory"
+)
+
+// Config is the configuration of the server. Settings tagged as secret are redacted when printed.
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Database   Database   `yaml:"database"`
+	Pagination Pagination `yaml:"pagination"`
+	Decisions  Decisions  `yaml:"decisions"`
+	TLS        TLS        `yaml:"tls"`
+	Auth       Auth       `yaml:"auth"`
+	Tracing    Tracing    `yaml:"tracing"`
+	Outbox     Outbox     `yaml:"outbox"`
+	Webhooks   Webhooks   `yaml:"webhooks"`
+	Log        Log        `yaml:"log"`
+	Features   Features   `yaml:"features"`
+}
+
+type Server struct {
+	ListenAddress  string        `yaml:"listen_address" help:"the address the gRPC server listens on"`
+	HTTPAddress    string        `yaml:"http_address" help:"the address the API is served on over HTTP with JSON, not served if empty"`
+	MetricsAddress string        `yaml:"metrics_address" help:"the address prometheus metrics are served on at /metrics"`
+	StartupTimeout time.Duration `yaml:"startup_timeout" help:"how long to keep retrying to reach the database and run migrations before exiting"`
+	ShutdownDelay  time.Duration `yaml:"shutdown_delay" help:"how long the server keeps serving on shutdown after reporting NOT_SERVING, so load balancers stop sending it requests first"`
+	DrainTimeout   time.Duration `yaml:"drain_timeout" help:"how long requests in flight are given to finish on shutdown before they are cancelled"`
+}
+
+type Database struct {
+	Store           string        `yaml:"store" help:"where decisions are stored, postgres or memory (not persisted, for local development)"`
+	URL             string        `yaml:"url" secret:"true" help:"the postgres connection string"`
+	MaxOpenConns    int           `yaml:"max_open_conns" help:"the maximum number of open connections, 0 for no limit"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" help:"the maximum number of idle connections"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" help:"how long a connection is reused for, 0 for no limit"`
+	CheckInterval   time.Duration `yaml:"check_interval" help:"how often the database is pinged to report the health of the server"`
+}
+
+type Pagination struct {
+	Key          string `yaml:"key" secret:"true" help:"the key pagination tokens are encrypted with, random if not set"`
+	DefaultLimit uint32 `yaml:"default_limit" help:"the page size of lists requested without a limit, 0 for no limit"`
+	MaxLimit     uint32 `yaml:"max_limit" help:"the largest page size which can be requested, 0 for no limit"`
+}
+
+type Decisions struct {
+	UndoWindow               time.Duration `yaml:"undo_window" help:"how long after a decision it can be undone"`
+	IdempotencyTTL           time.Duration `yaml:"idempotency_ttl" help:"how long the result of a decision is kept for retries with its idempotency key"`
+	IdempotencyPurgeInterval time.Duration `yaml:"idempotency_purge_interval" help:"how often idempotency keys kept for longer than the TTL are removed"`
+}
+
+type TLS struct {
+	CertFile     string `yaml:"cert_file" help:"the certificate the gRPC server serves TLS with, plaintext if not set"`
+	KeyFile      string `yaml:"key_file" help:"the private key of the certificate"`
+	ClientCAFile string `yaml:"client_ca_file" help:"the CA client certificates must be signed by, clients aren't verified if not set"`
+	// The health check is run in the container of the server, so it is given a certificate for servers requiring one
+	HealthCheckCertFile string `yaml:"health_check_cert_file" help:"the client certificate -health-check presents, needed when tls.client_ca_file is set"`
+	HealthCheckKeyFile  string `yaml:"health_check_key_file" help:"the private key of the health check certificate"`
+}
+
+type Auth struct {
+	Mode                 string `yaml:"mode" help:"how callers are authenticated, none, jwt, api_keys or mtls. Authenticated callers can only make requests for themselves unless they have the service or admin role"`
+	JWKSFile             string `yaml:"jwks_file" help:"the JSON Web Key Set tokens are verified with"`
+	Issuer               string `yaml:"issuer" help:"the issuer tokens must be issued by, any issuer if not set"`
+	Audience             string `yaml:"audience" help:"the audience tokens must be issued for, any audience if not set"`
+	APIKeysFile          string `yaml:"api_keys_file" help:"the YAML file of the SHA-256 hashes of API keys, with the subject and roles of each"`
+	ClientIdentitiesFile string `yaml:"client_identities_file" help:"the YAML file of the SPIFFE IDs or common names of client certificates, with the subject and roles of each. Listed clients are authenticated by their certificate before any other credentials"`
+}
+
+type Tracing struct {
+	Exporter      string `yaml:"exporter" help:"where spans are exported, none, otlp (configured with OTEL_EXPORTER_OTLP_* variables) or stdout"`
+	File          string `yaml:"file" help:"the file the stdout exporter writes to instead of stdout"`
+	RedactUserIDs bool   `yaml:"redact_user_ids" help:"leave user IDs out of spans"`
+}
+
+type Outbox struct {
+	Publisher string        `yaml:"publisher" help:"where like, pass, match and unmatch events are published, none (dropped) or file"`
+	File      string        `yaml:"file" help:"the file the file publisher appends events to as JSON lines instead of stdout"`
+	Interval  time.Duration `yaml:"interval" help:"how often the outbox is checked for events to publish"`
+	BatchSize uint32        `yaml:"batch_size" help:"the number of events published per database transaction"`
+}
+
+type Webhooks struct {
+	SubscriptionsFile string        `yaml:"subscriptions_file" help:"the YAML file of webhook subscriptions, with the name, URL, secret and events of each, no webhooks are sent if not set"`
+	MaxAttempts       int           `yaml:"max_attempts" help:"how many times a webhook delivery is attempted before it is dead lettered"`
+	InitialBackoff    time.Duration `yaml:"initial_backoff" help:"the wait before retrying a webhook delivery the first time, doubling for each retry"`
+	MaxBackoff        time.Duration `yaml:"max_backoff" help:"the longest wait between retries of a webhook delivery"`
+	Timeout           time.Duration `yaml:"timeout" help:"how long a webhook receiver is given to respond"`
+	Interval          time.Duration `yaml:"interval" help:"how often queued webhook deliveries are checked for ones which are due"`
+}
+
+type Log struct {
+	Level string `yaml:"level" help:"the minimum level of logs written, debug, info, warn or error"`
+}
+
+// Features are parts of the API which can be turned off
+type Features struct {
+	Undo            bool `yaml:"undo" help:"serve UndoDecision"`
+	DecisionHistory bool `yaml:"decision_history" help:"serve GetDecisionHistory"`
+}
+
+// Default returns the configuration used for any setting which isn't set
+func Default() Config {
+	return Config{
+		Server: Server{
+			ListenAddress:  ":3000",
+			HTTPAddress:    ":8080",
+			MetricsAddress: ":9090",
+			StartupTimeout: 2 * time.Minute,
+			ShutdownDelay:  5 * time.Second,
+			DrainTimeout:   20 * time.Second,
+		},
+		Database: Database{
+			Store:         StorePostgres,
+			MaxOpenConns:  20,
+			MaxIdleConns:  5,
+			CheckInterval: 5 * time.Second,
+		},
+		Decisions: Decisions{
+			UndoWindow:               5 * time.Minute,
+			IdempotencyTTL:           24 * time.Hour,
+			IdempotencyPurgeInterval: 10 * time.Minute,
+		},
+		Auth: Auth{
+			Mode: AuthNone,
+		},
+		Tracing: Tracing{
+			Exporter: tracing.ExporterNone,
+		},
+		Outbox: Outbox{
+			Publisher: outbox.PublisherNone,
+			Interval:  outbox.DefaultInterval,
+			BatchSize: outbox.DefaultBatchSize,
+		},
+		Webhooks: Webhooks{
+			MaxAttempts:    webhook.DefaultMaxAttempts,
+			InitialBackoff: webhook.DefaultInitialBackoff,
+			MaxBackoff:     webhook.DefaultMaxBackoff,
+			Timeout:        webhook.DefaultTimeout,
+			Interval:       webhook.DefaultInterval,
+		},
+		Log: Log{
+			Level: "info",
+		},
+		Features: Features{
+			Undo:            true,
+			DecisionHistory: true,
+		},
+	}
+}
+
+// legacyEnv are environment variables from before settings had the prefix, applied before the prefixed variables
+var legacyEnv = map[string]string{
+	"DATABASE_URL":   "database.url",
+	"PAGINATION_KEY": "pagination.key",
+}
+
+// Load adds the settings and a -config flag for the file to the flag set, and parses the arguments with it. The flag
+// set may already have other flags, which are parsed with the settings.
+func Load(fs *flag.FlagSet, args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	fields := settings(&cfg)
+
+	file := fs.String("config", getenv(EnvPrefix+"CONFIG"), "the YAML file settings are read from (env "+EnvPrefix+"CONFIG)")
+	port := fs.Int("port", 0, "the port the gRPC server listens on, shorthand for -server.listen_address=:<port>")
+	flags := map[string]string{}
+	for _, field := range fields {
+		fs.Func(field.path, fmt.Sprintf("%s (env %s)", field.help, field.env()), func(value string) error {
+			if err := field.set(value); err != nil {
+				return err
+			}
+			flags[field.path] = value
+			return nil
+		})
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flags are parsed first to find the file, but applied last
+	cfg = Default()
+	if *file != "" {
+		content, err := os.ReadFile(*file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid config file %s: %w", *file, err)
+		}
+	}
+
+	byPath := map[string]setting{}
+	for _, field := range fields {
+		byPath[field.path] = field
+	}
+	for name, path := range legacyEnv {
+		if value := getenv(name); value != "" {
+			if err := byPath[path].set(value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	}
+	for _, field := range fields {
+		if value := getenv(field.env()); value != "" {
+			if err := field.set(value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", field.env(), err)
+			}
+		}
+	}
+	if *port != 0 {
+		cfg.Server.ListenAddress = fmt.Sprintf(":%d", *port)
+	}
+	for _, field := range fields {
+		if value, ok := flags[field.path]; ok {
+			if err := field.set(value); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", field.path, err)
+			}
+		}
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks every setting, returning all the problems found
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.ListenAddress != "", "server.listen_address must be set")
+	check(c.Server.MetricsAddress != "", "server.metrics_address must be set")
+	check(c.Server.MetricsAddress != c.Server.ListenAddress, "server.metrics_address must be different from server.listen_address")
+	check(c.Server.HTTPAddress == "" || (c.Server.HTTPAddress != c.Server.ListenAddress && c.Server.HTTPAddress != c.Server.MetricsAddress),
+		"server.http_address must be different from server.listen_address and server.metrics_address")
+	check(c.Server.StartupTimeout > 0, "server.startup_timeout must be positive")
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay must not be negative")
+	check(c.Server.DrainTimeout >= 0, "server.drain_timeout must not be negative")
+
+	switch c.Database.Store {
+	case StorePostgres:
+		check(c.Database.URL != "", "database.url must be set for the postgres store")
+	case StoreMemory:
+	default:
+		check(false, "database.store must be %s or %s, not %q", StorePostgres, StoreMemory, c.Database.Store)
+	}
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns, "database.max_idle_conns must not be more than database.max_open_conns")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.CheckInterval > 0, "database.check_interval must be positive")
+
+	check(c.Pagination.Key == "" || len(c.Pagination.Key) >= 16, "pagination.key must be at least 16 bytes")
+	check(c.Pagination.MaxLimit == 0 || c.Pagination.DefaultLimit <= c.Pagination.MaxLimit, "pagination.default_limit must not be more than pagination.max_limit")
+	check(c.Pagination.MaxLimit == 0 || c.Pagination.DefaultLimit != 0, "pagination.default_limit must be set when pagination.max_limit is set")
+
+	check(c.Decisions.UndoWindow >= 0, "decisions.undo_window must not be negative")
+	check(c.Decisions.IdempotencyTTL > 0, "decisions.idempotency_ttl must be positive")
+	check(c.Decisions.IdempotencyPurgeInterval > 0, "decisions.idempotency_purge_interval must be positive")
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	check(c.TLS.ClientCAFile == "" || c.TLS.CertFile != "", "tls.client_ca_file requires tls.cert_file")
+	check((c.TLS.HealthCheckCertFile == "") == (c.TLS.HealthCheckKeyFile == ""), "tls.health_check_cert_file and tls.health_check_key_file must be set together")
+	check(c.TLS.HealthCheckCertFile == "" || c.TLS.CertFile != "", "tls.health_check_cert_file requires tls.cert_file")
+
+	switch c.Auth.Mode {
+	case AuthNone:
+	case AuthJWT:
+		check(c.Auth.JWKSFile != "", "auth.jwks_file must be set for jwt auth")
+	case AuthAPIKeys:
+		check(c.Auth.APIKeysFile != "", "auth.api_keys_file must be set for api_keys auth")
+	case AuthMTLS:
+		check(c.Auth.ClientIdentitiesFile != "", "auth.client_identities_file must be set for mtls auth")
+	default:
+		check(false, "auth.mode must be %s, %s, %s or %s, not %q", AuthNone, AuthJWT, AuthAPIKeys, AuthMTLS, c.Auth.Mode)
+	}
+	check(c.Auth.ClientIdentitiesFile == "" || c.TLS.ClientCAFile != "", "auth.client_identities_file requires tls.client_ca_file")
+	check(c.Auth.ClientIdentitiesFile == "" || c.Auth.Mode != AuthNone, "auth.client_identities_file requires an auth.mode")
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		check(false, "tracing.exporter must be %s, %s or %s, not %q", tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout, c.Tracing.Exporter)
+	}
+	check(c.Tracing.File == "" || c.Tracing.Exporter == tracing.ExporterStdout, "tracing.file requires the stdout exporter")
+
+	switch c.Outbox.Publisher {
+	case outbox.PublisherNone, outbox.PublisherFile:
+	default:
+		check(false, "outbox.publisher must be %s or %s, not %q", outbox.PublisherNone, outbox.PublisherFile, c.Outbox.Publisher)
+	}
+	check(c.Outbox.File == "" || c.Outbox.Publisher == outbox.PublisherFile, "outbox.file requires the file publisher")
+	check(c.Outbox.Interval > 0, "outbox.interval must be positive")
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size must be positive")
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+	check(c.Webhooks.InitialBackoff > 0, "webhooks.initial_backoff must be positive")
+	check(c.Webhooks.MaxBackoff >= c.Webhooks.InitialBackoff, "webhooks.max_backoff must not be less than webhooks.initial_backoff")
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	check(c.Webhooks.Interval > 0, "webhooks.interval must be positive")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level must be debug, info, warn or error, not %q", c.Log.Level)
+
+	return errors.Join(errs...)
+}
+
+// LogLevel is the parsed log level. It is only valid once the configuration has been validated.
+func (c *Config) LogLevel() slog.Level {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(c.Log.Level))
+	return level
+}
+
+// Redacted is the configuration as YAML, with secrets which are set replaced
+func (c *Config) Redacted() string {
+	node := redact(reflect.ValueOf(*c))
+	out, _ := yaml.Marshal(node)
+	return string(out)
+}
+
+const redacted = "REDACTED"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// redact converts the value to a YAML node, replacing secrets which are set. Durations are written as strings, the
+// same way they are read.
+func redact(v reflect.Value) *yaml.Node {
+	if v.Kind() == reflect.Struct {
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			value := redact(v.Field(i))
+			if field.Tag.Get("secret") == "true" && !v.Field(i).IsZero() {
+				value = &yaml.Node{Kind: yaml.ScalarNode, Value: redacted}
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: field.Tag.Get("yaml")}, value)
+		}
+		return node
+	}
+
+	node := &yaml.Node{}
+	if v.Type() == durationType {
+		_ = node.Encode(time.Duration(v.Int()).String())
+	} else {
+		_ = node.Encode(v.Interface())
+	}
+	return node
+}
+
+// setting is a field of the configuration
+type setting struct {
+	path  string
+	help  string
+	value reflect.Value
+}
+
+// env is the environment variable of the setting
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.path, ".", "_"))
+}
+
+// set parses the value into the setting
+func (s setting) set(value string) error {
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(int64(d))
+	case s.value.Kind() == reflect.String:
+		s.value.SetString(value)
+	case s.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		s.value.SetBool(b)
+	case s.value.Kind() == reflect.Int:
+		i, err := strconv.ParseInt(value, 10, 0)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(i)
+	case s.value.Kind() == reflect.Uint32:
+		u, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		s.value.SetUint(u)
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+// settings lists the fields of the configuration, which must be a pointer to a struct of sections
+func settings(cfg *Config) []setting {
+	var fields []setting
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Tag.Get("yaml")
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			fields = append(fields, setting{
+				path:  sectionName + "." + field.Tag.Get("yaml"),
+				help:  field.Tag.Get("help"),
+				value: section.Field(j),
+			})
+		}
+	}
+	return fields
+}
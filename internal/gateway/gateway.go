@@ -0,0 +1,329 @@
+// Package gateway serves the API over HTTP with JSON, for clients which can't use gRPC. Requests go through the same
+// interceptors as gRPC requests, so they are logged, measured and authenticated the same way.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	contract "github.com/neiln3121/explore-service/explore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// OpenAPIPath is where the OpenAPI document of the routes is served
+const OpenAPIPath = "/openapi.json"
+
+// maxBodySize is the largest request body accepted
+const maxBodySize = 1 << 20
+
+// route is an HTTP route to a method of the API. Fields of the request are taken from the path, then from the JSON
+// body for routes with one, or else from the query.
+type route struct {
+	httpMethod string
+	path       string
+	summary    string
+	fullMethod string
+	body       bool
+	// request and response are the messages of the method, used for their descriptors
+	request  proto.Message
+	response proto.Message
+	call     func(ctx context.Context, req proto.Message) (proto.Message, error)
+}
+
+func newRoute[Req, Res proto.Message](httpMethod, path, summary, fullMethod string, body bool, call func(context.Context, Req) (Res, error)) route {
+	var req Req
+	var res Res
+	return route{
+		httpMethod: httpMethod,
+		path:       path,
+		summary:    summary,
+		fullMethod: fullMethod,
+		body:       body,
+		request:    req.ProtoReflect().Type().Zero().Interface(),
+		response:   res.ProtoReflect().Type().Zero().Interface(),
+		call: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return call(ctx, req.(Req))
+		},
+	}
+}
+
+// routes maps the methods of the API to HTTP routes
+func routes(api contract.ExploreAPIServer) []route {
+	return []route{
+		newRoute("GET", "/v1/users/{recipient_user_id}/liked-you", "List all users who liked the recipient",
+			contract.ExploreAPI_ListLikedYou_FullMethodName, false, api.ListLikedYou),
+		newRoute("GET", "/v1/users/{recipient_user_id}/liked-you/new", "List all users who liked the recipient excluding those who have been liked in return",
+			contract.ExploreAPI_ListNewLikedYou_FullMethodName, false, api.ListNewLikedYou),
+		newRoute("GET", "/v1/users/{recipient_user_id}/liked-you/count", "Count the number of users who liked the recipient",
+			contract.ExploreAPI_CountLikedYou_FullMethodName, false, api.CountLikedYou),
+		newRoute("PUT", "/v1/users/{actor_user_id}/decisions/{recipient_user_id}", "Record the decision of the actor to like or pass the recipient",
+			contract.ExploreAPI_PutDecision_FullMethodName, true, api.PutDecision),
+		newRoute("POST", "/v1/users/{actor_user_id}/decisions/batch", "Record up to 100 decisions of the actor in order, with the result of each",
+			contract.ExploreAPI_BatchPutDecisions_FullMethodName, true, api.BatchPutDecisions),
+		newRoute("POST", "/v1/users/{actor_user_id}/decisions/{recipient_user_id}/undo", "Revert the last decision of the actor for the recipient if it was made within the undo window",
+			contract.ExploreAPI_UndoDecision_FullMethodName, true, api.UndoDecision),
+		newRoute("GET", "/v1/users/{actor_user_id}/decisions/history", "List every change to the decisions of the actor, oldest first",
+			contract.ExploreAPI_GetDecisionHistory_FullMethodName, false, api.GetDecisionHistory),
+		newRoute("GET", "/v1/users/{user_id}/matches", "List all users who the user has mutually liked",
+			contract.ExploreAPI_ListMatches_FullMethodName, false, api.ListMatches),
+		newRoute("DELETE", "/v1/users/{user_id}/matches/{matched_user_id}", "End the match between the user and a matched user",
+			contract.ExploreAPI_Unmatch_FullMethodName, false, api.Unmatch),
+		newRoute("PUT", "/v1/users/{blocker_user_id}/blocks/{blocked_user_id}", "Hide the blocked user from all lists and counts of the blocker, and end any match between them",
+			contract.ExploreAPI_BlockUser_FullMethodName, false, api.BlockUser),
+		newRoute("DELETE", "/v1/users/{blocker_user_id}/blocks/{blocked_user_id}", "Remove a block",
+			contract.ExploreAPI_UnblockUser_FullMethodName, false, api.UnblockUser),
+		newRoute("POST", "/v1/admin/webhooks/replay", "Retry webhook deliveries which failed every attempt, requires the admin role",
+			contract.ExploreAPI_ReplayWebhookDeliveries_FullMethodName, true, api.ReplayWebhookDeliveries),
+	}
+}
+
+var (
+	marshaler = protojson.MarshalOptions{
+		UseProtoNames:   true,
+		EmitUnpopulated: true,
+	}
+	unmarshaler = protojson.UnmarshalOptions{}
+)
+
+// New creates a handler serving the API, calling it through the interceptors in order
+func New(api contract.ExploreAPIServer, interceptors ...grpc.UnaryServerInterceptor) http.Handler {
+	mux := http.NewServeMux()
+	routes := routes(api)
+	for _, r := range routes {
+		mux.Handle(r.httpMethod+" "+r.path, &handler{route: r, interceptors: interceptors})
+	}
+
+	document := openAPI(routes)
+	mux.HandleFunc("GET "+OpenAPIPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(document)
+	})
+	return mux
+}
+
+// handler serves a route
+type handler struct {
+	route        route
+	interceptors []grpc.UnaryServerInterceptor
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := h.route.request.ProtoReflect().New().Interface()
+	if err := h.bind(w, r, req); err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	// Headers are passed on as metadata, so credentials and request IDs are read the same way as from gRPC requests
+	md := metadata.MD{}
+	for name, values := range r.Header {
+		md.Append(strings.ToLower(name), values...)
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	// The peer has the TLS state, so the verified client certificate is read the same way as from gRPC requests
+	p := &peer.Peer{}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		p.Addr = addr
+	}
+	if r.TLS != nil {
+		p.AuthInfo = credentials.TLSInfo{
+			State:          *r.TLS,
+			CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+		}
+	}
+	if p.Addr != nil || p.AuthInfo != nil {
+		ctx = peer.NewContext(ctx, p)
+	}
+	stream := &transportStream{method: h.route.fullMethod, header: w.Header()}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+
+	info := &grpc.UnaryServerInfo{FullMethod: h.route.fullMethod}
+	res, err := chain(h.interceptors, info, func(ctx context.Context, req any) (any, error) {
+		return h.route.call(ctx, req.(proto.Message))
+	})(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	body, err := marshaler.Marshal(res.(proto.Message))
+	if err != nil {
+		writeError(w, status.Error(codes.Internal, fmt.Sprintf("failed to encode response, %s", err)))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// bind sets the fields of the request from the path, and the body or the query
+func (h *handler) bind(w http.ResponseWriter, r *http.Request, req proto.Message) error {
+	if h.route.body {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			return fmt.Errorf("failed to read body: %w", err)
+		}
+		if len(body) > 0 {
+			if err := unmarshaler.Unmarshal(body, req); err != nil {
+				return fmt.Errorf("invalid body: %w", err)
+			}
+		}
+	} else {
+		for name, values := range r.URL.Query() {
+			if err := setField(req, name, values[len(values)-1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Fields in the path take precedence, so the body can't change who the request is for
+	for _, name := range pathParams(h.route.path) {
+		if err := setField(req, name, r.PathValue(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathParams returns the names of the wildcards in the path
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}"))
+		}
+	}
+	return names
+}
+
+// setField parses the value into the field of the request with the name
+func setField(req proto.Message, name, value string) error {
+	message := req.ProtoReflect()
+	field := message.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if field == nil {
+		field = message.Descriptor().Fields().ByJSONName(name)
+	}
+	if field == nil || field.IsList() || field.IsMap() {
+		return fmt.Errorf("unknown parameter %s", name)
+	}
+
+	var v protoreflect.Value
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(value)
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", name, value)
+		}
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Uint32Kind:
+		u, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", name, value)
+		}
+		v = protoreflect.ValueOfUint32(uint32(u))
+	case protoreflect.Uint64Kind:
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", name, value)
+		}
+		v = protoreflect.ValueOfUint64(u)
+	case protoreflect.EnumKind:
+		enum := field.Enum().Values().ByName(protoreflect.Name(value))
+		if enum == nil {
+			return fmt.Errorf("invalid %s: %s", name, value)
+		}
+		v = protoreflect.ValueOfEnum(enum.Number())
+	default:
+		return fmt.Errorf("unsupported parameter %s", name)
+	}
+	message.Set(field, v)
+	return nil
+}
+
+// chain calls the interceptors in order before the handler, the same way a gRPC server does
+func chain(interceptors []grpc.UnaryServerInterceptor, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) grpc.UnaryHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req any) (any, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler
+}
+
+// transportStream writes headers set by the interceptors and handlers as response headers
+type transportStream struct {
+	method string
+	header http.Header
+}
+
+func (s *transportStream) Method() string {
+	return s.method
+}
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	for name, values := range md {
+		for _, value := range values {
+			s.header.Add(name, value)
+		}
+	}
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *transportStream) SetTrailer(metadata.MD) error {
+	return errors.New("trailers aren't supported over HTTP")
+}
+
+// httpStatuses are the HTTP statuses of gRPC codes, any other code is a 500
+var httpStatuses = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatus returns the HTTP status of a gRPC code
+func HTTPStatus(code codes.Code) int {
+	if httpStatus, ok := httpStatuses[code]; ok {
+		return httpStatus
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError writes the status of the error as a google.rpc.Status
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	body, _ := protojson.Marshal(st.Proto())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatus(st.Code()))
+	_, _ = w.Write(body)
+}
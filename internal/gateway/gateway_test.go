@@ -0,0 +1,239 @@
+package gateway_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neiln3121/explore-service/internal/api"
+	"github.com/neiln3121/explore-service/internal/auth"
+	"github.com/neiln3121/explore-service/internal/gateway"
+	"github.com/neiln3121/explore-service/internal/logging"
+	"github.com/neiln3121/explore-service/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+type response struct {
+	status int
+	header http.Header
+	body   map[string]any
+}
+
+func do(t *testing.T, handler http.Handler, method, target, body string, header http.Header) response {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &decoded), rec.Body.String())
+	return response{
+		status: rec.Code,
+		header: rec.Header(),
+		body:   decoded,
+	}
+}
+
+func Test_Gateway(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := gateway.New(api.New(memory.New(), api.WithPaginationKey([]byte("test-pagination-key"))), logging.UnaryServerInterceptor(logger))
+
+	res := do(t, handler, "PUT", "/v1/users/1/decisions/2", `{"liked_recipient": true}`, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, map[string]any{"mutual_likes": false, "outcome": "DECISION_OUTCOME_NO_COUNTERPART_DECISION"}, res.body)
+	// The request ID set by the logging interceptor is returned as a header
+	assert.NotEmpty(t, res.header.Get(logging.RequestIDHeader))
+
+	res = do(t, handler, "PUT", "/v1/users/3/decisions/2", `{"likedRecipient": true}`, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+
+	res = do(t, handler, "PUT", "/v1/users/2/decisions/1", `{"liked_recipient": true}`, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, map[string]any{"mutual_likes": true, "outcome": "DECISION_OUTCOME_MATCH"}, res.body)
+
+	res = do(t, handler, "GET", "/v1/users/2/liked-you/count", "", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	// 64 bit integers are strings in JSON
+	assert.Equal(t, map[string]any{"count": "2"}, res.body)
+
+	t.Run("pagination", func(t *testing.T) {
+		res := do(t, handler, "GET", "/v1/users/2/liked-you?pagination_limit=1&sort=SORT_UPDATED_AT", "", nil)
+		require.Equal(t, http.StatusOK, res.status)
+		likers := res.body["likers"].([]any)
+		require.Len(t, likers, 1)
+		// 2 liking 1 back to match doesn't move the like of 1 above the later like of 3
+		assert.Equal(t, "3", likers[0].(map[string]any)["actor_id"])
+		token := res.body["next_pagination_token"].(string)
+
+		res = do(t, handler, "GET", "/v1/users/2/liked-you?pagination_limit=1&sort=SORT_UPDATED_AT&pagination_token="+token, "", nil)
+		require.Equal(t, http.StatusOK, res.status)
+		likers = res.body["likers"].([]any)
+		require.Len(t, likers, 1)
+		assert.Equal(t, "1", likers[0].(map[string]any)["actor_id"])
+
+		// The token was issued for the list sorted by updated_at
+		res = do(t, handler, "GET", "/v1/users/2/liked-you?pagination_token="+token, "", nil)
+		assert.Equal(t, http.StatusBadRequest, res.status)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		res := do(t, handler, "POST", "/v1/users/4/decisions/batch", `{"decisions": [{"recipient_user_id": "1", "liked_recipient": true}, {"recipient_user_id": "4"}]}`, nil)
+		assert.Equal(t, http.StatusOK, res.status)
+		assert.Equal(t, []any{
+			map[string]any{"mutual_likes": false, "outcome": "DECISION_OUTCOME_NO_COUNTERPART_DECISION", "code": float64(codes.OK), "message": ""},
+			map[string]any{"mutual_likes": false, "outcome": "DECISION_OUTCOME_UNSPECIFIED", "code": float64(codes.InvalidArgument), "message": "user IDs must be different"},
+		}, res.body["results"])
+	})
+
+	t.Run("empty lists are returned", func(t *testing.T) {
+		res := do(t, handler, "GET", "/v1/users/1/decisions/history?recipient_user_id=4", "", nil)
+		assert.Equal(t, http.StatusOK, res.status)
+		assert.Equal(t, []any{}, res.body["events"])
+	})
+
+	errorCases := []struct {
+		description     string
+		method          string
+		target          string
+		body            string
+		expectedStatus  int
+		expectedCode    codes.Code
+		expectedMessage string
+	}{
+		{
+			description:     "unknown query parameter",
+			method:          "GET",
+			target:          "/v1/users/2/liked-you?limit=1",
+			expectedStatus:  http.StatusBadRequest,
+			expectedCode:    codes.InvalidArgument,
+			expectedMessage: "unknown parameter limit",
+		},
+		{
+			description:     "invalid query parameter",
+			method:          "GET",
+			target:          "/v1/users/2/liked-you?pagination_limit=many",
+			expectedStatus:  http.StatusBadRequest,
+			expectedCode:    codes.InvalidArgument,
+			expectedMessage: "invalid pagination_limit: many",
+		},
+		{
+			description:     "invalid body",
+			method:          "PUT",
+			target:          "/v1/users/1/decisions/2",
+			body:            `{"liked": true}`,
+			expectedStatus:  http.StatusBadRequest,
+			expectedCode:    codes.InvalidArgument,
+			expectedMessage: `invalid body: proto: (line 1:2): unknown field "liked"`,
+		},
+		{
+			description:     "invalid request",
+			method:          "PUT",
+			target:          "/v1/users/1/blocks/1",
+			expectedStatus:  http.StatusBadRequest,
+			expectedCode:    codes.InvalidArgument,
+			expectedMessage: "user IDs must be different",
+		},
+		{
+			description:     "not found",
+			method:          "POST",
+			target:          "/v1/users/5/decisions/6/undo",
+			expectedStatus:  http.StatusNotFound,
+			expectedCode:    codes.NotFound,
+			expectedMessage: "no decision to undo",
+		},
+	}
+
+	for _, tc := range errorCases {
+		t.Run(tc.description, func(t *testing.T) {
+			res := do(t, handler, tc.method, tc.target, tc.body, nil)
+
+			assert.Equal(t, tc.expectedStatus, res.status)
+			assert.Equal(t, float64(tc.expectedCode), res.body["code"])
+			// protojson errors randomly use non-breaking spaces, so they aren't relied on
+			assert.Equal(t, tc.expectedMessage, strings.ReplaceAll(res.body["message"].(string), "\u00a0", " "))
+		})
+	}
+}
+
+func Test_GatewayAuthentication(t *testing.T) {
+	hash := sha256.Sum256([]byte("user-key"))
+	keys, err := auth.NewAPIKeys([]auth.APIKey{{SHA256: hex.EncodeToString(hash[:]), Subject: "1"}})
+	require.NoError(t, err)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := gateway.New(
+		api.New(memory.New(), api.WithAuthorization()),
+		auth.UnaryServerInterceptor(keys, logger),
+	)
+
+	testCases := []struct {
+		description    string
+		target         string
+		header         http.Header
+		expectedStatus int
+	}{
+		{
+			description:    "authenticated",
+			target:         "/v1/users/1/matches",
+			header:         http.Header{"X-Api-Key": {"user-key"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "missing credentials",
+			target:         "/v1/users/1/matches",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			description:    "another user",
+			target:         "/v1/users/2/matches",
+			header:         http.Header{"X-Api-Key": {"user-key"}},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			res := do(t, handler, "GET", tc.target, "", tc.header)
+
+			assert.Equal(t, tc.expectedStatus, res.status)
+		})
+	}
+}
+
+func Test_OpenAPI(t *testing.T) {
+	handler := gateway.New(api.New(memory.New()))
+
+	res := do(t, handler, "GET", gateway.OpenAPIPath, "", nil)
+
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "3.0.3", res.body["openapi"])
+	paths := res.body["paths"].(map[string]any)
+	assert.Len(t, paths, 11)
+
+	listLikedYou := paths["/v1/users/{recipient_user_id}/liked-you"].(map[string]any)["get"].(map[string]any)
+	assert.Equal(t, "ListLikedYou", listLikedYou["operationId"])
+	var parameters []string
+	for _, parameter := range listLikedYou["parameters"].([]any) {
+		parameter := parameter.(map[string]any)
+		parameters = append(parameters, parameter["in"].(string)+":"+parameter["name"].(string))
+	}
+	assert.Equal(t, []string{"path:recipient_user_id", "query:pagination_token", "query:pagination_limit", "query:sort"}, parameters)
+
+	schemas := res.body["components"].(map[string]any)["schemas"].(map[string]any)
+	assert.Contains(t, schemas, "explore.ListLikedYouResponse.Liker")
+}
+
+func Test_HTTPStatus(t *testing.T) {
+	assert.Equal(t, http.StatusServiceUnavailable, gateway.HTTPStatus(codes.Unavailable))
+	assert.Equal(t, http.StatusInternalServerError, gateway.HTTPStatus(codes.DataLoss))
+}
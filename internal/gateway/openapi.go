@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	contract "github.com/neiln3121/explore-service/explore"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// openAPI generates the OpenAPI document of the routes from the descriptors of their messages
+func openAPI(routes []route) []byte {
+	schemas := map[string]any{
+		"Status": map[string]any{
+			"type":        "object",
+			"description": "A google.rpc.Status, returned for any error",
+			"properties": map[string]any{
+				"code":    map[string]any{"type": "integer", "format": "int32", "description": "The gRPC status code"},
+				"message": map[string]any{"type": "string"},
+				"details": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+			},
+		},
+	}
+	paths := map[string]any{}
+	for _, r := range routes {
+		request := r.request.ProtoReflect().Descriptor()
+		response := r.response.ProtoReflect().Descriptor()
+		addSchema(schemas, response)
+
+		inPath := pathParams(r.path)
+		var parameters []any
+		for _, name := range inPath {
+			parameters = append(parameters, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+
+		// Fields which aren't in the path are in the body or the query
+		body := map[string]any{}
+		fields := request.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			field := fields.Get(i)
+			name := string(field.Name())
+			if slices.Contains(inPath, name) {
+				continue
+			}
+			if r.body {
+				body[name] = fieldSchema(schemas, field)
+				continue
+			}
+			parameters = append(parameters, map[string]any{
+				"name":   name,
+				"in":     "query",
+				"schema": fieldSchema(schemas, field),
+			})
+		}
+
+		operation := map[string]any{
+			"operationId": r.fullMethod[strings.LastIndex(r.fullMethod, "/")+1:],
+			"summary":     r.summary,
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": ref(response)},
+					},
+				},
+				"default": map[string]any{
+					"description": "An error",
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Status"}},
+					},
+				},
+			},
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		if r.body {
+			operation["requestBody"] = map[string]any{
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": map[string]any{"type": "object", "properties": body},
+					},
+				},
+			}
+		}
+
+		path, ok := paths[r.path].(map[string]any)
+		if !ok {
+			path = map[string]any{}
+			paths[r.path] = path
+		}
+		path[strings.ToLower(r.httpMethod)] = operation
+	}
+
+	document, err := json.MarshalIndent(map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   contract.ExploreAPI_ServiceDesc.ServiceName,
+			"version": "v1",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+		},
+	}, "", "  ")
+	if err != nil {
+		// The document is only made of maps, slices and strings
+		panic(err)
+	}
+	return document
+}
+
+func ref(message protoreflect.MessageDescriptor) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + string(message.FullName())}
+}
+
+// addSchema adds the schema of the message, and of the messages it contains, to the schemas
+func addSchema(schemas map[string]any, message protoreflect.MessageDescriptor) {
+	name := string(message.FullName())
+	if _, ok := schemas[name]; ok {
+		return
+	}
+	properties := map[string]any{}
+	schema := map[string]any{"type": "object", "properties": properties}
+	// The schema is added before its fields, so messages containing themselves don't recurse forever
+	schemas[name] = schema
+
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		properties[string(field.Name())] = fieldSchema(schemas, field)
+	}
+}
+
+// fieldSchema returns the schema of the field as it is encoded in JSON
+func fieldSchema(schemas map[string]any, field protoreflect.FieldDescriptor) map[string]any {
+	var schema map[string]any
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		schema = map[string]any{"type": "string"}
+	case protoreflect.BoolKind:
+		schema = map[string]any{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		schema = map[string]any{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		schema = map[string]any{"type": "integer", "format": "uint32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		// 64 bit integers are encoded as strings in JSON, as they don't fit in a JavaScript number
+		schema = map[string]any{"type": "string", "format": "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		schema = map[string]any{"type": "string", "format": "uint64"}
+	case protoreflect.EnumKind:
+		var values []string
+		for i := 0; i < field.Enum().Values().Len(); i++ {
+			values = append(values, string(field.Enum().Values().Get(i).Name()))
+		}
+		schema = map[string]any{"type": "string", "enum": values}
+	case protoreflect.MessageKind:
+		addSchema(schemas, field.Message())
+		schema = ref(field.Message())
+	default:
+		schema = map[string]any{}
+	}
+
+	if field.IsList() {
+		return map[string]any{"type": "array", "items": schema}
+	}
+	return schema
+}
@@ -0,0 +1,123 @@
+// Package health reports whether the server can serve requests through the standard gRPC health service, based on
+// whether the database can be reached
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Pinger checks the database can be reached. It is implemented by *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Monitor pings the database periodically, and sets the services it monitors to NOT_SERVING while it can't be reached
+type Monitor struct {
+	db       Pinger
+	server   *health.Server
+	interval time.Duration
+	services []string
+	logger   *slog.Logger
+}
+
+// NewMonitor creates a monitor pinging the database every interval and setting the status of the services. The empty
+// service name is the status of the whole server.
+func NewMonitor(db Pinger, server *health.Server, interval time.Duration, logger *slog.Logger, services ...string) *Monitor {
+	return &Monitor{
+		db:       db,
+		server:   server,
+		interval: interval,
+		services: services,
+		logger:   logger,
+	}
+}
+
+// Run checks the database until the context is done, starting straight away
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	serving := false
+	for {
+		// A ping taking longer than the interval counts as a failure, so checks don't back up
+		pingCtx, cancel := context.WithTimeout(ctx, m.interval)
+		err := m.db.PingContext(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil && serving {
+			m.logger.Error("database unreachable, not serving", "error", err)
+		} else if err == nil && !serving {
+			m.logger.Info("database reachable, serving")
+		}
+		serving = err == nil
+		m.SetServing(serving)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetServing sets the status of every monitored service
+func (m *Monitor) SetServing(serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	for _, service := range m.services {
+		m.server.SetServingStatus(service, status)
+	}
+}
+
+// Retry calls fn until it succeeds or the context is done, waiting between attempts for a delay which starts at
+// initial and doubles up to max. It returns the last error if the context is done first.
+func Retry(ctx context.Context, initial, max time.Duration, logger *slog.Logger, fn func(ctx context.Context) error) error {
+	delay := initial
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		logger.Warn("startup attempt failed, retrying", "attempt", attempt, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, max)
+	}
+}
+
+// Check asks the server at the address for the status of the whole server, over TLS if the TLS configuration isn't nil
+func Check(ctx context.Context, address string, tlsConfig *tls.Config) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	defer conn.Close()
+
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	return res.Status, nil
+}
@@ -0,0 +1,93 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// pinger fails while down is set
+type pinger struct {
+	down atomic.Bool
+}
+
+func (p *pinger) PingContext(ctx context.Context) error {
+	if p.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func Test_Monitor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := grpchealth.NewServer()
+	server.SetServingStatus("explore.ExploreAPI", healthpb.HealthCheckResponse_NOT_SERVING)
+	db := &pinger{}
+
+	monitor := health.NewMonitor(db, server, time.Millisecond, testLogger, "", "explore.ExploreAPI")
+	done := make(chan struct{})
+	go func() {
+		monitor.Run(ctx)
+		close(done)
+	}()
+
+	status := func() healthpb.HealthCheckResponse_ServingStatus {
+		res, err := server.Check(ctx, &healthpb.HealthCheckRequest{Service: "explore.ExploreAPI"})
+		require.NoError(t, err)
+		return res.Status
+	}
+
+	assert.Eventually(t, func() bool { return status() == healthpb.HealthCheckResponse_SERVING }, time.Second, time.Millisecond)
+
+	db.down.Store(true)
+	assert.Eventually(t, func() bool { return status() == healthpb.HealthCheckResponse_NOT_SERVING }, time.Second, time.Millisecond)
+
+	db.down.Store(false)
+	assert.Eventually(t, func() bool { return status() == healthpb.HealthCheckResponse_SERVING }, time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("monitor didn't stop")
+	}
+}
+
+func Test_Retry(t *testing.T) {
+	t.Run("succeeds after failures", func(t *testing.T) {
+		attempts := 0
+		err := health.Retry(context.Background(), time.Millisecond, 2*time.Millisecond, testLogger, func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("not yet")
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		err := health.Retry(ctx, time.Millisecond, 5*time.Millisecond, testLogger, func(ctx context.Context) error {
+			return errors.New("connection refused")
+		})
+		assert.EqualError(t, err, "connection refused")
+	})
+}
@@ -0,0 +1,137 @@
+// Package logging writes structured JSON logs, with fields scoped to the request being handled
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader is the metadata key of the request ID. A request ID sent by the client is used instead of generating one.
+const RequestIDHeader = "x-request-id"
+
+type attrsKey struct{}
+
+// NewLogger creates a logger writing JSON lines at the level and above. Every line includes the fields added to the
+// context it was logged with.
+func NewLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(&contextHandler{
+		Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}),
+	})
+}
+
+// WithAttrs returns a context which adds the fields to every line logged with it
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, attrsKey{}, append(existing[:len(existing):len(existing)], attrs...))
+}
+
+// contextHandler adds the fields of the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// UnaryServerInterceptor adds the method, peer and request ID to every line logged while handling a request, and logs
+// the outcome and duration of every request
+func UnaryServerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx = requestContext(ctx, info.FullMethod)
+
+		res, err := handler(ctx, req)
+
+		logHandled(ctx, logger, start, err)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor is the UnaryServerInterceptor for streams, logging the outcome and duration of every stream
+// once it ends
+func StreamServerInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := requestContext(stream.Context(), info.FullMethod)
+
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+
+		logHandled(ctx, logger, start, err)
+		return err
+	}
+}
+
+// serverStream is a stream with the context of its handler replaced
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// requestContext returns the context of the request with the fields of the request, and returns the request ID to
+// the client
+func requestContext(ctx context.Context, method string) context.Context {
+	id := requestID(ctx)
+	// The request ID is returned so clients can refer to the request's logs
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("request_id", id),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("peer", p.Addr.String()))
+	}
+	return WithAttrs(ctx, attrs...)
+}
+
+// logHandled logs the outcome and duration of a request which started at start
+func logHandled(ctx context.Context, logger *slog.Logger, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	}
+	logger.LogAttrs(ctx, level, "request handled",
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
+
+// requestID returns the request ID sent by the client, or a new one
+func requestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDHeader); len(ids) > 0 && ids[0] != "" {
+			return ids[0]
+		}
+	}
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
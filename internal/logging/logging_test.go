@@ -0,0 +1,111 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/neiln3121/explore-service/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func Test_UnaryServerInterceptor(t *testing.T) {
+	testCases := []struct {
+		description       string
+		metadata          metadata.MD
+		handlerError      error
+		expectedRequestID string
+		expectedLevel     string
+		expectedCode      string
+	}{
+		{
+			description:   "generated request ID",
+			expectedLevel: "INFO",
+			expectedCode:  "OK",
+		},
+		{
+			description:       "client request ID",
+			metadata:          metadata.Pairs(logging.RequestIDHeader, "request-1"),
+			expectedRequestID: "request-1",
+			expectedLevel:     "INFO",
+			expectedCode:      "OK",
+		},
+		{
+			description:   "client error",
+			handlerError:  status.Error(codes.InvalidArgument, "empty recipient ID"),
+			expectedLevel: "INFO",
+			expectedCode:  "InvalidArgument",
+		},
+		{
+			description:   "server error",
+			handlerError:  status.Error(codes.Internal, "db error"),
+			expectedLevel: "ERROR",
+			expectedCode:  "Internal",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := logging.NewLogger(&buf, slog.LevelInfo)
+			interceptor := logging.UnaryServerInterceptor(logger)
+
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}})
+			if tc.metadata != nil {
+				ctx = metadata.NewIncomingContext(ctx, tc.metadata)
+			}
+			info := &grpc.UnaryServerInfo{FullMethod: "/explore.ExploreAPI/PutDecision"}
+
+			_, err := interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+				// Lines logged by the handler have the fields of the request
+				logger.InfoContext(ctx, "handling")
+				return nil, tc.handlerError
+			})
+			assert.Equal(t, tc.handlerError, err)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			require.Len(t, lines, 2)
+
+			var handling, handled map[string]any
+			require.NoError(t, json.Unmarshal([]byte(lines[0]), &handling))
+			require.NoError(t, json.Unmarshal([]byte(lines[1]), &handled))
+
+			requestID, _ := handled["request_id"].(string)
+			assert.NotEmpty(t, requestID)
+			if tc.expectedRequestID != "" {
+				assert.Equal(t, tc.expectedRequestID, requestID)
+			}
+
+			for _, line := range []map[string]any{handling, handled} {
+				assert.Equal(t, "/explore.ExploreAPI/PutDecision", line["method"])
+				assert.Equal(t, "127.0.0.1:1234", line["peer"])
+				assert.Equal(t, requestID, line["request_id"])
+			}
+			assert.Equal(t, "request handled", handled["msg"])
+			assert.Equal(t, tc.expectedLevel, handled["level"])
+			assert.Equal(t, tc.expectedCode, handled["code"])
+			assert.Contains(t, handled, "duration")
+		})
+	}
+}
+
+func Test_NewLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.NewLogger(&buf, slog.LevelWarn)
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "shown")
+}
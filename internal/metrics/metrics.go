@@ -0,0 +1,72 @@
+// Package metrics records prometheus metrics for the gRPC server and the storage behind it
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics holds the collectors for the server. They are registered with the registerer given to New.
+type Metrics struct {
+	handlingSeconds *prometheus.HistogramVec
+	handledTotal    *prometheus.CounterVec
+	querySeconds    *prometheus.HistogramVec
+}
+
+func New(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		handlingSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Time taken to handle gRPC requests, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"grpc_method"}),
+		handledTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Number of gRPC requests handled, by method and status code.",
+		}, []string{"grpc_method", "grpc_code"}),
+		querySeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "storage_query_duration_seconds",
+			Help:    "Time taken by storage queries, by query and whether they failed.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"query", "result"}),
+	}
+	registerer.MustRegister(m.handlingSeconds, m.handledTotal, m.querySeconds)
+	return m
+}
+
+// UnaryServerInterceptor records the time taken and the status code of every unary request
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+
+		m.handlingSeconds.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		m.handledTotal.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		return res, err
+	}
+}
+
+// StreamServerInterceptor records the time taken and the status code of every stream, once it ends
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+
+		m.handlingSeconds.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		m.handledTotal.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		return err
+	}
+}
+
+// ObserveQuery records the time taken by a storage query which started at start
+func (m *Metrics) ObserveQuery(query string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.querySeconds.WithLabelValues(query, result).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,137 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/api/mocks"
+	"github.com/neiln3121/explore-service/internal/metrics"
+	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/storage/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_UnaryServerInterceptor(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	interceptor := metrics.New(registry).UnaryServerInterceptor()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/explore.ExploreAPI/PutDecision"}
+	for _, err := range []error{nil, nil, status.Error(codes.InvalidArgument, "invalid")} {
+		_, _ = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			return nil, err
+		})
+	}
+
+	expected := `
+# HELP grpc_server_handled_total Number of gRPC requests handled, by method and status code.
+# TYPE grpc_server_handled_total counter
+grpc_server_handled_total{grpc_code="InvalidArgument",grpc_method="/explore.ExploreAPI/PutDecision"} 1
+grpc_server_handled_total{grpc_code="OK",grpc_method="/explore.ExploreAPI/PutDecision"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "grpc_server_handled_total"))
+
+	count, err := testutil.GatherAndCount(registry, "grpc_server_handling_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func Test_InstrumentStore(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+
+	store := mocks.NewStore(t)
+	store.EXPECT().BlockUser(ctx, "1", "2").Return(nil).Once()
+	store.EXPECT().Unmatch(ctx, "1", "2").Return(errors.New("db error")).Once()
+
+	instrumented := metrics.New(registry).InstrumentStore(store)
+	assert.NoError(t, instrumented.BlockUser(ctx, "1", "2"))
+	assert.EqualError(t, instrumented.Unmatch(ctx, "1", "2"), "db error")
+
+	assert.Equal(t, map[string]uint64{"BlockUser ok": 1, "Unmatch error": 1}, observedQueries(t, registry))
+}
+
+func Test_InstrumentStoreOutbox(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	m := metrics.New(registry)
+	publish := func(context.Context, *storage.OutboxEvent) error { return nil }
+
+	store := memory.New()
+	_, err := store.RecordDecision(ctx, "1", "2", true)
+	require.NoError(t, err)
+	relayed, err := m.InstrumentStore(store).RelayOutbox(ctx, 10, publish)
+	require.NoError(t, err)
+	assert.Equal(t, 1, relayed)
+
+	// A store without an outbox has nothing to relay
+	_, err = m.InstrumentStore(mocks.NewStore(t)).RelayOutbox(ctx, 10, publish)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	assert.Equal(t, map[string]uint64{"RelayOutbox ok": 1}, observedQueries(t, registry))
+}
+
+func Test_InstrumentStoreWebhooks(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	m := metrics.New(registry)
+
+	instrumented := m.InstrumentStore(memory.New())
+	err := instrumented.AddWebhookDeliveries(ctx, []string{"partner"}, &storage.OutboxEvent{ID: 1, Type: storage.OutboxMatchCreated})
+	require.NoError(t, err)
+	delivery, err := instrumented.ClaimWebhookDelivery(ctx, "partner", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, delivery)
+	assert.ErrorIs(t, instrumented.DeleteDeadLetter(ctx, 1), storage.ErrDeadLetterNotFound)
+
+	// A store without webhook deliveries can't queue them
+	_, err = m.InstrumentStore(mocks.NewStore(t)).ClaimWebhookDelivery(ctx, "partner", time.Minute)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	assert.Equal(t, map[string]uint64{
+		"AddWebhookDeliveries ok": 1,
+		"ClaimWebhookDelivery ok": 1,
+		"DeleteDeadLetter error":  1,
+	}, observedQueries(t, registry))
+}
+
+func Test_InstrumentStorePurge(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	m := metrics.New(registry)
+
+	_, err := m.InstrumentStore(memory.New()).PurgeIdempotencyKeys(ctx, time.Hour, 10)
+	require.NoError(t, err)
+
+	// A store without idempotency keys has nothing to purge
+	_, err = m.InstrumentStore(mocks.NewStore(t)).PurgeIdempotencyKeys(ctx, time.Hour, 10)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	assert.Equal(t, map[string]uint64{"PurgeIdempotencyKeys ok": 1}, observedQueries(t, registry))
+}
+
+// observedQueries returns the number of queries observed, by query and result
+func observedQueries(t *testing.T, registry *prometheus.Registry) map[string]uint64 {
+	t.Helper()
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+
+	observed := map[string]uint64{}
+	for _, metric := range families[0].Metric {
+		labels := map[string]string{}
+		for _, label := range metric.Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		observed[labels["query"]+" "+labels["result"]] = metric.Histogram.GetSampleCount()
+	}
+	return observed
+}
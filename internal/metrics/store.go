@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/api"
+	"github.com/neiln3121/explore-service/internal/outbox"
+	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/webhook"
+)
+
+// idempotencyPurger is a store which keeps idempotency keys until they are purged
+type idempotencyPurger interface {
+	PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit uint32) (int, error)
+}
+
+// Store records the time taken by every call to the store it wraps. Calls the wrapped store doesn't have a method for,
+// such as relaying an outbox, fail with errors.ErrUnsupported.
+type Store struct {
+	next    api.Store
+	metrics *Metrics
+}
+
+// InstrumentStore wraps the store so the time taken by its queries is recorded
+func (m *Metrics) InstrumentStore(store api.Store) *Store {
+	return &Store{
+		next:    store,
+		metrics: m,
+	}
+}
+
+func (s *Store) RecordDecision(ctx context.Context, recipientID, actorID string, liked bool) (*storage.DecisionResult, error) {
+	start := time.Now()
+	res, err := s.next.RecordDecision(ctx, recipientID, actorID, liked)
+	s.metrics.ObserveQuery("RecordDecision", start, err)
+	return res, err
+}
+
+func (s *Store) RecordIdempotentDecision(ctx context.Context, key string, ttl time.Duration, recipientID, actorID string, liked bool) (*storage.DecisionResult, error) {
+	start := time.Now()
+	res, err := s.next.RecordIdempotentDecision(ctx, key, ttl, recipientID, actorID, liked)
+	s.metrics.ObserveQuery("RecordIdempotentDecision", start, err)
+	return res, err
+}
+
+func (s *Store) GetLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error) {
+	start := time.Now()
+	res, err := s.next.GetLikedDecisions(ctx, recipientID, liked, sort, cursor, limit)
+	s.metrics.ObserveQuery("GetLikedDecisions", start, err)
+	return res, err
+}
+
+func (s *Store) GetNewLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error) {
+	start := time.Now()
+	res, err := s.next.GetNewLikedDecisions(ctx, recipientID, liked, sort, cursor, limit)
+	s.metrics.ObserveQuery("GetNewLikedDecisions", start, err)
+	return res, err
+}
+
+func (s *Store) GetLikedDecisionsCount(ctx context.Context, recipientID string, liked bool) (int, error) {
+	start := time.Now()
+	res, err := s.next.GetLikedDecisionsCount(ctx, recipientID, liked)
+	s.metrics.ObserveQuery("GetLikedDecisionsCount", start, err)
+	return res, err
+}
+
+func (s *Store) GetMatches(ctx context.Context, userID string, token *uint64, limit *uint32) ([]*storage.Match, error) {
+	start := time.Now()
+	res, err := s.next.GetMatches(ctx, userID, token, limit)
+	s.metrics.ObserveQuery("GetMatches", start, err)
+	return res, err
+}
+
+func (s *Store) UndoDecision(ctx context.Context, recipientID, actorID string, window time.Duration) (*storage.UndoResult, error) {
+	start := time.Now()
+	res, err := s.next.UndoDecision(ctx, recipientID, actorID, window)
+	s.metrics.ObserveQuery("UndoDecision", start, err)
+	return res, err
+}
+
+func (s *Store) Unmatch(ctx context.Context, userID, matchedUserID string) error {
+	start := time.Now()
+	err := s.next.Unmatch(ctx, userID, matchedUserID)
+	s.metrics.ObserveQuery("Unmatch", start, err)
+	return err
+}
+
+func (s *Store) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	start := time.Now()
+	err := s.next.BlockUser(ctx, blockerID, blockedID)
+	s.metrics.ObserveQuery("BlockUser", start, err)
+	return err
+}
+
+func (s *Store) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	start := time.Now()
+	err := s.next.UnblockUser(ctx, blockerID, blockedID)
+	s.metrics.ObserveQuery("UnblockUser", start, err)
+	return err
+}
+
+func (s *Store) GetDecisionHistory(ctx context.Context, actorID string, recipientID *string, token *uint64, limit *uint32) ([]*storage.DecisionEvent, error) {
+	start := time.Now()
+	res, err := s.next.GetDecisionHistory(ctx, actorID, recipientID, token, limit)
+	s.metrics.ObserveQuery("GetDecisionHistory", start, err)
+	return res, err
+}
+
+func (s *Store) GetLikeEvents(ctx context.Context, userID string, after uint64, limit uint32) ([]*storage.LikeEvent, error) {
+	start := time.Now()
+	res, err := s.next.GetLikeEvents(ctx, userID, after, limit)
+	s.metrics.ObserveQuery("GetLikeEvents", start, err)
+	return res, err
+}
+
+func (s *Store) GetLastLikeEventID(ctx context.Context, userID string) (uint64, error) {
+	start := time.Now()
+	res, err := s.next.GetLastLikeEventID(ctx, userID)
+	s.metrics.ObserveQuery("GetLastLikeEventID", start, err)
+	return res, err
+}
+
+func (s *Store) RelayOutbox(ctx context.Context, limit uint32, publish func(context.Context, *storage.OutboxEvent) error) (int, error) {
+	next, ok := s.next.(outbox.Store)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	start := time.Now()
+	res, err := next.RelayOutbox(ctx, limit, publish)
+	s.metrics.ObserveQuery("RelayOutbox", start, err)
+	return res, err
+}
+
+func (s *Store) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit uint32) (int, error) {
+	next, ok := s.next.(idempotencyPurger)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	start := time.Now()
+	res, err := next.PurgeIdempotencyKeys(ctx, ttl, limit)
+	s.metrics.ObserveQuery("PurgeIdempotencyKeys", start, err)
+	return res, err
+}
+
+func (s *Store) AddWebhookDeliveries(ctx context.Context, subscriptions []string, event *storage.OutboxEvent) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	start := time.Now()
+	err := next.AddWebhookDeliveries(ctx, subscriptions, event)
+	s.metrics.ObserveQuery("AddWebhookDeliveries", start, err)
+	return err
+}
+
+func (s *Store) ClaimWebhookDelivery(ctx context.Context, subscription string, lease time.Duration) (*storage.WebhookDelivery, error) {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	start := time.Now()
+	res, err := next.ClaimWebhookDelivery(ctx, subscription, lease)
+	s.metrics.ObserveQuery("ClaimWebhookDelivery", start, err)
+	return res, err
+}
+
+func (s *Store) DeleteWebhookDelivery(ctx context.Context, id uint64) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	start := time.Now()
+	err := next.DeleteWebhookDelivery(ctx, id)
+	s.metrics.ObserveQuery("DeleteWebhookDelivery", start, err)
+	return err
+}
+
+func (s *Store) RetryWebhookDelivery(ctx context.Context, id uint64, lastError string, backoff time.Duration) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	start := time.Now()
+	err := next.RetryWebhookDelivery(ctx, id, lastError, backoff)
+	s.metrics.ObserveQuery("RetryWebhookDelivery", start, err)
+	return err
+}
+
+func (s *Store) DeadLetterWebhookDelivery(ctx context.Context, id uint64, lastError string) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	start := time.Now()
+	err := next.DeadLetterWebhookDelivery(ctx, id, lastError)
+	s.metrics.ObserveQuery("DeadLetterWebhookDelivery", start, err)
+	return err
+}
+
+func (s *Store) GetDeadLetters(ctx context.Context, subscription *string, after uint64, limit uint32) ([]*storage.DeadLetter, error) {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	start := time.Now()
+	res, err := next.GetDeadLetters(ctx, subscription, after, limit)
+	s.metrics.ObserveQuery("GetDeadLetters", start, err)
+	return res, err
+}
+
+func (s *Store) DeleteDeadLetter(ctx context.Context, id uint64) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	start := time.Now()
+	err := next.DeleteDeadLetter(ctx, id)
+	s.metrics.ObserveQuery("DeleteDeadLetter", start, err)
+	return err
+}
+
+func (s *Store) RecordDeadLetterAttempt(ctx context.Context, id uint64, lastError string) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	start := time.Now()
+	err := next.RecordDeadLetterAttempt(ctx, id, lastError)
+	s.metrics.ObserveQuery("RecordDeadLetterAttempt", start, err)
+	return err
+}
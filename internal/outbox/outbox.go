@@ -0,0 +1,126 @@
+// Package outbox relays the events written to the outbox by decisions to other services. Events are written in the
+// same transaction as the decision they describe and published afterwards by a relay, so an event is published if and
+// only if its decision was committed. Delivery is at least once: an event can be published again if the relay fails
+// after publishing it, so consumers should ignore IDs they have already seen.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/storage"
+)
+
+// Publishers events can be published with
+const (
+	// PublisherNone drops events
+	PublisherNone = "none"
+	// PublisherFile writes events as JSON lines to stdout, or to a file if one is set
+	PublisherFile = "file"
+)
+
+// Publisher publishes events to other services. An event is only removed from the outbox once Publish has returned
+// without an error.
+type Publisher interface {
+	Publish(ctx context.Context, event *storage.OutboxEvent) error
+}
+
+// PublisherFunc is a function publishing events
+type PublisherFunc func(ctx context.Context, event *storage.OutboxEvent) error
+
+func (f PublisherFunc) Publish(ctx context.Context, event *storage.OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// Discard drops every event
+var Discard Publisher = PublisherFunc(func(context.Context, *storage.OutboxEvent) error {
+	return nil
+})
+
+// Publishers publishes every event with each of the publishers in turn, stopping at the first which fails. A failed
+// event is published again with all of them, so the publishers before the one which failed see it more than once.
+func Publishers(publishers ...Publisher) Publisher {
+	return PublisherFunc(func(ctx context.Context, event *storage.OutboxEvent) error {
+		for _, publisher := range publishers {
+			if err := publisher.Publish(ctx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Message is the JSON encoding of a published event
+type Message struct {
+	// ID is unique to the event, and the same if the event is published again
+	ID          uint64    `json:"id"`
+	Type        string    `json:"type"`
+	RecipientID string    `json:"recipient_id"`
+	ActorID     string    `json:"actor_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func NewMessage(event *storage.OutboxEvent) Message {
+	return Message{
+		ID:          event.ID,
+		Type:        event.Type,
+		RecipientID: event.RecipientID,
+		ActorID:     event.ActorID,
+		CreatedAt:   time.Unix(int64(event.CreatedAt), 0).UTC(),
+	}
+}
+
+// FilePublisher writes events to a writer as JSON lines
+type FilePublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewFilePublisher(w io.Writer) *FilePublisher {
+	return &FilePublisher{
+		w: w,
+	}
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, event *storage.OutboxEvent) error {
+	line, err := json.Marshal(NewMessage(event))
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+// MemoryPublisher keeps the events published in memory, for tests
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, event *storage.OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, NewMessage(event))
+	return nil
+}
+
+// Messages returns the events published so far, in the order they were published
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
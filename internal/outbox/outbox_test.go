@@ -0,0 +1,121 @@
+package outbox_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/outbox"
+	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type published struct {
+	eventType, recipientID, actorID string
+}
+
+func messages(publisher *outbox.MemoryPublisher) []published {
+	var got []published
+	for _, message := range publisher.Messages() {
+		got = append(got, published{message.Type, message.RecipientID, message.ActorID})
+	}
+	return got
+}
+
+func Test_RelayOnce(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	_, err := store.RecordDecision(ctx, "1", "2", true)
+	require.NoError(t, err)
+	_, err = store.RecordDecision(ctx, "2", "1", true)
+	require.NoError(t, err)
+	_, err = store.RecordDecision(ctx, "1", "2", false)
+	require.NoError(t, err)
+
+	publisher := outbox.NewMemoryPublisher()
+	// Batches smaller than the outbox are relayed until it is empty
+	relay := outbox.NewRelay(store, publisher, outbox.WithBatchSize(2))
+
+	n, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, []published{
+		{storage.OutboxLikeCreated, "1", "2"},
+		{storage.OutboxLikeCreated, "2", "1"},
+		{storage.OutboxMatchCreated, "2", "1"},
+		{storage.OutboxPassRecorded, "1", "2"},
+		{storage.OutboxUnmatched, "1", "2"},
+	}, messages(publisher))
+
+	n, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func Test_RelayRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := memory.New()
+	_, err := store.RecordDecision(ctx, "1", "2", true)
+	require.NoError(t, err)
+	_, err = store.RecordDecision(ctx, "2", "1", true)
+	require.NoError(t, err)
+
+	// The second event fails to publish twice
+	publisher := outbox.NewMemoryPublisher()
+	var calls atomic.Int32
+	failing := outbox.PublisherFunc(func(ctx context.Context, event *storage.OutboxEvent) error {
+		if event.ID == 2 && calls.Add(1) <= 2 {
+			return errors.New("broker unavailable")
+		}
+		return publisher.Publish(ctx, event)
+	})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	relay := outbox.NewRelay(store, failing, outbox.WithInterval(time.Millisecond), outbox.WithLogger(logger))
+	go relay.Run(ctx)
+
+	// Every event is published once, in the order written
+	assert.Eventually(t, func() bool {
+		return len(publisher.Messages()) == 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []published{
+		{storage.OutboxLikeCreated, "1", "2"},
+		{storage.OutboxLikeCreated, "2", "1"},
+		{storage.OutboxMatchCreated, "2", "1"},
+	}, messages(publisher))
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func Test_FilePublisher(t *testing.T) {
+	var buf bytes.Buffer
+	publisher := outbox.NewFilePublisher(&buf)
+
+	for id, eventType := range []string{storage.OutboxLikeCreated, storage.OutboxMatchCreated} {
+		err := publisher.Publish(context.Background(), &storage.OutboxEvent{
+			ID:          uint64(id + 1),
+			Type:        eventType,
+			RecipientID: "1",
+			ActorID:     "2",
+			CreatedAt:   1700000000,
+		})
+		require.NoError(t, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"id": 1, "type": "like_created", "recipient_id": "1", "actor_id": "2", "created_at": "2023-11-14T22:13:20Z"}`, lines[0])
+
+	var message outbox.Message
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &message))
+	assert.Equal(t, uint64(2), message.ID)
+	assert.Equal(t, storage.OutboxMatchCreated, message.Type)
+}
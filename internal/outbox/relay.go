@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/storage"
+)
+
+const (
+	// DefaultInterval is how often the outbox is checked for events, unless set with WithInterval
+	DefaultInterval = time.Second
+	// DefaultBatchSize is the number of events published per transaction, unless set with WithBatchSize
+	DefaultBatchSize = 100
+	// maxBackoff is the longest the relay waits to retry after failing to publish
+	maxBackoff = time.Minute
+)
+
+// Store is a store with an outbox
+type Store interface {
+	RelayOutbox(ctx context.Context, limit uint32, publish func(context.Context, *storage.OutboxEvent) error) (int, error)
+}
+
+// Relay publishes the events written to the outbox of a store, in the order they were written
+type Relay struct {
+	store     Store
+	publisher Publisher
+	interval  time.Duration
+	batchSize uint32
+	logger    *slog.Logger
+}
+
+// Option configures optional behaviour of the Relay
+type Option func(*Relay)
+
+// WithInterval sets how often the outbox is checked for events
+func WithInterval(interval time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = interval
+	}
+}
+
+// WithBatchSize sets the number of events published per transaction
+func WithBatchSize(batchSize uint32) Option {
+	return func(r *Relay) {
+		r.batchSize = batchSize
+	}
+}
+
+// WithLogger sets the logger failures are logged to, instead of the default logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *Relay) {
+		r.logger = logger
+	}
+}
+
+// NewRelay returns a relay publishing the events written to the outbox of the store with the publisher
+func NewRelay(store Store, publisher Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		store:     store,
+		publisher: publisher,
+		interval:  DefaultInterval,
+		batchSize: DefaultBatchSize,
+		logger:    slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run relays events every interval until the context is done. After a failure the relay backs off, doubling the wait
+// up to a minute, and then retries from the event which failed, so events after it wait rather than overtake it.
+func (r *Relay) Run(ctx context.Context) {
+	wait, backoff := r.interval, r.interval
+	for {
+		_, err := r.RelayOnce(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			r.logger.ErrorContext(ctx, "failed to publish events", "error", err, "retry_in", backoff)
+			wait = backoff
+			backoff = min(2*backoff, maxBackoff)
+		default:
+			wait = r.interval
+			backoff = r.interval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RelayOnce publishes events until the outbox is empty or an event fails to publish, returning the number published
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		published, err := r.store.RelayOutbox(ctx, r.batchSize, r.publisher.Publish)
+		total += published
+		if err != nil || published < int(r.batchSize) {
+			return total, err
+		}
+	}
+}
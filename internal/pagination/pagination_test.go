@@ -0,0 +1,127 @@
+package pagination_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/neiln3121/explore-service/internal/pagination"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testKey   = []byte("test-key")
+	testScope = pagination.Scope{
+		Endpoint: "/explore.ExploreAPI/ListLikedYou",
+		Filter:   "user-1",
+		Sort:     pagination.SortID,
+	}
+)
+
+func Test_Decode(t *testing.T) {
+	codec := pagination.NewCodec(testKey)
+	token := codec.Encode(testScope, pagination.Position{ID: 42})
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	assert.NoError(t, err)
+	raw[0] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	testCases := []struct {
+		description      string
+		codec            *pagination.Codec
+		token            string
+		scope            pagination.Scope
+		expectedPosition *pagination.Position
+		expectedError    error
+	}{
+		{
+			description:      "valid",
+			codec:            codec,
+			token:            token,
+			scope:            testScope,
+			expectedPosition: &pagination.Position{ID: 42},
+		},
+		{
+			description:   "not base64",
+			codec:         codec,
+			token:         "not a token!",
+			scope:         testScope,
+			expectedError: pagination.ErrInvalidToken,
+		},
+		{
+			description:   "too short",
+			codec:         codec,
+			token:         "YQ",
+			scope:         testScope,
+			expectedError: pagination.ErrInvalidToken,
+		},
+		{
+			description:   "tampered",
+			codec:         codec,
+			token:         tampered,
+			scope:         testScope,
+			expectedError: pagination.ErrInvalidToken,
+		},
+		{
+			description:   "different key",
+			codec:         pagination.NewCodec([]byte("other-key")),
+			token:         token,
+			scope:         testScope,
+			expectedError: pagination.ErrInvalidToken,
+		},
+		{
+			description:   "different endpoint",
+			codec:         codec,
+			token:         token,
+			scope:         pagination.Scope{Endpoint: "/explore.ExploreAPI/ListMatches", Filter: testScope.Filter, Sort: testScope.Sort},
+			expectedError: pagination.ErrTokenScope,
+		},
+		{
+			description:   "different filter",
+			codec:         codec,
+			token:         token,
+			scope:         pagination.Scope{Endpoint: testScope.Endpoint, Filter: "user-2", Sort: testScope.Sort},
+			expectedError: pagination.ErrTokenScope,
+		},
+		{
+			description:   "different sort",
+			codec:         codec,
+			token:         token,
+			scope:         pagination.Scope{Endpoint: testScope.Endpoint, Filter: testScope.Filter, Sort: "other"},
+			expectedError: pagination.ErrTokenScope,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			position, err := tc.codec.Decode(tc.token, tc.scope)
+
+			if tc.expectedError == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedPosition, position)
+			} else {
+				assert.ErrorIs(t, err, tc.expectedError)
+				assert.Nil(t, position)
+			}
+		})
+	}
+}
+
+func Test_EncodeHidesFilter(t *testing.T) {
+	token := pagination.NewCodec(testKey).Encode(testScope, pagination.Position{ID: 1})
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), testScope.Filter)
+}
+
+func Test_EncodeHidesPosition(t *testing.T) {
+	at := int64(1700000000)
+	token := pagination.NewCodec(testKey).Encode(testScope, pagination.Position{ID: 424242, Time: &at})
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "424242")
+	assert.NotContains(t, string(raw), "1700000000")
+	assert.NotContains(t, string(raw), testScope.Sort)
+}
@@ -0,0 +1,606 @@
+// Package server wires the API to its store, and runs it with its health, metrics and tracing until it is signalled to
+// shut down
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/neiln3121/explore-service/database/migrations"
+	contract "github.com/neiln3121/explore-service/explore"
+	"github.com/neiln3121/explore-service/internal/api"
+	"github.com/neiln3121/explore-service/internal/auth"
+	"github.com/neiln3121/explore-service/internal/config"
+	"github.com/neiln3121/explore-service/internal/gateway"
+	"github.com/neiln3121/explore-service/internal/health"
+	"github.com/neiln3121/explore-service/internal/logging"
+	"github.com/neiln3121/explore-service/internal/metrics"
+	"github.com/neiln3121/explore-service/internal/outbox"
+	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/storage/memory"
+	"github.com/neiln3121/explore-service/internal/tlsconfig"
+	"github.com/neiln3121/explore-service/internal/tracing"
+	"github.com/neiln3121/explore-service/internal/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	migrate "github.com/rubenv/sql-migrate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Server runs the API until it is signalled to shut down
+type Server struct {
+	cfg      config.Config
+	logger   *slog.Logger
+	store    api.Store
+	listener net.Listener
+	// httpListener is the listener of the HTTP gateway
+	httpListener net.Listener
+	publisher    outbox.Publisher
+}
+
+// Option configures optional behaviour of the Server
+type Option func(*Server)
+
+// WithLogger sets the logger of the server, instead of the default logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithStore serves decisions from the store instead of the configured store
+func WithStore(store api.Store) Option {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithHTTPListener serves the HTTP gateway from the listener instead of listening on the configured address
+func WithHTTPListener(listener net.Listener) Option {
+	return func(s *Server) {
+		s.httpListener = listener
+	}
+}
+
+// WithPublisher publishes the events of the outbox with the publisher instead of the configured publisher
+func WithPublisher(publisher outbox.Publisher) Option {
+	return func(s *Server) {
+		s.publisher = publisher
+	}
+}
+
+// WithListener serves requests from the listener instead of listening on the configured port
+func WithListener(listener net.Listener) Option {
+	return func(s *Server) {
+		s.listener = listener
+	}
+}
+
+func New(cfg config.Config, opts ...Option) *Server {
+	s := &Server{
+		cfg:    cfg,
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run serves requests until the context is done or the process receives SIGINT or SIGTERM. On shutdown the server
+// reports it isn't serving, then stops accepting requests and waits up to the drain timeout for requests in flight,
+// cancelling any still running. The outbox is relayed until every request has returned, and the database is closed
+// after that.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		ServiceName: "explore-service",
+		Exporter:    s.cfg.Tracing.Exporter,
+		File:        s.cfg.Tracing.File,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		// Spans are flushed last, so they include the shutdown
+		if err := shutdownTracing(context.Background()); err != nil {
+			s.logger.Error("failed to flush spans", "error", err)
+		}
+	}()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	m := metrics.New(registry)
+
+	// The server reports it isn't serving until the store is ready
+	healthServer := grpchealth.NewServer()
+	services := []string{"", contract.ExploreAPI_ServiceDesc.ServiceName}
+	for _, service := range services {
+		healthServer.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+
+	repo := s.store
+	var db *sql.DB
+	var watcher api.Watcher
+	if repo == nil {
+		switch s.cfg.Database.Store {
+		case config.StorePostgres:
+			db, err = sql.Open("postgres", s.cfg.Database.URL)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+			defer db.Close()
+			db.SetMaxOpenConns(s.cfg.Database.MaxOpenConns)
+			db.SetMaxIdleConns(s.cfg.Database.MaxIdleConns)
+			db.SetConnMaxLifetime(s.cfg.Database.ConnMaxLifetime)
+
+			registry.MustRegister(collectors.NewDBStatsCollector(db, "explore"))
+			repo = storage.New(db)
+
+			// Likes are listened for until the server has stopped, so watches are woken until they are closed
+			listener := storage.NewListener(s.cfg.Database.URL, s.logger)
+			listenCtx, stopListening := context.WithCancel(context.Background())
+			defer stopListening()
+			go func() {
+				if err := listener.Run(listenCtx); err != nil {
+					s.logger.Error("failed to listen for likes, watches will poll for them", "error", err)
+				}
+			}()
+			watcher = listener
+		case config.StoreMemory:
+			repo = memory.New()
+		default:
+			return fmt.Errorf("unknown store %q", s.cfg.Database.Store)
+		}
+	}
+	if w, ok := repo.(api.Watcher); ok {
+		watcher = w
+	}
+	_, relaysOutbox := repo.(outbox.Store)
+	_, purgesIdempotencyKeys := repo.(idempotencyPurger)
+	_, queuesWebhooks := repo.(webhook.Store)
+
+	repo = m.InstrumentStore(repo)
+	var traceOpts []tracing.Option
+	if s.cfg.Tracing.RedactUserIDs {
+		traceOpts = append(traceOpts, tracing.WithRedactedUserIDs())
+	}
+	instrumented := tracing.InstrumentStore(repo, traceOpts...)
+	repo = instrumented
+
+	// The outbox is relayed, webhooks are delivered and idempotency keys are purged through the instrumented store, so
+	// the time taken shows up with the other queries
+	var outboxStore outbox.Store
+	if relaysOutbox {
+		outboxStore = instrumented
+	}
+	var purger idempotencyPurger
+	if purgesIdempotencyKeys {
+		purger = instrumented
+	}
+	var webhookStore webhook.Store
+	if queuesWebhooks {
+		webhookStore = instrumented
+	}
+
+	// Metrics are served on their own port so they aren't exposed with the API
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	metricsServer := &http.Server{
+		Addr:              s.cfg.Server.MetricsAddress,
+		Handler:           metricsMux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	authenticator, err := s.authenticator()
+	if err != nil {
+		return err
+	}
+
+	publisher, closePublisher, err := s.outboxPublisher()
+	if err != nil {
+		return err
+	}
+	defer closePublisher()
+
+	var dispatcher *webhook.Dispatcher
+	if s.cfg.Webhooks.SubscriptionsFile != "" {
+		subscriptions, err := webhook.LoadSubscriptions(s.cfg.Webhooks.SubscriptionsFile)
+		if err != nil {
+			return err
+		}
+		if webhookStore == nil {
+			return errors.New("webhooks require a store which queues webhook deliveries")
+		}
+		dispatcher = webhook.NewDispatcher(webhookStore, subscriptions,
+			webhook.WithClient(&http.Client{Timeout: s.cfg.Webhooks.Timeout}),
+			webhook.WithRetries(s.cfg.Webhooks.MaxAttempts, s.cfg.Webhooks.InitialBackoff, s.cfg.Webhooks.MaxBackoff),
+			webhook.WithInterval(s.cfg.Webhooks.Interval),
+			webhook.WithLogger(s.logger),
+		)
+		// Webhooks are queued after the configured publisher has published the event, and delivered from the queue
+		publisher = outbox.Publishers(publisher, dispatcher)
+	}
+
+	var creds []grpc.ServerOption
+	var tlsConfig *tls.Config
+	if s.cfg.TLS.CertFile != "" {
+		// Certificates are reloaded when they change on disk, so they can be rotated without a restart
+		reloader, err := tlsconfig.NewReloader(tlsconfig.Files{
+			CertFile:     s.cfg.TLS.CertFile,
+			KeyFile:      s.cfg.TLS.KeyFile,
+			ClientCAFile: s.cfg.TLS.ClientCAFile,
+		}, s.logger)
+		if err != nil {
+			return err
+		}
+		tlsConfig = reloader.TLSConfig()
+		creds = append(creds, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	lis := s.listener
+	if lis == nil {
+		lis, err = net.Listen("tcp", s.cfg.Server.ListenAddress)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+	}
+	httpLis := s.httpListener
+	if httpLis == nil && s.cfg.Server.HTTPAddress != "" {
+		httpLis, err = net.Listen("tcp", s.cfg.Server.HTTPAddress)
+		if err != nil {
+			lis.Close()
+			return fmt.Errorf("failed to listen for HTTP: %w", err)
+		}
+	}
+	if httpLis != nil && tlsConfig != nil {
+		httpLis = tls.NewListener(httpLis, tlsConfig)
+	}
+
+	interceptors := []grpc.UnaryServerInterceptor{logging.UnaryServerInterceptor(s.logger), m.UnaryServerInterceptor()}
+	streamInterceptors := []grpc.StreamServerInterceptor{logging.StreamServerInterceptor(s.logger), m.StreamServerInterceptor()}
+	if authenticator != nil {
+		// Health checks are made by orchestrators, which don't have credentials
+		interceptors = append(interceptors, auth.UnaryServerInterceptor(authenticator, s.logger, healthpb.Health_ServiceDesc.ServiceName))
+		streamInterceptors = append(streamInterceptors, auth.StreamServerInterceptor(authenticator, s.logger, healthpb.Health_ServiceDesc.ServiceName))
+	}
+	serverOpts := []grpc.ServerOption{
+		tracing.ServerOption(),
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+		// Stop waits for handlers to return, so the database isn't closed under them
+		grpc.WaitForHandlers(true),
+	}
+	grpcServer := grpc.NewServer(append(serverOpts, creds...)...)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	apiOpts := []api.Option{
+		api.WithUndoWindow(s.cfg.Decisions.UndoWindow),
+		api.WithIdempotencyTTL(s.cfg.Decisions.IdempotencyTTL),
+		api.WithPaginationLimits(s.cfg.Pagination.DefaultLimit, s.cfg.Pagination.MaxLimit),
+		api.WithFeatures(api.Features{
+			Undo:            s.cfg.Features.Undo,
+			DecisionHistory: s.cfg.Features.DecisionHistory,
+		}),
+		api.WithLogger(s.logger),
+	}
+	if authenticator != nil {
+		apiOpts = append(apiOpts, api.WithAuthorization())
+	}
+	if watcher != nil {
+		apiOpts = append(apiOpts, api.WithWatcher(watcher))
+	}
+	if dispatcher != nil {
+		apiOpts = append(apiOpts, api.WithReplayer(dispatcher))
+	}
+	if s.cfg.Pagination.Key != "" {
+		apiOpts = append(apiOpts, api.WithPaginationKey([]byte(s.cfg.Pagination.Key)))
+	} else {
+		s.logger.Warn("no pagination key is set, pagination tokens won't be valid after a restart or on other instances")
+	}
+	exploreAPI := api.New(repo, apiOpts...)
+	contract.RegisterExploreAPIServer(grpcServer, exploreAPI)
+
+	var httpServer *http.Server
+	var inFlight sync.WaitGroup
+	if httpLis != nil {
+		// HTTP requests go through the same interceptors as gRPC requests. They are traced by an interceptor first, as the
+		// stats handler tracing gRPC requests only sees requests to the gRPC server.
+		gatewayInterceptors := append([]grpc.UnaryServerInterceptor{tracing.UnaryServerInterceptor()}, interceptors...)
+		gatewayHandler := gateway.New(exploreAPI, gatewayInterceptors...)
+		httpServer = &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Requests are tracked so the database isn't closed under them, as the HTTP server doesn't wait for
+				// handlers it cancels
+				inFlight.Add(1)
+				defer inFlight.Done()
+				gatewayHandler.ServeHTTP(w, r)
+			}),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+
+	served := make(chan error, 3)
+	go func() {
+		s.logger.Info("metrics listening", "address", metricsServer.Addr)
+		if err := metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			served <- fmt.Errorf("failed to serve metrics: %w", err)
+		}
+	}()
+	go func() {
+		s.logger.Info("server listening", "address", lis.Addr().String())
+		if err := grpcServer.Serve(lis); err != nil {
+			served <- fmt.Errorf("failed to serve: %w", err)
+		}
+	}()
+	if httpServer != nil {
+		go func() {
+			s.logger.Info("HTTP gateway listening", "address", httpLis.Addr().String())
+			if err := httpServer.Serve(httpLis); !errors.Is(err, http.ErrServerClosed) {
+				served <- fmt.Errorf("failed to serve HTTP: %w", err)
+			}
+		}()
+	}
+
+	if db != nil {
+		// The database may not be up yet, so it is retried rather than giving up straight away
+		startupCtx, cancel := context.WithTimeout(ctx, s.cfg.Server.StartupTimeout)
+		err = health.Retry(startupCtx, 500*time.Millisecond, 10*time.Second, s.logger, func(ctx context.Context) error {
+			return prepareDatabase(ctx, db)
+		})
+		cancel()
+		if err != nil {
+			s.shutdown(exploreAPI, healthServer, grpcServer, httpServer, &inFlight, metricsServer)
+			return fmt.Errorf("failed to start: %w", err)
+		}
+		// The monitor is stopped before the database is closed
+		monitorCtx, stopMonitor := context.WithCancel(ctx)
+		defer stopMonitor()
+		monitor := health.NewMonitor(db, healthServer, s.cfg.Database.CheckInterval, s.logger, services...)
+		go monitor.Run(monitorCtx)
+	} else {
+		for _, service := range services {
+			healthServer.SetServingStatus(service, healthpb.HealthCheckResponse_SERVING)
+		}
+	}
+
+	if purger != nil {
+		purgeCtx, stopPurging := context.WithCancel(context.Background())
+		defer stopPurging()
+		go s.purgeIdempotencyKeys(purgeCtx, purger)
+	}
+
+	if dispatcher != nil {
+		// Deliveries still queued on shutdown are made on the next start
+		dispatchCtx, stopDispatching := context.WithCancel(context.Background())
+		dispatcherStopped := make(chan struct{})
+		go func() {
+			defer close(dispatcherStopped)
+			dispatcher.Run(dispatchCtx)
+		}()
+		defer func() {
+			stopDispatching()
+			<-dispatcherStopped
+		}()
+	}
+
+	if outboxStore != nil {
+		relay := outbox.NewRelay(outboxStore, publisher,
+			outbox.WithInterval(s.cfg.Outbox.Interval),
+			outbox.WithBatchSize(s.cfg.Outbox.BatchSize),
+			outbox.WithLogger(s.logger),
+		)
+		relayCtx, stopRelay := context.WithCancel(context.Background())
+		relayStopped := make(chan struct{})
+		go func() {
+			defer close(relayStopped)
+			relay.Run(relayCtx)
+		}()
+		defer func() {
+			// The relay is stopped after the server, and the outbox relayed once more, so the events of requests
+			// drained on shutdown aren't left until the next start
+			stopRelay()
+			<-relayStopped
+			flushCtx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.DrainTimeout)
+			defer cancel()
+			if _, err := relay.RelayOnce(flushCtx); err != nil {
+				s.logger.Error("failed to publish events on shutdown, they will be published on the next start", "error", err)
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		s.logger.Info("shutting down")
+		err = nil
+	case err = <-served:
+	}
+	s.shutdown(exploreAPI, healthServer, grpcServer, httpServer, &inFlight, metricsServer)
+	return err
+}
+
+// idempotencyPurger is a store which keeps idempotency keys until they are purged
+type idempotencyPurger interface {
+	PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit uint32) (int, error)
+}
+
+// purgeBatchSize is the number of expired idempotency keys removed at once, so purging doesn't hold locks for long
+const purgeBatchSize = 1000
+
+// purgeIdempotencyKeys removes the idempotency keys kept for longer than the TTL every purge interval, until the
+// context is done
+func (s *Server) purgeIdempotencyKeys(ctx context.Context, purger idempotencyPurger) {
+	ticker := time.NewTicker(s.cfg.Decisions.IdempotencyPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			purged, err := purger.PurgeIdempotencyKeys(ctx, s.cfg.Decisions.IdempotencyTTL, purgeBatchSize)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Warn("failed to purge expired idempotency keys, retrying at the next interval", "error", err)
+				}
+				break
+			}
+			if purged < purgeBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// authenticator returns the configured authenticator, nil if callers aren't authenticated. Clients with a listed
+// certificate identity are authenticated by it before the credentials of the mode.
+func (s *Server) authenticator() (auth.Authenticator, error) {
+	var authenticators []auth.Authenticator
+	if s.cfg.Auth.ClientIdentitiesFile != "" {
+		certificates, err := auth.LoadClientCertificates(s.cfg.Auth.ClientIdentitiesFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, certificates)
+	}
+
+	switch s.cfg.Auth.Mode {
+	case config.AuthJWT:
+		jwt, err := auth.LoadJWT(auth.JWTConfig{
+			JWKSFile: s.cfg.Auth.JWKSFile,
+			Issuer:   s.cfg.Auth.Issuer,
+			Audience: s.cfg.Auth.Audience,
+		})
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, jwt)
+	case config.AuthAPIKeys:
+		keys, err := auth.LoadAPIKeys(s.cfg.Auth.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, keys)
+	}
+
+	switch len(authenticators) {
+	case 0:
+		return nil, nil
+	case 1:
+		return authenticators[0], nil
+	}
+	return auth.FirstOf(authenticators...), nil
+}
+
+// outboxPublisher returns the publisher the events of the outbox are published with, and a function closing it
+func (s *Server) outboxPublisher() (outbox.Publisher, func(), error) {
+	if s.publisher != nil {
+		return s.publisher, func() {}, nil
+	}
+	switch s.cfg.Outbox.Publisher {
+	case outbox.PublisherFile:
+		if s.cfg.Outbox.File == "" {
+			return outbox.NewFilePublisher(os.Stdout), func() {}, nil
+		}
+		file, err := os.OpenFile(s.cfg.Outbox.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open outbox file: %w", err)
+		}
+		return outbox.NewFilePublisher(file), func() {
+			if err := file.Close(); err != nil {
+				s.logger.Error("failed to close outbox file", "error", err)
+			}
+		}, nil
+	}
+	return outbox.Discard, func() {}, nil
+}
+
+// shutdown reports the server isn't serving, then stops it once requests in flight have finished, or cancels them
+// after the drain timeout. Requests are served as usual for the shutdown delay after reporting it, so load balancers
+// and orchestrators checking the health of the server stop sending it new connections before it stops accepting them.
+// Watches of likes are closed after the delay, so their clients resume elsewhere. The HTTP server is nil if the
+// gateway isn't served.
+func (s *Server) shutdown(exploreAPI *api.ExploreAPI, healthServer *grpchealth.Server, grpcServer *grpc.Server, httpServer *http.Server, inFlight *sync.WaitGroup, metricsServer *http.Server) {
+	healthServer.Shutdown()
+	if s.cfg.Server.ShutdownDelay > 0 {
+		s.logger.Info("reporting NOT_SERVING before stopping", "delay", s.cfg.Server.ShutdownDelay)
+		time.Sleep(s.cfg.Server.ShutdownDelay)
+	}
+	exploreAPI.CloseWatches()
+
+	httpStopped := make(chan struct{})
+	go func() {
+		defer close(httpStopped)
+		if httpServer == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.DrainTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			httpServer.Close()
+		}
+		inFlight.Wait()
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(s.cfg.Server.DrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.logger.Warn("requests didn't finish within the drain timeout, cancelling them")
+		grpcServer.Stop()
+		<-stopped
+	}
+	<-httpStopped
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := metricsServer.Shutdown(ctx); err != nil {
+		s.logger.Error("failed to stop metrics server", "error", err)
+	}
+	s.logger.Info("server stopped")
+}
+
+// prepareDatabase checks the database can be reached and runs the migrations
+func prepareDatabase(ctx context.Context, db *sql.DB) error {
+	err := db.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+
+	// run migrations + seeds
+	mg := migrations.GetMigrationSource()
+	migrate.SetTable("migrations")
+
+	_, err = migrate.ExecContext(ctx, db, "postgres", mg, migrate.Up)
+	if err != nil {
+		return fmt.Errorf("migrations failed: %w", err)
+	}
+	return nil
+}
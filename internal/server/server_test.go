@@ -0,0 +1,694 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	contract "github.com/neiln3121/explore-service/explore"
+	"github.com/neiln3121/explore-service/internal/config"
+	"github.com/neiln3121/explore-service/internal/health"
+	"github.com/neiln3121/explore-service/internal/outbox"
+	"github.com/neiln3121/explore-service/internal/server"
+	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/storage/memory"
+	"github.com/neiln3121/explore-service/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// slowStore holds decisions until they are released, or their context is cancelled
+type slowStore struct {
+	*memory.Store
+	started     chan struct{}
+	startedOnce sync.Once
+	release     chan struct{}
+}
+
+func newSlowStore() *slowStore {
+	return &slowStore{
+		Store:   memory.New(),
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func (s *slowStore) RecordDecision(ctx context.Context, recipientID, actorID string, liked bool) (*storage.DecisionResult, error) {
+	s.startedOnce.Do(func() { close(s.started) })
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.Store.RecordDecision(ctx, recipientID, actorID, liked)
+}
+
+func Test_ShutdownOnSignal(t *testing.T) {
+	testCases := []struct {
+		description   string
+		shutdownDelay time.Duration
+		drainTimeout  time.Duration
+		release       bool
+		expectedCode  codes.Code
+	}{
+		{
+			description:  "request in flight finishes",
+			drainTimeout: 5 * time.Second,
+			release:      true,
+			expectedCode: codes.OK,
+		},
+		{
+			description:   "new requests are served during the shutdown delay",
+			shutdownDelay: 300 * time.Millisecond,
+			drainTimeout:  5 * time.Second,
+			release:       true,
+			expectedCode:  codes.OK,
+		},
+		{
+			description:  "request in flight is cancelled after the drain timeout",
+			drainTimeout: 50 * time.Millisecond,
+			// The connection is closed under the request
+			expectedCode: codes.Unavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			store := newSlowStore()
+			cfg := config.Default()
+			cfg.Server.MetricsAddress = "127.0.0.1:0"
+			cfg.Server.HTTPAddress = ""
+			cfg.Server.ShutdownDelay = tc.shutdownDelay
+			cfg.Server.DrainTimeout = tc.drainTimeout
+			cfg.Database.Store = config.StoreMemory
+			srv := server.New(cfg,
+				server.WithStore(store),
+				server.WithListener(lis),
+				server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			)
+
+			stopped := make(chan error, 1)
+			go func() {
+				stopped <- srv.Run(context.Background())
+			}()
+
+			conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			require.NoError(t, err)
+			defer conn.Close()
+
+			responded := make(chan error, 1)
+			go func() {
+				_, err := contract.NewExploreAPIClient(conn).PutDecision(context.Background(), &contract.PutDecisionRequest{
+					ActorUserId:     "1",
+					RecipientUserId: "2",
+					LikedRecipient:  true,
+				})
+				responded <- err
+			}()
+
+			select {
+			case <-store.started:
+			case <-time.After(5 * time.Second):
+				t.Fatal("request didn't start")
+			}
+			require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+			if tc.shutdownDelay > 0 {
+				// The server reports it isn't serving straight away, but still accepts new connections until the
+				// delay is over
+				health := healthpb.NewHealthClient(conn)
+				assert.Eventually(t, func() bool {
+					res, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+					return err == nil && res.Status == healthpb.HealthCheckResponse_NOT_SERVING
+				}, time.Second, 10*time.Millisecond)
+
+				newConn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+				require.NoError(t, err)
+				defer newConn.Close()
+				_, err = contract.NewExploreAPIClient(newConn).CountLikedYou(context.Background(), &contract.CountLikedYouRequest{
+					RecipientUserId: "2",
+				})
+				assert.NoError(t, err)
+			}
+
+			if tc.release {
+				// The server waits for the request in flight
+				select {
+				case <-stopped:
+					t.Fatal("server stopped before the request finished")
+				case <-time.After(100 * time.Millisecond):
+				}
+				close(store.release)
+			}
+
+			select {
+			case err := <-responded:
+				assert.Equal(t, tc.expectedCode, status.Code(err))
+			case <-time.After(5 * time.Second):
+				t.Fatal("request didn't finish")
+			}
+
+			select {
+			case err := <-stopped:
+				assert.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("server didn't stop")
+			}
+		})
+	}
+}
+
+func Test_HTTPGateway(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	cfg := config.Default()
+	cfg.Server.MetricsAddress = "127.0.0.1:0"
+	cfg.Server.ShutdownDelay = 0
+	cfg.Database.Store = config.StoreMemory
+	srv := server.New(cfg,
+		server.WithListener(lis),
+		server.WithHTTPListener(httpLis),
+		server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Run(ctx)
+	}()
+
+	req, err := http.NewRequest("PUT", "http://"+httpLis.Addr().String()+"/v1/users/1/decisions/2", strings.NewReader(`{"liked_recipient": true}`))
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"mutual_likes": false, "outcome": "DECISION_OUTCOME_NO_COUNTERPART_DECISION"}`, string(body))
+
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+}
+
+func Test_WatchLikes(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	cfg := config.Default()
+	cfg.Server.MetricsAddress = "127.0.0.1:0"
+	cfg.Server.ShutdownDelay = 0
+	cfg.Server.HTTPAddress = ""
+	cfg.Database.Store = config.StoreMemory
+	srv := server.New(cfg,
+		server.WithListener(lis),
+		server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Run(ctx)
+	}()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := contract.NewExploreAPIClient(conn)
+
+	watch := func(ctx context.Context, resumeToken *string) grpc.ServerStreamingClient[contract.WatchLikesResponse] {
+		stream, err := client.WatchLikes(ctx, &contract.WatchLikesRequest{
+			RecipientUserId: "2",
+			ResumeToken:     resumeToken,
+		})
+		require.NoError(t, err)
+		// Headers are sent once the stream is watching
+		_, err = stream.Header()
+		require.NoError(t, err)
+		return stream
+	}
+	decide := func(actorID, recipientID string) {
+		_, err := client.PutDecision(context.Background(), &contract.PutDecisionRequest{
+			ActorUserId:     actorID,
+			RecipientUserId: recipientID,
+			LikedRecipient:  true,
+		})
+		require.NoError(t, err)
+	}
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	stream := watch(watchCtx, nil)
+
+	decide("1", "2")
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "1", event.UserId)
+	assert.Equal(t, contract.WatchLikesResponse_EVENT_TYPE_LIKED, event.Type)
+
+	decide("2", "1")
+	event, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "1", event.UserId)
+	assert.Equal(t, contract.WatchLikesResponse_EVENT_TYPE_MATCHED, event.Type)
+	stopWatching()
+
+	// Likes recorded while disconnected are sent on resuming
+	decide("3", "2")
+	stream = watch(context.Background(), &event.ResumeToken)
+	event, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "3", event.UserId)
+
+	// Watches are closed on shutdown rather than holding it up
+	cancel()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+}
+
+func Test_Outbox(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	cfg := config.Default()
+	cfg.Server.MetricsAddress = "127.0.0.1:0"
+	cfg.Server.ShutdownDelay = 0
+	cfg.Server.HTTPAddress = ""
+	cfg.Database.Store = config.StoreMemory
+	// The outbox is only relayed on shutdown
+	cfg.Outbox.Interval = time.Hour
+	publisher := outbox.NewMemoryPublisher()
+	srv := server.New(cfg,
+		server.WithListener(lis),
+		server.WithPublisher(publisher),
+		server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Run(ctx)
+	}()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := contract.NewExploreAPIClient(conn)
+
+	for _, users := range [][2]string{{"1", "2"}, {"2", "1"}} {
+		_, err := client.PutDecision(context.Background(), &contract.PutDecisionRequest{
+			ActorUserId:     users[0],
+			RecipientUserId: users[1],
+			LikedRecipient:  true,
+		})
+		require.NoError(t, err)
+	}
+
+	// Events written before shutdown are published before the server stops
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+	var types []string
+	for _, message := range publisher.Messages() {
+		types = append(types, message.Type)
+	}
+	assert.Equal(t, []string{storage.OutboxLikeCreated, storage.OutboxLikeCreated, storage.OutboxMatchCreated}, types)
+}
+
+// purgingStore counts the idempotency keys purged from it
+type purgingStore struct {
+	*memory.Store
+	purged atomic.Int32
+}
+
+func (s *purgingStore) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit uint32) (int, error) {
+	purged, err := s.Store.PurgeIdempotencyKeys(ctx, ttl, limit)
+	s.purged.Add(int32(purged))
+	return purged, err
+}
+
+func Test_PurgeIdempotencyKeys(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	cfg := config.Default()
+	cfg.Server.MetricsAddress = "127.0.0.1:0"
+	cfg.Server.ShutdownDelay = 0
+	cfg.Server.HTTPAddress = ""
+	cfg.Database.Store = config.StoreMemory
+	cfg.Decisions.IdempotencyTTL = 10 * time.Millisecond
+	cfg.Decisions.IdempotencyPurgeInterval = 10 * time.Millisecond
+	store := &purgingStore{Store: memory.New()}
+	srv := server.New(cfg,
+		server.WithStore(store),
+		server.WithListener(lis),
+		server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Run(ctx)
+	}()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	key := "swipe-1"
+	_, err = contract.NewExploreAPIClient(conn).PutDecision(context.Background(), &contract.PutDecisionRequest{
+		ActorUserId:     "1",
+		RecipientUserId: "2",
+		LikedRecipient:  true,
+		IdempotencyKey:  &key,
+	})
+	require.NoError(t, err)
+
+	// The key is removed once it expires, although the actor doesn't decide again
+	assert.Eventually(t, func() bool {
+		return store.purged.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+}
+
+func Test_Webhooks(t *testing.T) {
+	received := make(chan outbox.Message, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.NoError(t, webhook.Verify("test-secret", r.Header.Get(webhook.SignatureHeader), body, time.Now(), time.Minute))
+		var message outbox.Message
+		assert.NoError(t, json.Unmarshal(body, &message))
+		received <- message
+	}))
+	defer receiver.Close()
+
+	file := filepath.Join(t.TempDir(), "webhooks.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`[{name: partner, url: "`+receiver.URL+`", secret: test-secret}]`), 0o600))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	cfg := config.Default()
+	cfg.Server.MetricsAddress = "127.0.0.1:0"
+	cfg.Server.ShutdownDelay = 0
+	cfg.Server.HTTPAddress = ""
+	cfg.Database.Store = config.StoreMemory
+	cfg.Outbox.Interval = 10 * time.Millisecond
+	cfg.Webhooks.SubscriptionsFile = file
+	srv := server.New(cfg,
+		server.WithListener(lis),
+		server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Run(ctx)
+	}()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := contract.NewExploreAPIClient(conn)
+
+	for _, users := range [][2]string{{"1", "2"}, {"2", "1"}} {
+		_, err := client.PutDecision(context.Background(), &contract.PutDecisionRequest{
+			ActorUserId:     users[0],
+			RecipientUserId: users[1],
+			LikedRecipient:  true,
+		})
+		require.NoError(t, err)
+	}
+
+	// Only the match is delivered
+	select {
+	case message := <-received:
+		assert.Equal(t, storage.OutboxMatchCreated, message.Type)
+		assert.Equal(t, "1", message.RecipientID)
+		assert.Equal(t, "2", message.ActorID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook wasn't delivered")
+	}
+
+	res, err := client.ReplayWebhookDeliveries(context.Background(), &contract.ReplayWebhookDeliveriesRequest{})
+	require.NoError(t, err)
+	assert.Zero(t, res.Delivered)
+
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+	assert.Empty(t, received)
+}
+
+// testCA issues certificates for tests of mutual TLS, written to files in dir
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) (*testCA, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	file := filepath.Join(ca.dir, "ca.pem")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return ca, file
+}
+
+// issue writes a certificate signed by the CA and its key, returning their files
+func (ca *testCA) issue(t *testing.T, name, spiffeID string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if spiffeID != "" {
+		uri, err := url.Parse(spiffeID)
+		require.NoError(t, err)
+		template.URIs = []*url.URL{uri}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(ca.dir, name+".pem"), filepath.Join(ca.dir, name+"-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// clientTLS is the TLS configuration of a client presenting the certificate
+func (ca *testCA) clientTLS(t *testing.T, name, spiffeID string) *tls.Config {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(ca.issue(t, name, spiffeID, x509.ExtKeyUsageClientAuth))
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}}
+}
+
+func Test_MutualTLSAuthentication(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ca, caFile := newTestCA(t)
+	identitiesFile := filepath.Join(t.TempDir(), "identities.yaml")
+	require.NoError(t, os.WriteFile(identitiesFile, []byte(`
+- identity: spiffe://example.org/user-1
+  subject: "1"
+- identity: operator
+  roles: [admin]
+`), 0o600))
+
+	cfg := config.Default()
+	cfg.Server.MetricsAddress = "127.0.0.1:0"
+	cfg.Server.ShutdownDelay = 0
+	cfg.Database.Store = config.StoreMemory
+	cfg.TLS.CertFile, cfg.TLS.KeyFile = ca.issue(t, "server", "", x509.ExtKeyUsageServerAuth)
+	cfg.TLS.ClientCAFile = caFile
+	cfg.Auth.Mode = config.AuthMTLS
+	cfg.Auth.ClientIdentitiesFile = identitiesFile
+	require.NoError(t, cfg.Validate())
+	srv := server.New(cfg,
+		server.WithListener(lis),
+		server.WithHTTPListener(httpLis),
+		server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Run(ctx)
+	}()
+
+	testCases := []struct {
+		description string
+		name        string
+		spiffeID    string
+		actorID     string
+		// expectedCode is the code over gRPC, and expectedStatus the status over HTTP
+		expectedCode   codes.Code
+		expectedStatus int
+	}{
+		{
+			description:    "authorized by SPIFFE ID",
+			name:           "app",
+			spiffeID:       "spiffe://example.org/user-1",
+			actorID:        "1",
+			expectedCode:   codes.OK,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "only for its own subject",
+			name:           "app",
+			spiffeID:       "spiffe://example.org/user-1",
+			actorID:        "2",
+			expectedCode:   codes.PermissionDenied,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			description:    "authorized by common name",
+			name:           "operator",
+			actorID:        "3",
+			expectedCode:   codes.OK,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			description:    "unlisted identity",
+			name:           "unknown",
+			actorID:        "1",
+			expectedCode:   codes.Unauthenticated,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			clientTLS := ca.clientTLS(t, tc.name, tc.spiffeID)
+
+			conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = contract.NewExploreAPIClient(conn).PutDecision(ctx, &contract.PutDecisionRequest{
+				ActorUserId:     tc.actorID,
+				RecipientUserId: "4",
+				LikedRecipient:  true,
+			})
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+
+			// The HTTP gateway authenticates the client certificate the same way
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			defer client.CloseIdleConnections()
+			req, err := http.NewRequest("PUT", "https://"+httpLis.Addr().String()+"/v1/users/"+tc.actorID+"/decisions/5", strings.NewReader(`{"liked_recipient": true}`))
+			require.NoError(t, err)
+			res, err := client.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, tc.expectedStatus, res.StatusCode)
+		})
+	}
+
+	t.Run("health check", func(t *testing.T) {
+		// As -health-check, which doesn't verify the server and presents the health check certificate
+		probe := ca.clientTLS(t, "health-check", "")
+		probe.RootCAs, probe.InsecureSkipVerify = nil, true
+		serving, err := health.Check(ctx, lis.Addr().String(), probe)
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, serving)
+
+		_, err = health.Check(ctx, lis.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		assert.Error(t, err)
+	})
+
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a webhook delivery of an outbox event to a subscription which failed every attempt
+type DeadLetter struct {
+	ID           uint64
+	Subscription string
+	Event        OutboxEvent
+	Attempts     int
+	LastError    string
+	FailedAt     uint64
+}
+
+// GetDeadLetters lists the dead letters after the one with the ID, oldest first, optionally only for one subscription
+func (s *Storage) GetDeadLetters(ctx context.Context, subscription *string, after uint64, limit uint32) ([]*DeadLetter, error) {
+	queryBuilder := sq.Select("id", "subscription", "event_id", "event_type", "recipient_id", "actor_id", "event_created_at", "attempts", "last_error", "failed_at").
+		From("webhook_dead_letters").
+		Where(sq.Gt{
+			"id": after,
+		}).
+		PlaceholderFormat(sq.Dollar).OrderBy("id ASC").Limit(uint64(limit))
+
+	if subscription != nil {
+		queryBuilder = queryBuilder.Where(sq.Eq{
+			"subscription": *subscription,
+		})
+	}
+
+	query, args, err := queryBuilder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []*DeadLetter
+	for rows.Next() {
+		var letter DeadLetter
+		var createdAt, failedAt time.Time
+		err := rows.Scan(&letter.ID, &letter.Subscription, &letter.Event.ID, &letter.Event.Type, &letter.Event.RecipientID,
+			&letter.Event.ActorID, &createdAt, &letter.Attempts, &letter.LastError, &failedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		letter.Event.CreatedAt = uint64(createdAt.Unix())
+		letter.FailedAt = uint64(failedAt.Unix())
+		letters = append(letters, &letter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return letters, nil
+}
+
+// DeleteDeadLetter removes a dead letter once it has been delivered
+func (s *Storage) DeleteDeadLetter(ctx context.Context, id uint64) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM webhook_dead_letters WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// RecordDeadLetterAttempt records another failed attempt to deliver a dead letter
+func (s *Storage) RecordDeadLetterAttempt(ctx context.Context, id uint64, lastError string) error {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE webhook_dead_letters SET attempts = attempts + 1, last_error = $2, failed_at = now() WHERE id = $1;",
+		id, lastError)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
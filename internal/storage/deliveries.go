@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+// WebhookDelivery is an outbox event waiting to be delivered to a webhook subscription
+type WebhookDelivery struct {
+	ID           uint64
+	Subscription string
+	Event        OutboxEvent
+	// Attempts is the number of attempts which have failed so far
+	Attempts  int
+	LastError string
+}
+
+// AddWebhookDeliveries queues the event to be delivered to each of the subscriptions. An event already queued for a
+// subscription isn't queued again, so an event published again while it waits is only delivered once.
+func (s *Storage) AddWebhookDeliveries(ctx context.Context, subscriptions []string, event *OutboxEvent) error {
+	_, err := s.db.ExecContext(ctx,
+		`
+		INSERT INTO webhook_deliveries (subscription, event_id, event_type, recipient_id, actor_id, event_created_at, next_attempt_at)
+		SELECT subscription, $2::BIGINT, $3::TEXT, $4::TEXT, $5::TEXT, $6::TIMESTAMP, now() FROM unnest($1::TEXT[]) AS subscription
+		ON CONFLICT (subscription, event_id) DO NOTHING;
+		`,
+		pq.Array(subscriptions), event.ID, event.Type, event.RecipientID, event.ActorID,
+		time.Unix(int64(event.CreatedAt), 0).UTC())
+	return err
+}
+
+// ClaimWebhookDelivery returns the oldest delivery queued for the subscription if its next attempt is due, or nil if
+// there isn't one due. Later deliveries wait for it, so events are delivered in order. The next attempt of the
+// delivery is moved back by the lease, so it isn't claimed again while it is being delivered.
+func (s *Storage) ClaimWebhookDelivery(ctx context.Context, subscription string, lease time.Duration) (*WebhookDelivery, error) {
+	delivery := WebhookDelivery{Subscription: subscription}
+	var createdAt time.Time
+	row := s.db.QueryRowContext(ctx,
+		`
+		UPDATE webhook_deliveries SET next_attempt_at = now() + make_interval(secs => $2)
+		WHERE id = (SELECT id FROM webhook_deliveries WHERE subscription = $1 ORDER BY id ASC LIMIT 1)
+		AND next_attempt_at <= now()
+		RETURNING id, event_id, event_type, recipient_id, actor_id, event_created_at, attempts, last_error;
+		`,
+		subscription, lease.Seconds())
+	err := row.Scan(&delivery.ID, &delivery.Event.ID, &delivery.Event.Type, &delivery.Event.RecipientID,
+		&delivery.Event.ActorID, &createdAt, &delivery.Attempts, &delivery.LastError)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	delivery.Event.CreatedAt = uint64(createdAt.Unix())
+	return &delivery, nil
+}
+
+// DeleteWebhookDelivery removes a delivery once it has been delivered
+func (s *Storage) DeleteWebhookDelivery(ctx context.Context, id uint64) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	return deliveryAffected(res)
+}
+
+// RetryWebhookDelivery records a failed attempt at a delivery, which is attempted again after the backoff
+func (s *Storage) RetryWebhookDelivery(ctx context.Context, id uint64, lastError string, backoff time.Duration) error {
+	res, err := s.db.ExecContext(ctx,
+		`
+		UPDATE webhook_deliveries SET attempts = attempts + 1, last_error = $2, next_attempt_at = now() + make_interval(secs => $3)
+		WHERE id = $1;
+		`,
+		id, lastError, backoff.Seconds())
+	if err != nil {
+		return err
+	}
+	return deliveryAffected(res)
+}
+
+// DeadLetterWebhookDelivery records the last failed attempt at a delivery, and moves it to the dead letters so the
+// deliveries after it can be made
+func (s *Storage) DeadLetterWebhookDelivery(ctx context.Context, id uint64, lastError string) error {
+	return s.withTx(ctx, nil, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`
+			INSERT INTO webhook_dead_letters (subscription, event_id, event_type, recipient_id, actor_id, event_created_at, attempts, last_error, failed_at)
+			SELECT subscription, event_id, event_type, recipient_id, actor_id, event_created_at, attempts + 1, $2, now()
+			FROM webhook_deliveries WHERE id = $1;
+			`,
+			id, lastError)
+		if err != nil {
+			return err
+		}
+		if err := deliveryAffected(res); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE id = $1;", id)
+		return err
+	})
+}
+
+// deliveryAffected returns ErrWebhookDeliveryNotFound if no delivery was changed
+func deliveryAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Decision event types, recorded in the decision_events log every time a decision changes
+const (
+	// EventImported is a decision which existed before the log was introduced
+	EventImported = "imported"
+	// EventDecided is a new or changed decision
+	EventDecided = "decided"
+	// EventUndone is a decision reverted to the one it replaced, or removed if there was none
+	EventUndone = "undone"
+	// EventUnmatched is a pass recorded when a match was ended
+	EventUnmatched = "unmatched"
+)
+
+// DecisionEvent is a change to the decision of the actor for the recipient
+type DecisionEvent struct {
+	ID          uint64
+	RecipientID string
+	ActorID     string
+	Type        string
+	// Liked is the decision after the change, nil if the actor has no decision for the recipient anymore
+	Liked     *bool
+	CreatedAt uint64
+}
+
+// RebuildReport describes how the decisions differ from the decisions rebuilt from the event log
+type RebuildReport struct {
+	// Missing is the number of rebuilt decisions which don't exist
+	Missing int
+	// Extra is the number of decisions which don't exist in the rebuilt decisions
+	Extra int
+	// Mismatched is the number of decisions which exist in both but differ
+	Mismatched int
+	// Repaired is true if the decisions were replaced by the rebuilt decisions
+	Repaired bool
+}
+
+// Consistent is true if the decisions match the decisions rebuilt from the event log
+func (r *RebuildReport) Consistent() bool {
+	return r.Missing == 0 && r.Extra == 0 && r.Mismatched == 0
+}
+
+// LikeEvent is a like of the user by another user, or a like by the user which formed a match
+type LikeEvent struct {
+	// ID is the ID of the event in the decision_events log
+	ID uint64
+	// UserID is the other user, who liked the user or who the user liked
+	UserID string
+	// MatchedAt is when the like formed a match, nil if it didn't
+	MatchedAt *uint64
+	CreatedAt uint64
+}
+
+// recordEvent appends the current decision of the actor for the recipient to the event log. It must be called in
+// the same transaction as the change to the decision, once the mutual decision has been updated. Likes notify the
+// listeners of the recipient, and of the actor too if they formed a match.
+func recordEvent(ctx context.Context, tx *sql.Tx, recipientID, actorID, eventType string) error {
+	// The events of a user are recorded one transaction at a time, so their IDs are in the order they are committed and
+	// reading them after an ID can't miss one committed later with a lower ID
+	err := lockUsers(ctx, tx, recipientID, actorID)
+	if err != nil {
+		return err
+	}
+
+	var liked sql.NullBool
+	var matched bool
+	row := tx.QueryRowContext(ctx,
+		`
+		INSERT INTO decision_events (recipient_id, actor_id, event_type, liked, decided_at, matched_at, created_at)
+		SELECT $1::text, $2::text, $3::text, d.liked, d.decided_at, d.matched_at, now()
+		FROM (SELECT 1) AS event
+		LEFT JOIN decisions AS d ON d.recipient_id = $1::text AND d.actor_id = $2::text
+		RETURNING liked, matched_at IS NOT NULL;
+		`,
+		recipientID, actorID, eventType)
+	err = row.Scan(&liked, &matched)
+	if err != nil {
+		return err
+	}
+
+	if eventType != EventDecided || !liked.Bool {
+		return nil
+	}
+	err = notifyLike(ctx, tx, recipientID)
+	if err != nil || !matched {
+		return err
+	}
+	return notifyLike(ctx, tx, actorID)
+}
+
+// lockUsers locks both users until the end of the transaction. Users are locked in order, so transactions locking the
+// same users don't deadlock.
+func lockUsers(ctx context.Context, tx *sql.Tx, userID, otherUserID string) error {
+	if otherUserID < userID {
+		userID, otherUserID = otherUserID, userID
+	}
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtextextended($1, 0)), pg_advisory_xact_lock(hashtextextended($2, 0));", userID, otherUserID)
+	return err
+}
+
+// GetLikeEvents lists the likes of the user and the matches formed by the user's likes after the event with the ID,
+// oldest first. Likes between users where either has blocked the other are left out.
+func (s *Storage) GetLikeEvents(ctx context.Context, userID string, after uint64, limit uint32) ([]*LikeEvent, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`
+		SELECT e.id, CASE WHEN e.recipient_id = $1 THEN e.actor_id ELSE e.recipient_id END, e.matched_at, e.created_at
+		FROM decision_events AS e
+		WHERE e.event_type = 'decided' AND e.liked AND e.id > $2
+		AND (e.recipient_id = $1 OR (e.actor_id = $1 AND e.matched_at IS NOT NULL))
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocks.blocker_id = e.recipient_id AND blocks.blocked_id = e.actor_id)
+			OR (blocks.blocker_id = e.actor_id AND blocks.blocked_id = e.recipient_id)
+		)
+		ORDER BY e.id ASC
+		LIMIT $3;
+		`,
+		userID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*LikeEvent
+	for rows.Next() {
+		var event LikeEvent
+		var matchedAt sql.NullTime
+		var createdAt time.Time
+		err := rows.Scan(&event.ID, &event.UserID, &matchedAt, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		event.MatchedAt = unixTime(matchedAt)
+		event.CreatedAt = uint64(createdAt.Unix())
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetLastLikeEventID returns the ID of the last like event of the user, 0 if there isn't one. Listing the like events
+// after it lists those recorded from now on.
+func (s *Storage) GetLastLikeEventID(ctx context.Context, userID string) (uint64, error) {
+	var id uint64
+	row := s.db.QueryRowContext(ctx,
+		`
+		SELECT GREATEST(
+			(SELECT COALESCE(max(id), 0) FROM decision_events WHERE recipient_id = $1 AND event_type = 'decided' AND liked),
+			(SELECT COALESCE(max(id), 0) FROM decision_events WHERE actor_id = $1 AND event_type = 'decided' AND liked AND matched_at IS NOT NULL)
+		);
+		`,
+		userID)
+	err := row.Scan(&id)
+	return id, err
+}
+
+// GetDecisionHistory lists the changes to the decisions of the actor, oldest first, optionally only for one recipient
+func (s *Storage) GetDecisionHistory(ctx context.Context, actorID string, recipientID *string, token *uint64, limit *uint32) ([]*DecisionEvent, error) {
+	queryBuilder := sq.Select("id", "recipient_id", "actor_id", "event_type", "liked", "created_at").
+		From("decision_events").
+		Where(sq.Eq{
+			"actor_id": actorID,
+		}).
+		PlaceholderFormat(sq.Dollar).OrderBy("id ASC")
+
+	if recipientID != nil {
+		queryBuilder = queryBuilder.Where(sq.Eq{
+			"recipient_id": *recipientID,
+		})
+	}
+
+	if token != nil {
+		queryBuilder = queryBuilder.Where(sq.Gt{
+			"id": *token,
+		})
+	}
+
+	if limit != nil {
+		queryBuilder = queryBuilder.Limit(uint64(*limit))
+	}
+
+	query, args, err := queryBuilder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*DecisionEvent
+	for rows.Next() {
+		var event DecisionEvent
+		var created_at time.Time
+		err := rows.Scan(&event.ID, &event.RecipientID, &event.ActorID, &event.Type, &event.Liked, &created_at)
+		if err != nil {
+			return nil, err
+		}
+
+		event.CreatedAt = uint64(created_at.Unix())
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// RebuildDecisions rebuilds the decisions by replaying the event log and compares them with the stored decisions.
+// If repair is set, the stored decisions are replaced by the rebuilt decisions where they differ. Decisions are locked
+// against writes while they are rebuilt.
+func (s *Storage) RebuildDecisions(ctx context.Context, repair bool) (*RebuildReport, error) {
+	report := &RebuildReport{}
+	err := s.withTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead}, func(tx *sql.Tx) error {
+		// The lock has to be taken before the first query, so the snapshot includes every write before it
+		_, err := tx.ExecContext(ctx, "LOCK TABLE decisions IN SHARE ROW EXCLUSIVE MODE;")
+		if err != nil {
+			return err
+		}
+
+		// Replay the last event of each pair of users. Created at is the first event since the decision was last removed,
+		// only a decision changed by the last event can be undone, to the decision before it, and a match was formed by
+		// the later of the last events of the two users.
+		_, err = tx.ExecContext(ctx,
+			`
+			CREATE TEMPORARY TABLE rebuilt_decisions ON COMMIT DROP AS
+			WITH events AS (
+				SELECT e.*,
+				lag(e.liked) OVER pair AS previous_liked,
+				lag(e.decided_at) OVER pair AS previous_decided_at,
+				row_number() OVER (PARTITION BY e.recipient_id, e.actor_id ORDER BY e.id DESC) AS recency,
+				max(CASE WHEN e.liked IS NULL THEN e.id END) OVER (PARTITION BY e.recipient_id, e.actor_id) AS removed_id
+				FROM decision_events AS e
+				WINDOW pair AS (PARTITION BY e.recipient_id, e.actor_id ORDER BY e.id)
+			), latest AS (
+				SELECT l.id AS event_id, l.recipient_id, l.actor_id, l.liked, l.decided_at, l.matched_at,
+				(
+					SELECT min(c.created_at) FROM decision_events AS c
+					WHERE c.recipient_id = l.recipient_id AND c.actor_id = l.actor_id AND c.id > COALESCE(l.removed_id, 0)
+				) AS created_at,
+				CASE WHEN l.event_type = 'decided' THEN l.previous_liked END AS previous_liked,
+				CASE WHEN l.event_type = 'decided' THEN l.previous_decided_at END AS previous_decided_at,
+				l.event_type = 'decided' AS undoable
+				FROM events AS l
+				WHERE l.recency = 1 AND l.liked IS NOT NULL
+			)
+			SELECT d.recipient_id, d.actor_id, d.liked, r.liked AS mutually_liked, d.created_at, d.decided_at,
+			CASE WHEN d.liked AND r.liked THEN (CASE WHEN d.event_id > r.event_id THEN d.matched_at ELSE r.matched_at END) END AS matched_at,
+			d.previous_liked, d.previous_decided_at, d.undoable
+			FROM latest AS d
+			LEFT JOIN latest AS r ON r.recipient_id = d.actor_id AND r.actor_id = d.recipient_id;
+			`)
+		if err != nil {
+			return err
+		}
+
+		row := tx.QueryRowContext(ctx,
+			`
+			SELECT
+			count(*) FILTER (WHERE d.recipient_id IS NULL),
+			count(*) FILTER (WHERE r.recipient_id IS NULL),
+			count(*) FILTER (
+				WHERE d.recipient_id IS NOT NULL AND r.recipient_id IS NOT NULL
+				AND (d.liked, d.mutually_liked, d.created_at, d.decided_at, d.matched_at, d.previous_liked, d.previous_decided_at, d.undoable)
+				IS DISTINCT FROM (r.liked, r.mutually_liked, r.created_at, r.decided_at, r.matched_at, r.previous_liked, r.previous_decided_at, r.undoable)
+			)
+			FROM decisions AS d
+			FULL OUTER JOIN rebuilt_decisions AS r ON r.recipient_id = d.recipient_id AND r.actor_id = d.actor_id;
+			`)
+		err = row.Scan(&report.Missing, &report.Extra, &report.Mismatched)
+		if err != nil {
+			return err
+		}
+
+		if !repair || report.Consistent() {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`
+			DELETE FROM decisions AS d
+			WHERE NOT EXISTS (
+				SELECT 1 FROM rebuilt_decisions AS r WHERE r.recipient_id = d.recipient_id AND r.actor_id = d.actor_id
+			);
+			`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`
+			INSERT INTO decisions (recipient_id, actor_id, liked, mutually_liked, created_at, decided_at, matched_at, previous_liked, previous_decided_at, undoable, updated_at)
+			SELECT recipient_id, actor_id, liked, mutually_liked, created_at, decided_at, matched_at, previous_liked, previous_decided_at, undoable, now()
+			FROM rebuilt_decisions
+			ON CONFLICT (recipient_id, actor_id)
+			DO UPDATE
+			SET liked = EXCLUDED.liked,
+			mutually_liked = EXCLUDED.mutually_liked,
+			created_at = EXCLUDED.created_at,
+			decided_at = EXCLUDED.decided_at,
+			matched_at = EXCLUDED.matched_at,
+			previous_liked = EXCLUDED.previous_liked,
+			previous_decided_at = EXCLUDED.previous_decided_at,
+			undoable = EXCLUDED.undoable,
+			updated_at = EXCLUDED.updated_at
+			WHERE (decisions.liked, decisions.mutually_liked, decisions.created_at, decisions.decided_at, decisions.matched_at, decisions.previous_liked, decisions.previous_decided_at, decisions.undoable)
+			IS DISTINCT FROM (EXCLUDED.liked, EXCLUDED.mutually_liked, EXCLUDED.created_at, EXCLUDED.decided_at, EXCLUDED.matched_at, EXCLUDED.previous_liked, EXCLUDED.previous_decided_at, EXCLUDED.undoable);
+			`)
+		if err != nil {
+			return err
+		}
+
+		report.Repaired = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different decision")
+
+// RecordIdempotentDecision records the decision like RecordDecision, unless the actor has already recorded a decision
+// with the key within the TTL. The result of that decision is then returned without recording it again, or
+// ErrIdempotencyKeyReused if it was for another recipient or the other way. The key is checked and kept in the same
+// transaction as the decision, so concurrent retries only record it once.
+func (s *Storage) RecordIdempotentDecision(ctx context.Context, key string, ttl time.Duration, recipientID, actorID string, liked bool) (*DecisionResult, error) {
+	var result *DecisionResult
+	err := s.withSerializableTx(ctx, func(tx *sql.Tx) error {
+		// Expired keys of the actor are removed as they are used, so keys can be reused and don't build up
+		_, err := tx.ExecContext(ctx,
+			"DELETE FROM idempotency_keys WHERE actor_id = $1 AND created_at <= now() - make_interval(secs => $2);",
+			actorID, ttl.Seconds())
+		if err != nil {
+			return err
+		}
+
+		var keyRecipientID string
+		var keyLiked bool
+		var encoded []byte
+		row := tx.QueryRowContext(ctx, "SELECT recipient_id, liked, result FROM idempotency_keys WHERE actor_id = $1 AND key = $2;", actorID, key)
+		err = row.Scan(&keyRecipientID, &keyLiked, &encoded)
+		if err == nil {
+			if keyRecipientID != recipientID || keyLiked != liked {
+				return ErrIdempotencyKeyReused
+			}
+			result = &DecisionResult{}
+			return json.Unmarshal(encoded, result)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		result, err = recordDecision(ctx, tx, recipientID, actorID, liked)
+		if err != nil {
+			return err
+		}
+		encoded, err = json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO idempotency_keys (actor_id, key, recipient_id, liked, result, created_at) VALUES ($1, $2, $3, $4, $5, now());",
+			actorID, key, recipientID, liked, encoded)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// PurgeIdempotencyKeys removes up to limit keys of any actor which were kept for longer than the TTL, returning the
+// number removed. Keys are also removed as their actor uses them, but the keys of actors who don't decide again are
+// only removed by purging.
+func (s *Storage) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit uint32) (int, error) {
+	res, err := s.db.ExecContext(ctx,
+		`
+		DELETE FROM idempotency_keys
+		WHERE (actor_id, key) IN (
+			SELECT actor_id, key FROM idempotency_keys WHERE created_at <= now() - make_interval(secs => $1) LIMIT $2
+		);
+		`,
+		ttl.Seconds(), limit)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(deleted), nil
+}
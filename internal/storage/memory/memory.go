@@ -0,0 +1,838 @@
+// Package memory contains an in-memory implementation of the storage used by the API, with the same behaviour as the
+// postgres storage. It is meant for local development and tests which don't need a database.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/storage"
+)
+
+// Store keeps decisions in memory. All of its methods are safe for concurrent use and atomic.
+type Store struct {
+	mu        sync.Mutex
+	lastID    uint64
+	decisions map[pair]*decision
+	blocks    map[block]bool
+	events    []*event
+	// subscriptions are woken by likes, as postgres notifies listeners
+	subscriptions *storage.Subscriptions
+	outbox        []*storage.OutboxEvent
+	lastOutboxID  uint64
+	// relayMu is held while the outbox is relayed, so relays publish events one at a time
+	relayMu          sync.Mutex
+	deadLetters      []*storage.DeadLetter
+	lastDeadLetterID uint64
+	deliveries       []*webhookDelivery
+	lastDeliveryID   uint64
+	idempotencyKeys  map[idempotencyKey]*idempotentDecision
+}
+
+// pair identifies the decision of the actor for the recipient
+type pair struct {
+	recipientID string
+	actorID     string
+}
+
+func (p pair) reverse() pair {
+	return pair{recipientID: p.actorID, actorID: p.recipientID}
+}
+
+// idempotencyKey identifies a decision recorded with an idempotency key, which are unique to each actor
+type idempotencyKey struct {
+	actorID string
+	key     string
+}
+
+// idempotentDecision is a decision recorded with an idempotency key, and its result
+type idempotentDecision struct {
+	recipientID string
+	liked       bool
+	result      storage.DecisionResult
+	createdAt   time.Time
+}
+
+// webhookDelivery is a webhook delivery waiting to be made, and when it can next be attempted
+type webhookDelivery struct {
+	storage.WebhookDelivery
+	nextAttemptAt time.Time
+}
+
+type block struct {
+	blockerID string
+	blockedID string
+}
+
+// event is a change to a decision, with when the decision was matched after the change
+type event struct {
+	storage.DecisionEvent
+	matchedAt *uint64
+}
+
+type decision struct {
+	id                uint64
+	liked             bool
+	mutuallyLiked     *bool
+	createdAt         time.Time
+	decidedAt         time.Time
+	updatedAt         time.Time
+	matchedAt         *time.Time
+	previousLiked     *bool
+	previousDecidedAt *time.Time
+	undoable          bool
+}
+
+func New() *Store {
+	return &Store{
+		decisions:       map[pair]*decision{},
+		blocks:          map[block]bool{},
+		subscriptions:   storage.NewSubscriptions(),
+		idempotencyKeys: map[idempotencyKey]*idempotentDecision{},
+	}
+}
+
+func (s *Store) RecordDecision(ctx context.Context, recipientID, actorID string, liked bool) (*storage.DecisionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.recordDecision(pair{recipientID: recipientID, actorID: actorID}, liked), nil
+}
+
+// RecordIdempotentDecision records the decision like RecordDecision, unless the actor has already recorded a decision
+// with the key within the TTL. The result of that decision is then returned without recording it again, or
+// storage.ErrIdempotencyKeyReused if it was for another recipient or the other way.
+func (s *Store) RecordIdempotentDecision(ctx context.Context, key string, ttl time.Duration, recipientID, actorID string, liked bool) (*storage.DecisionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyKey{actorID: actorID, key: key}
+	if recorded, ok := s.idempotencyKeys[id]; ok && time.Since(recorded.createdAt) < ttl {
+		if recorded.recipientID != recipientID || recorded.liked != liked {
+			return nil, storage.ErrIdempotencyKeyReused
+		}
+		result := recorded.result
+		return &result, nil
+	}
+
+	res := s.recordDecision(pair{recipientID: recipientID, actorID: actorID}, liked)
+	s.idempotencyKeys[id] = &idempotentDecision{
+		recipientID: recipientID,
+		liked:       liked,
+		result:      *res,
+		createdAt:   time.Now(),
+	}
+	return res, nil
+}
+
+// PurgeIdempotencyKeys removes up to limit keys of any actor which were kept for longer than the TTL, returning the
+// number removed
+func (s *Store) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit uint32) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, recorded := range s.idempotencyKeys {
+		if purged >= int(limit) {
+			break
+		}
+		if time.Since(recorded.createdAt) >= ttl {
+			delete(s.idempotencyKeys, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// recordDecision records the decision of the actor for the recipient, with the lock held
+func (s *Store) recordDecision(key pair, liked bool) *storage.DecisionResult {
+	res := &storage.DecisionResult{}
+	blocked := s.isBlocked(key)
+	res.WasMatched = s.isMatched(key)
+
+	// Determine if there is a decision already from the recipient
+	if reverse, ok := s.decisions[key.reverse()]; ok {
+		res.RecipientDecided = true
+		res.RecipientLiked = reverse.liked
+	}
+
+	res.PreviousLiked = s.upsertDecision(key, liked)
+	if res.RecipientDecided {
+		s.syncMutualDecisions(key)
+	}
+
+	// Only changes to the decision are logged
+	if res.PreviousLiked == nil || *res.PreviousLiked != liked {
+		s.recordEvent(key, storage.EventDecided)
+
+		// Other services aren't told about decisions between blocked users, as they are hidden from the blocker
+		if !blocked {
+			eventType := storage.OutboxPassRecorded
+			if liked {
+				eventType = storage.OutboxLikeCreated
+			}
+			s.writeOutbox(key, eventType)
+			s.writeMatchChange(key, res.WasMatched)
+		}
+	}
+
+	// Decisions between blocked users are kept in sync but never reported as mutual, so they don't surface to the blocker.
+	// Only the actor's own decision is reported.
+	if blocked {
+		res = &storage.DecisionResult{PreviousLiked: res.PreviousLiked}
+	}
+	return res
+}
+
+func (s *Store) UndoDecision(ctx context.Context, recipientID, actorID string, window time.Duration) (*storage.UndoResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := pair{recipientID: recipientID, actorID: actorID}
+	d, ok := s.decisions[key]
+	if !ok {
+		return nil, storage.ErrDecisionNotFound
+	}
+	if !d.undoable {
+		return nil, storage.ErrNothingToUndo
+	}
+	now := time.Now()
+	if !d.decidedAt.After(now.Add(-window)) {
+		return nil, storage.ErrUndoWindowExpired
+	}
+	blocked := s.isBlocked(key)
+	wasMatched := s.isMatched(key)
+
+	// Without an earlier decision, undoing the decision removes it and the recipient's decision is no longer mutual
+	if d.previousLiked == nil {
+		delete(s.decisions, key)
+		if reverse, ok := s.decisions[key.reverse()]; ok {
+			reverse.mutuallyLiked = nil
+			reverse.matchedAt = nil
+		}
+		s.recordEvent(key, storage.EventUndone)
+		if !blocked {
+			s.writeMatchChange(key, wasMatched)
+		}
+		return &storage.UndoResult{}, nil
+	}
+
+	d.liked = *d.previousLiked
+	d.decidedAt = *d.previousDecidedAt
+	d.previousLiked = nil
+	d.previousDecidedAt = nil
+	d.undoable = false
+	d.updatedAt = now
+	s.syncMutualDecisions(key)
+	s.recordEvent(key, storage.EventUndone)
+	if !blocked {
+		s.writeMatchChange(key, wasMatched)
+	}
+
+	return &storage.UndoResult{
+		Restored: true,
+		Liked:    d.liked,
+	}, nil
+}
+
+func (s *Store) Unmatch(ctx context.Context, userID, matchedUserID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := pair{recipientID: matchedUserID, actorID: userID}
+	if !s.isMatched(key) {
+		return storage.ErrMatchNotFound
+	}
+	s.endMatch(key)
+
+	// A match between blocked users was formed after the block, so other services were never told about it
+	if !s.isBlocked(key) {
+		s.writeOutbox(key, storage.OutboxUnmatched)
+	}
+	return nil
+}
+
+func (s *Store) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := pair{recipientID: blockedID, actorID: blockerID}
+	wasBlocked := s.isBlocked(key)
+	s.blocks[block{blockerID: blockerID, blockedID: blockedID}] = true
+
+	// Blocking ends any match between the users
+	if s.isMatched(key) {
+		s.endMatch(key)
+		if !wasBlocked {
+			s.writeOutbox(key, storage.OutboxUnmatched)
+		}
+	}
+	return nil
+}
+
+func (s *Store) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := block{blockerID: blockerID, blockedID: blockedID}
+	if !s.blocks[b] {
+		return storage.ErrBlockNotFound
+	}
+	delete(s.blocks, b)
+	return nil
+}
+
+func (s *Store) GetLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listLikers(recipientID, liked, false, sort, cursor, limit)
+}
+
+func (s *Store) GetNewLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listLikers(recipientID, liked, true, sort, cursor, limit)
+}
+
+func (s *Store) GetLikedDecisionsCount(ctx context.Context, recipientID string, liked bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for key, d := range s.decisions {
+		if key.recipientID == recipientID && d.liked == liked && !s.isBlocked(key) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) GetMatches(ctx context.Context, userID string, token *uint64, limit *uint32) ([]*storage.Match, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A match is a decision for the user which they have liked in return
+	var cursor *storage.Cursor
+	if token != nil {
+		cursor = &storage.Cursor{ID: *token}
+	}
+	keys, err := s.page(func(key pair, d *decision) bool {
+		return key.recipientID == userID && d.liked && d.mutuallyLiked != nil && *d.mutuallyLiked
+	}, storage.SortID, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*storage.Match
+	for _, key := range keys {
+		d := s.decisions[key]
+		matches = append(matches, &storage.Match{
+			ID:        d.id,
+			UserID:    key.actorID,
+			MatchedAt: uint64(d.matchedAt.Unix()),
+		})
+	}
+	return matches, nil
+}
+
+func (s *Store) GetDecisionHistory(ctx context.Context, actorID string, recipientID *string, token *uint64, limit *uint32) ([]*storage.DecisionEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*storage.DecisionEvent
+	for _, event := range s.events {
+		if limit != nil && len(events) == int(*limit) {
+			break
+		}
+		if event.ActorID != actorID || (recipientID != nil && event.RecipientID != *recipientID) || (token != nil && event.ID <= *token) {
+			continue
+		}
+		copied := event.DecisionEvent
+		events = append(events, &copied)
+	}
+	return events, nil
+}
+
+// RelayOutbox publishes up to limit events from the outbox in the order they were written, removing each one
+// published, and returns the number published. It stops at the first event which fails to publish.
+func (s *Store) RelayOutbox(ctx context.Context, limit uint32, publish func(context.Context, *storage.OutboxEvent) error) (int, error) {
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+
+	// Events are published without holding the lock of the store, so publishing doesn't hold up decisions. Only the
+	// relay removes events, so the events read are still first once they have been published.
+	s.mu.Lock()
+	events := slices.Clone(s.outbox[:min(int(limit), len(s.outbox))])
+	s.mu.Unlock()
+
+	published := 0
+	var err error
+	for _, event := range events {
+		copied := *event
+		err = publish(ctx, &copied)
+		if err != nil {
+			break
+		}
+		published++
+	}
+
+	s.mu.Lock()
+	s.outbox = s.outbox[published:]
+	s.mu.Unlock()
+	return published, err
+}
+
+// GetDeadLetters lists the dead letters after the one with the ID, oldest first, optionally only for one subscription
+func (s *Store) GetDeadLetters(ctx context.Context, subscription *string, after uint64, limit uint32) ([]*storage.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var letters []*storage.DeadLetter
+	for _, letter := range s.deadLetters {
+		if len(letters) == int(limit) {
+			break
+		}
+		if letter.ID <= after || (subscription != nil && letter.Subscription != *subscription) {
+			continue
+		}
+		copied := *letter
+		letters = append(letters, &copied)
+	}
+	return letters, nil
+}
+
+// DeleteDeadLetter removes a dead letter once it has been delivered
+func (s *Store) DeleteDeadLetter(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := slices.IndexFunc(s.deadLetters, func(letter *storage.DeadLetter) bool {
+		return letter.ID == id
+	})
+	if index < 0 {
+		return storage.ErrDeadLetterNotFound
+	}
+	s.deadLetters = slices.Delete(s.deadLetters, index, index+1)
+	return nil
+}
+
+// RecordDeadLetterAttempt records another failed attempt to deliver a dead letter
+func (s *Store) RecordDeadLetterAttempt(ctx context.Context, id uint64, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := slices.IndexFunc(s.deadLetters, func(letter *storage.DeadLetter) bool {
+		return letter.ID == id
+	})
+	if index < 0 {
+		return storage.ErrDeadLetterNotFound
+	}
+	letter := s.deadLetters[index]
+	letter.Attempts++
+	letter.LastError = lastError
+	letter.FailedAt = uint64(time.Now().Unix())
+	return nil
+}
+
+// AddWebhookDeliveries queues the event to be delivered to each of the subscriptions. An event already queued for a
+// subscription isn't queued again.
+func (s *Store) AddWebhookDeliveries(ctx context.Context, subscriptions []string, event *storage.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, subscription := range subscriptions {
+		queued := slices.ContainsFunc(s.deliveries, func(delivery *webhookDelivery) bool {
+			return delivery.Subscription == subscription && delivery.Event.ID == event.ID
+		})
+		if queued {
+			continue
+		}
+		s.lastDeliveryID++
+		s.deliveries = append(s.deliveries, &webhookDelivery{
+			WebhookDelivery: storage.WebhookDelivery{
+				ID:           s.lastDeliveryID,
+				Subscription: subscription,
+				Event:        *event,
+			},
+			nextAttemptAt: now,
+		})
+	}
+	return nil
+}
+
+// ClaimWebhookDelivery returns the oldest delivery queued for the subscription if its next attempt is due, or nil if
+// there isn't one due, moving its next attempt back by the lease
+func (s *Store) ClaimWebhookDelivery(ctx context.Context, subscription string, lease time.Duration) (*storage.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := slices.IndexFunc(s.deliveries, func(delivery *webhookDelivery) bool {
+		return delivery.Subscription == subscription
+	})
+	now := time.Now()
+	if index < 0 || s.deliveries[index].nextAttemptAt.After(now) {
+		return nil, nil
+	}
+	delivery := s.deliveries[index]
+	delivery.nextAttemptAt = now.Add(lease)
+	copied := delivery.WebhookDelivery
+	return &copied, nil
+}
+
+// DeleteWebhookDelivery removes a delivery once it has been delivered
+func (s *Store) DeleteWebhookDelivery(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.deliveryIndex(id)
+	if index < 0 {
+		return storage.ErrWebhookDeliveryNotFound
+	}
+	s.deliveries = slices.Delete(s.deliveries, index, index+1)
+	return nil
+}
+
+// RetryWebhookDelivery records a failed attempt at a delivery, which is attempted again after the backoff
+func (s *Store) RetryWebhookDelivery(ctx context.Context, id uint64, lastError string, backoff time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.deliveryIndex(id)
+	if index < 0 {
+		return storage.ErrWebhookDeliveryNotFound
+	}
+	delivery := s.deliveries[index]
+	delivery.Attempts++
+	delivery.LastError = lastError
+	delivery.nextAttemptAt = time.Now().Add(backoff)
+	return nil
+}
+
+// DeadLetterWebhookDelivery records the last failed attempt at a delivery, and moves it to the dead letters
+func (s *Store) DeadLetterWebhookDelivery(ctx context.Context, id uint64, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.deliveryIndex(id)
+	if index < 0 {
+		return storage.ErrWebhookDeliveryNotFound
+	}
+	delivery := s.deliveries[index]
+	s.deliveries = slices.Delete(s.deliveries, index, index+1)
+
+	s.lastDeadLetterID++
+	s.deadLetters = append(s.deadLetters, &storage.DeadLetter{
+		ID:           s.lastDeadLetterID,
+		Subscription: delivery.Subscription,
+		Event:        delivery.Event,
+		Attempts:     delivery.Attempts + 1,
+		LastError:    lastError,
+		FailedAt:     uint64(time.Now().Unix()),
+	})
+	return nil
+}
+
+// deliveryIndex returns the index of the delivery with the ID, or -1 if there isn't one
+func (s *Store) deliveryIndex(id uint64) int {
+	return slices.IndexFunc(s.deliveries, func(delivery *webhookDelivery) bool {
+		return delivery.ID == id
+	})
+}
+
+func (s *Store) GetLikeEvents(ctx context.Context, userID string, after uint64, limit uint32) ([]*storage.LikeEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*storage.LikeEvent
+	for _, e := range s.events[min(int(after), len(s.events)):] {
+		if len(events) == int(limit) {
+			break
+		}
+		likeEvent, ok := s.likeEvent(e, userID)
+		if ok && !s.isBlocked(pair{recipientID: e.RecipientID, actorID: e.ActorID}) {
+			events = append(events, likeEvent)
+		}
+	}
+	return events, nil
+}
+
+func (s *Store) GetLastLikeEventID(ctx context.Context, userID string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if _, ok := s.likeEvent(s.events[i], userID); ok {
+			return s.events[i].ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// Subscribe returns a channel which receives a value whenever the user may have new like events, and a function to
+// unsubscribe
+func (s *Store) Subscribe(userID string) (<-chan struct{}, func()) {
+	return s.subscriptions.Subscribe(userID)
+}
+
+// likeEvent returns the event as a like event of the user, false if it isn't a like of the user or a match formed by
+// their like
+func (s *Store) likeEvent(e *event, userID string) (*storage.LikeEvent, bool) {
+	if e.Type != storage.EventDecided || e.Liked == nil || !*e.Liked {
+		return nil, false
+	}
+
+	likeEvent := &storage.LikeEvent{
+		ID:        e.ID,
+		MatchedAt: e.matchedAt,
+		CreatedAt: e.CreatedAt,
+	}
+	switch {
+	case e.RecipientID == userID:
+		likeEvent.UserID = e.ActorID
+	case e.ActorID == userID && e.matchedAt != nil:
+		likeEvent.UserID = e.RecipientID
+	default:
+		return nil, false
+	}
+	return likeEvent, true
+}
+
+// listLikers lists the decisions for the recipient in the order of the sort. If onlyNew is set, decisions the recipient
+// has given a decision for in return are left out.
+func (s *Store) listLikers(recipientID string, liked, onlyNew bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error) {
+	keys, err := s.page(func(key pair, d *decision) bool {
+		return key.recipientID == recipientID && d.liked == liked && (!onlyNew || d.mutuallyLiked == nil)
+	}, sort, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var likers []*storage.Liker
+	for _, key := range keys {
+		d := s.decisions[key]
+		var matchedAt *uint64
+		if d.matchedAt != nil {
+			unix := uint64(d.matchedAt.Unix())
+			matchedAt = &unix
+		}
+		likers = append(likers, &storage.Liker{
+			ID:        d.id,
+			ActorID:   key.actorID,
+			UpdatedAt: uint64(d.updatedAt.Unix()),
+			CreatedAt: uint64(d.createdAt.Unix()),
+			DecidedAt: uint64(d.decidedAt.Unix()),
+			MatchedAt: matchedAt,
+			Cursor:    d.cursor(sort),
+		})
+	}
+	return likers, nil
+}
+
+// page returns the decisions between users who haven't blocked each other which match the filter, in the order of the
+// sort and starting after the cursor
+func (s *Store) page(filter func(key pair, d *decision) bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]pair, error) {
+	switch sort {
+	case storage.SortID, storage.SortUpdatedAt, storage.SortMatchedAt:
+	default:
+		return nil, fmt.Errorf("%w %v", storage.ErrUnknownSort, sort)
+	}
+
+	var keys []pair
+	for key, d := range s.decisions {
+		if filter(key, d) && !s.isBlocked(key) && (cursor == nil || compareCursors(d.cursor(sort), *cursor) < 0) {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b pair) int {
+		return compareCursors(s.decisions[b].cursor(sort), s.decisions[a].cursor(sort))
+	})
+
+	if limit != nil && len(keys) > int(*limit) {
+		keys = keys[:*limit]
+	}
+	return keys, nil
+}
+
+// cursor returns the position of the decision in a list with the sort. Times are compared in microseconds, the
+// precision postgres stores them with.
+func (d *decision) cursor(sort storage.Sort) storage.Cursor {
+	cursor := storage.Cursor{
+		ID: d.id,
+	}
+	switch sort {
+	case storage.SortUpdatedAt:
+		micro := d.updatedAt.UnixMicro()
+		cursor.Time = &micro
+	case storage.SortMatchedAt:
+		if d.matchedAt != nil {
+			micro := d.matchedAt.UnixMicro()
+			cursor.Time = &micro
+		}
+	}
+	return cursor
+}
+
+// compareCursors orders cursors by time then by ID, where a cursor without a time is before every time
+func compareCursors(a, b storage.Cursor) int {
+	switch {
+	case a.Time == nil && b.Time != nil:
+		return -1
+	case a.Time != nil && b.Time == nil:
+		return 1
+	case a.Time != nil && b.Time != nil && *a.Time != *b.Time:
+		return cmp.Compare(*a.Time, *b.Time)
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// upsertDecision stores the decision of the actor for the recipient without updating the recipient's decision,
+// returning the decision it replaced or nil if there wasn't one
+func (s *Store) upsertDecision(key pair, liked bool) *bool {
+	now := time.Now()
+	d, ok := s.decisions[key]
+	if !ok {
+		s.lastID++
+		s.decisions[key] = &decision{
+			id:        s.lastID,
+			liked:     liked,
+			createdAt: now,
+			decidedAt: now,
+			updatedAt: now,
+			undoable:  true,
+		}
+		return nil
+	}
+
+	previous := d.liked
+	// Decided and updated at only move when the decision changes, so repeating a decision doesn't make it look new.
+	// A changed decision keeps the one it replaced so it can be undone.
+	if d.liked != liked {
+		previousDecidedAt := d.decidedAt
+		d.previousLiked = &previous
+		d.previousDecidedAt = &previousDecidedAt
+		d.decidedAt = now
+		d.updatedAt = now
+		d.undoable = true
+	}
+	d.liked = liked
+	return &previous
+}
+
+// syncMutualDecisions sets the mutually liked flag of both decisions between two users from the other's decision,
+// and the matched at time of both decisions when they like each other. The updated at time is left alone, as it is
+// when the actor changed the decision rather than when the other user answered it.
+func (s *Store) syncMutualDecisions(key pair) {
+	d, ok := s.decisions[key]
+	if !ok {
+		return
+	}
+	reverse, ok := s.decisions[key.reverse()]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	for _, sides := range [][2]*decision{{d, reverse}, {reverse, d}} {
+		own, other := sides[0], sides[1]
+		mutuallyLiked := other.liked
+		own.mutuallyLiked = &mutuallyLiked
+
+		if !own.liked || !other.liked {
+			own.matchedAt = nil
+		} else if own.matchedAt == nil {
+			matchedAt := now
+			own.matchedAt = &matchedAt
+		}
+	}
+}
+
+func (s *Store) isMatched(key pair) bool {
+	d, ok := s.decisions[key]
+	return ok && d.matchedAt != nil
+}
+
+// endMatch records a pass of the actor for the recipient which can't be undone, ending any match between them
+func (s *Store) endMatch(key pair) {
+	s.upsertDecision(key, false)
+
+	d := s.decisions[key]
+	d.previousLiked = nil
+	d.previousDecidedAt = nil
+	d.undoable = false
+
+	s.syncMutualDecisions(key)
+	s.recordEvent(key, storage.EventUnmatched)
+}
+
+// writeOutbox writes an event about the decision of the actor for the recipient to the outbox
+func (s *Store) writeOutbox(key pair, eventType string) {
+	s.lastOutboxID++
+	s.outbox = append(s.outbox, &storage.OutboxEvent{
+		ID:          s.lastOutboxID,
+		Type:        eventType,
+		RecipientID: key.recipientID,
+		ActorID:     key.actorID,
+		CreatedAt:   uint64(time.Now().Unix()),
+	})
+}
+
+// writeMatchChange writes a match or unmatch event to the outbox if the decision of the actor has formed or ended a
+// match with the recipient
+func (s *Store) writeMatchChange(key pair, wasMatched bool) {
+	matched := s.isMatched(key)
+	if matched == wasMatched {
+		return
+	}
+	if matched {
+		s.writeOutbox(key, storage.OutboxMatchCreated)
+		return
+	}
+	s.writeOutbox(key, storage.OutboxUnmatched)
+}
+
+func (s *Store) isBlocked(key pair) bool {
+	return s.blocks[block{blockerID: key.recipientID, blockedID: key.actorID}] ||
+		s.blocks[block{blockerID: key.actorID, blockedID: key.recipientID}]
+}
+
+// recordEvent appends the current decision of the actor for the recipient to the event log. Likes wake the
+// subscribers of the recipient, and of the actor too if they formed a match.
+func (s *Store) recordEvent(key pair, eventType string) {
+	var liked *bool
+	var matchedAt *uint64
+	if d, ok := s.decisions[key]; ok {
+		decided := d.liked
+		liked = &decided
+		if d.matchedAt != nil {
+			unix := uint64(d.matchedAt.Unix())
+			matchedAt = &unix
+		}
+	}
+
+	s.events = append(s.events, &event{
+		DecisionEvent: storage.DecisionEvent{
+			ID:          uint64(len(s.events) + 1),
+			RecipientID: key.recipientID,
+			ActorID:     key.actorID,
+			Type:        eventType,
+			Liked:       liked,
+			CreatedAt:   uint64(time.Now().Unix()),
+		},
+		matchedAt: matchedAt,
+	})
+
+	if eventType != storage.EventDecided || liked == nil || !*liked {
+		return
+	}
+	s.subscriptions.Notify(key.recipientID)
+	if matchedAt != nil {
+		s.subscriptions.Notify(key.actorID)
+	}
+}
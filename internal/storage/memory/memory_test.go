@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/neiln3121/explore-service/internal/api"
+	"github.com/neiln3121/explore-service/internal/storage/memory"
+	"github.com/neiln3121/explore-service/internal/storage/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) api.Store {
+		return memory.New()
+	})
+}
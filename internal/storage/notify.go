@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// likesChannel is the channel transactions recording a like notify on, with the ID of a user the like is for as
+// payload. Notifications are only delivered once the transaction commits.
+const likesChannel = "likes"
+
+const (
+	listenerMinReconnect = time.Second
+	listenerMaxReconnect = time.Minute
+)
+
+// Subscriptions wakes the subscribers of a user when there may be new like events for them. Notifications carry no
+// data, subscribers read the events themselves, so notifications sent before a subscriber has woken are merged.
+type Subscriptions struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+func NewSubscriptions() *Subscriptions {
+	return &Subscriptions{
+		subscribers: map[string]map[chan struct{}]struct{}{},
+	}
+}
+
+// Subscribe returns a channel which receives a value whenever the user may have new like events, and a function to
+// unsubscribe
+func (s *Subscriptions) Subscribe(userID string) (<-chan struct{}, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = map[chan struct{}]struct{}{}
+	}
+	s.subscribers[userID][ch] = struct{}{}
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.subscribers[userID], ch)
+		if len(s.subscribers[userID]) == 0 {
+			delete(s.subscribers, userID)
+		}
+	}
+}
+
+// Notify wakes the subscribers of the user
+func (s *Subscriptions) Notify(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.subscribers[userID] {
+		wake(ch)
+	}
+}
+
+// NotifyAll wakes every subscriber, for when notifications may have been missed
+func (s *Subscriptions) NotifyAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, subscribers := range s.subscribers {
+		for ch := range subscribers {
+			wake(ch)
+		}
+	}
+}
+
+// wake sends to the channel unless it already has a value waiting to be received
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Listener listens for the notifications sent by transactions recording likes, and passes them on to the
+// subscribers of the users they are for
+type Listener struct {
+	*Subscriptions
+	listener *pq.Listener
+}
+
+// NewListener creates a listener on its own connection to the database, separate from the connection pool, as a
+// listening connection can't be shared. It reconnects whenever the connection is lost.
+func NewListener(connString string, logger *slog.Logger) *Listener {
+	return &Listener{
+		Subscriptions: NewSubscriptions(),
+		listener: pq.NewListener(connString, listenerMinReconnect, listenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+			switch event {
+			case pq.ListenerEventDisconnected:
+				logger.Warn("lost connection listening for likes", "error", err)
+			case pq.ListenerEventConnectionAttemptFailed:
+				logger.Warn("failed to connect to listen for likes", "error", err)
+			case pq.ListenerEventReconnected:
+				logger.Info("reconnected to listen for likes")
+			}
+		}),
+	}
+}
+
+// Run passes notifications on to subscribers until the context is done. Notifications sent while the connection was
+// lost can't be received, so every subscriber is woken when it is reconnected.
+func (l *Listener) Run(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		l.listener.Close()
+	}()
+
+	// Listen waits for the connection, which may not be up yet
+	err := l.listener.Listen(likesChannel)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	for notification := range l.listener.Notify {
+		if notification == nil {
+			l.NotifyAll()
+			continue
+		}
+		l.Notify(notification.Extra)
+	}
+	return nil
+}
+
+// notifyLike notifies the listeners of the user of a new like once the transaction commits
+func notifyLike(ctx context.Context, tx *sql.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2);", likesChannel, userID)
+	return err
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Outbox event types, written to the outbox for other services when decisions change
+const (
+	// OutboxLikeCreated is a new like, or a pass changed to a like
+	OutboxLikeCreated = "like_created"
+	// OutboxPassRecorded is a new pass, or a like changed to a pass
+	OutboxPassRecorded = "pass_recorded"
+	// OutboxMatchCreated is a match formed by the actor's decision
+	OutboxMatchCreated = "match_created"
+	// OutboxUnmatched is a match ended by the actor, by unmatching, blocking, passing or undoing their like
+	OutboxUnmatched = "unmatched"
+)
+
+// OutboxEvent is an event for other services about the decision of the actor for the recipient
+type OutboxEvent struct {
+	ID          uint64
+	Type        string
+	RecipientID string
+	ActorID     string
+	CreatedAt   uint64
+}
+
+// writeOutbox writes an event to the outbox. It must be called in the same transaction as the change it describes, so
+// the event is published if and only if the change is committed.
+func writeOutbox(ctx context.Context, tx *sql.Tx, recipientID, actorID, eventType string) error {
+	// Events between the same users are written one transaction at a time, so they are published in order
+	err := lockUsers(ctx, tx, recipientID, actorID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO outbox (event_type, recipient_id, actor_id, created_at) VALUES ($1, $2, $3, now());",
+		eventType, recipientID, actorID)
+	return err
+}
+
+// writeMatchChange writes a match or unmatch event to the outbox if the decision of the actor has formed or ended a
+// match with the recipient
+func writeMatchChange(ctx context.Context, tx *sql.Tx, recipientID, actorID string, wasMatched bool) error {
+	matched, err := isMatched(ctx, tx, recipientID, actorID)
+	if err != nil || matched == wasMatched {
+		return err
+	}
+	if matched {
+		return writeOutbox(ctx, tx, recipientID, actorID, OutboxMatchCreated)
+	}
+	return writeOutbox(ctx, tx, recipientID, actorID, OutboxUnmatched)
+}
+
+// RelayOutbox publishes up to limit events from the outbox in the order they were written, removing each one
+// published, and returns the number published. It stops at the first event which fails to publish, so no event is
+// published before an earlier one. Events are locked while they are published, so concurrent relays wait for each
+// other rather than publishing the same events. An event may be published again if it can't be removed.
+func (s *Storage) RelayOutbox(ctx context.Context, limit uint32, publish func(context.Context, *OutboxEvent) error) (int, error) {
+	var published []int64
+	var publishErr error
+	err := s.withTx(ctx, nil, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			"SELECT id, event_type, recipient_id, actor_id, created_at FROM outbox ORDER BY id ASC LIMIT $1 FOR UPDATE;",
+			limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var events []*OutboxEvent
+		for rows.Next() {
+			var event OutboxEvent
+			var createdAt time.Time
+			err := rows.Scan(&event.ID, &event.Type, &event.RecipientID, &event.ActorID, &createdAt)
+			if err != nil {
+				return err
+			}
+			event.CreatedAt = uint64(createdAt.Unix())
+			events = append(events, &event)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			publishErr = publish(ctx, event)
+			if publishErr != nil {
+				break
+			}
+			published = append(published, int64(event.ID))
+		}
+		if len(published) == 0 {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM outbox WHERE id = ANY($1);", pq.Array(published))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(published), publishErr
+}
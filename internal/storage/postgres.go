@@ -4,13 +4,37 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
+	"math/rand/v2"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
 )
 
-var ErrDecisionNotFound = errors.New("no decisions found for recipient")
+var (
+	ErrDecisionNotFound  = errors.New("no decisions found for recipient")
+	ErrNothingToUndo     = errors.New("last decision has already been undone")
+	ErrUndoWindowExpired = errors.New("last decision is too old to undo")
+	ErrMatchNotFound     = errors.New("users have not matched")
+	ErrBlockNotFound     = errors.New("user has not been blocked")
+)
+
+// notBlocked filters out decisions between users where either has blocked the other
+const notBlocked = `NOT EXISTS (
+	SELECT 1 FROM blocks 
+	WHERE (blocks.blocker_id = decisions.recipient_id AND blocks.blocked_id = decisions.actor_id)
+	OR (blocks.blocker_id = decisions.actor_id AND blocks.blocked_id = decisions.recipient_id)
+)`
+
+const (
+	// maxTxAttempts is the number of times a serializable transaction is attempted before giving up
+	maxTxAttempts = 10
+	// txRetryBackoff is the upper bound of the random wait before retrying, multiplied by the attempt number
+	txRetryBackoff = 5 * time.Millisecond
+
+	serializationFailure pq.ErrorCode = "40001"
+	deadlockDetected     pq.ErrorCode = "40P01"
+)
 
 type Storage struct {
 	db *sql.DB
@@ -26,61 +50,319 @@ type Liker struct {
 	ID        uint64
 	ActorID   string
 	UpdatedAt uint64
+	// CreatedAt is when the actor first gave a decision for the recipient
+	CreatedAt uint64
+	// DecidedAt is when the actor last changed their decision
+	DecidedAt uint64
+	// MatchedAt is when both users liked each other, nil if they haven't
+	MatchedAt *uint64
+	// Cursor is the position of the decision in the list it was listed in
+	Cursor Cursor
 }
 
-func (s *Storage) PutDecision(ctx context.Context, recipientID, actorID string, liked bool) error {
-	_, err := s.db.ExecContext(ctx,
-		`
-		INSERT INTO decisions (recipient_id, actor_id, liked, updated_at) 
-		VALUES ($1, $2, $3, now())
-		ON CONFLICT (recipient_id, actor_id) 
-		DO UPDATE 
-		SET (recipient_id, actor_id, liked, updated_at) = ($1, $2, $3, now());
-		`,
-		recipientID, actorID, liked)
-	if err != nil {
+// Match is a user who has been mutually liked
+type Match struct {
+	ID        uint64
+	UserID    string
+	MatchedAt uint64
+}
+
+// DecisionResult describes the recipient's decision on the actor at the point the actor's decision was recorded
+type DecisionResult struct {
+	// RecipientDecided is true if the recipient had already given a decision for the actor
+	RecipientDecided bool
+	// RecipientLiked is the recipient's decision for the actor, only set if RecipientDecided is true
+	RecipientLiked bool
+	// WasMatched is true if the users had matched before the decision
+	WasMatched bool
+	// PreviousLiked is the actor's decision for the recipient before this one, nil if it is their first
+	PreviousLiked *bool
+}
+
+// RecordDecision stores the decision of the actor for the recipient and, if the recipient has already given a decision for the actor,
+// sets the mutually liked flag and matched at time on both decisions. The read of the recipient's decision and the writes happen in one serializable
+// transaction so two users deciding on each other at the same time can't both be treated as the first to decide.
+func (s *Storage) RecordDecision(ctx context.Context, recipientID, actorID string, liked bool) (*DecisionResult, error) {
+	var result *DecisionResult
+	err := s.withSerializableTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		result, err = recordDecision(ctx, tx, recipientID, actorID, liked)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return result, nil
 }
 
-func (s *Storage) PutMutualDecisions(ctx context.Context, recipientID, actorID string, actorLiked, recipientLiked bool) error {
-	// In one transaction, insert new decision for recipient and update mutual decision on actor. We use a transaction so we don't go out of sync on error
-	tx, err := s.db.BeginTx(ctx, nil)
+// recordDecision records the decision in the transaction, which must be serializable
+func recordDecision(ctx context.Context, tx *sql.Tx, recipientID, actorID string, liked bool) (*DecisionResult, error) {
+	res := &DecisionResult{}
+
+	blocked, err := isBlocked(ctx, tx, recipientID, actorID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	res.WasMatched, err = isMatched(ctx, tx, recipientID, actorID)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = tx.ExecContext(ctx,
-		`
-		INSERT INTO decisions (recipient_id, actor_id, liked, mutually_liked, updated_at) 
-		VALUES ($1, $2, $3, $4, now())
-		ON CONFLICT (recipient_id, actor_id) 
-		DO UPDATE 
-		SET (recipient_id, actor_id, liked, mutually_liked, updated_at) = ($1, $2, $3, $4, now());
-		`,
-		recipientID, actorID, actorLiked, recipientLiked)
+	// Determine if there is a decision already from the recipient
+	row := tx.QueryRowContext(ctx, "SELECT liked FROM decisions WHERE recipient_id = $1 AND actor_id = $2;", actorID, recipientID)
+	err = row.Scan(&res.RecipientLiked)
+	if err == nil {
+		res.RecipientDecided = true
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	res.PreviousLiked, err = upsertDecision(ctx, tx, recipientID, actorID, liked)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = tx.ExecContext(ctx,
-		`
-		UPDATE decisions 
-		SET mutually_liked = $3,
-		updated_at = now()
-		WHERE recipient_id = $1 AND actor_id = $2;
-		`,
-		actorID, recipientID, recipientLiked)
+	if res.RecipientDecided {
+		err = syncMutualDecisions(ctx, tx, recipientID, actorID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only changes to the decision are logged
+	if res.PreviousLiked == nil || *res.PreviousLiked != liked {
+		err = recordEvent(ctx, tx, recipientID, actorID, EventDecided)
+		if err != nil {
+			return nil, err
+		}
+
+		// Other services aren't told about decisions between blocked users, as they are hidden from the blocker
+		if !blocked {
+			eventType := OutboxPassRecorded
+			if liked {
+				eventType = OutboxLikeCreated
+			}
+			err = writeOutbox(ctx, tx, recipientID, actorID, eventType)
+			if err != nil {
+				return nil, err
+			}
+			err = writeMatchChange(ctx, tx, recipientID, actorID, res.WasMatched)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Decisions between blocked users are kept in sync but never reported as mutual, so they don't surface to the blocker.
+	// Only the actor's own decision is reported.
+	if blocked {
+		res = &DecisionResult{PreviousLiked: res.PreviousLiked}
+	}
+
+	return res, nil
+}
+
+// UndoResult is the decision of the actor for the recipient after their last decision was undone
+type UndoResult struct {
+	// Restored is true if an earlier decision was restored, false if the actor has no decision for the recipient anymore
+	Restored bool
+	// Liked is the restored decision, only set if Restored is true
+	Liked bool
+}
+
+// UndoDecision reverts the last decision of the actor for the recipient to the decision it replaced, removing the decision if there was none.
+// The decision can only be undone once, and only if it was made within the window. The mutually liked flag and matched at time of the
+// recipient's decision for the actor are updated to match.
+func (s *Storage) UndoDecision(ctx context.Context, recipientID, actorID string, window time.Duration) (*UndoResult, error) {
+	var result *UndoResult
+	err := s.withSerializableTx(ctx, func(tx *sql.Tx) error {
+		var previousLiked sql.NullBool
+		var undoable, withinWindow bool
+		row := tx.QueryRowContext(ctx,
+			`
+			SELECT previous_liked, undoable, decided_at > now() - make_interval(secs => $3)
+			FROM decisions 
+			WHERE recipient_id = $1 AND actor_id = $2;
+			`,
+			recipientID, actorID, window.Seconds())
+		err := row.Scan(&previousLiked, &undoable, &withinWindow)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrDecisionNotFound
+			}
+			return err
+		}
+		if !undoable {
+			return ErrNothingToUndo
+		}
+		if !withinWindow {
+			return ErrUndoWindowExpired
+		}
+		blocked, err := isBlocked(ctx, tx, recipientID, actorID)
+		if err != nil {
+			return err
+		}
+		wasMatched, err := isMatched(ctx, tx, recipientID, actorID)
+		if err != nil {
+			return err
+		}
+
+		// Without an earlier decision, undoing the decision removes it and the recipient's decision is no longer mutual
+		if !previousLiked.Valid {
+			_, err = tx.ExecContext(ctx, "DELETE FROM decisions WHERE recipient_id = $1 AND actor_id = $2;", recipientID, actorID)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx,
+				`
+				UPDATE decisions 
+				SET mutually_liked = NULL,
+				matched_at = NULL
+				WHERE recipient_id = $1 AND actor_id = $2;
+				`,
+				actorID, recipientID)
+			if err != nil {
+				return err
+			}
+
+			err = recordEvent(ctx, tx, recipientID, actorID, EventUndone)
+			if err != nil {
+				return err
+			}
+			if !blocked {
+				err = writeMatchChange(ctx, tx, recipientID, actorID, wasMatched)
+				if err != nil {
+					return err
+				}
+			}
+
+			result = &UndoResult{}
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`
+			UPDATE decisions 
+			SET liked = previous_liked,
+			decided_at = previous_decided_at,
+			previous_liked = NULL,
+			previous_decided_at = NULL,
+			undoable = FALSE,
+			updated_at = now()
+			WHERE recipient_id = $1 AND actor_id = $2;
+			`,
+			recipientID, actorID)
+		if err != nil {
+			return err
+		}
+
+		err = syncMutualDecisions(ctx, tx, recipientID, actorID)
+		if err != nil {
+			return err
+		}
+
+		err = recordEvent(ctx, tx, recipientID, actorID, EventUndone)
+		if err != nil {
+			return err
+		}
+		if !blocked {
+			err = writeMatchChange(ctx, tx, recipientID, actorID, wasMatched)
+			if err != nil {
+				return err
+			}
+		}
+
+		result = &UndoResult{
+			Restored: true,
+			Liked:    previousLiked.Bool,
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return result, nil
+}
 
-	return tx.Commit()
+// Unmatch ends the match between the user and the matched user by recording a pass of the user for the matched user,
+// which can't be undone
+func (s *Storage) Unmatch(ctx context.Context, userID, matchedUserID string) error {
+	return s.withSerializableTx(ctx, func(tx *sql.Tx) error {
+		matched, err := isMatched(ctx, tx, matchedUserID, userID)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			return ErrMatchNotFound
+		}
+
+		err = endMatch(ctx, tx, matchedUserID, userID)
+		if err != nil {
+			return err
+		}
+
+		// A match between blocked users was formed after the block, so other services were never told about it
+		blocked, err := isBlocked(ctx, tx, matchedUserID, userID)
+		if err != nil || blocked {
+			return err
+		}
+		return writeOutbox(ctx, tx, matchedUserID, userID, OutboxUnmatched)
+	})
+}
+
+// BlockUser stops decisions between the blocker and the blocked user from being listed or counted, and ends any match between them
+func (s *Storage) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	return s.withSerializableTx(ctx, func(tx *sql.Tx) error {
+		wasBlocked, err := isBlocked(ctx, tx, blockedID, blockerID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`
+			INSERT INTO blocks (blocker_id, blocked_id, created_at) 
+			VALUES ($1, $2, now())
+			ON CONFLICT (blocker_id, blocked_id) 
+			DO NOTHING;
+			`,
+			blockerID, blockedID)
+		if err != nil {
+			return err
+		}
+
+		matched, err := isMatched(ctx, tx, blockedID, blockerID)
+		if err != nil || !matched {
+			return err
+		}
+		err = endMatch(ctx, tx, blockedID, blockerID)
+		if err != nil || wasBlocked {
+			return err
+		}
+		return writeOutbox(ctx, tx, blockedID, blockerID, OutboxUnmatched)
+	})
+}
+
+// UnblockUser removes the block of the blocker on the blocked user
+func (s *Storage) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	return s.withSerializableTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2;", blockerID, blockedID)
+		if err != nil {
+			return err
+		}
+		deleted, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrBlockNotFound
+		}
+		return nil
+	})
 }
 
-func (s *Storage) GetLikedDecisions(ctx context.Context, recipientID string, liked bool, token *uint64, limit *uint32) ([]*Liker, error) {
-	queryBuilder := sq.Select("id", "actor_id", "updated_at").
+func (s *Storage) GetLikedDecisions(ctx context.Context, recipientID string, liked bool, sort Sort, cursor *Cursor, limit *uint32) ([]*Liker, error) {
+	queryBuilder := sq.Select("id", "actor_id", "updated_at", "created_at", "decided_at", "matched_at").
 		From("decisions").
 		Where(sq.Eq{
 			"recipient_id": recipientID,
@@ -88,12 +370,12 @@ func (s *Storage) GetLikedDecisions(ctx context.Context, recipientID string, lik
 		Where(sq.Eq{
 			"liked": liked,
 		}).
-		PlaceholderFormat(sq.Dollar).OrderBy("id DESC")
+		Where(notBlocked).
+		PlaceholderFormat(sq.Dollar)
 
-	if token != nil {
-		queryBuilder = queryBuilder.Where(sq.Lt{
-			"id": *token,
-		})
+	queryBuilder, err := orderLikers(queryBuilder, sort, cursor)
+	if err != nil {
+		return nil, err
 	}
 
 	if limit != nil {
@@ -115,9 +397,10 @@ func (s *Storage) GetLikedDecisions(ctx context.Context, recipientID string, lik
 	var likers []*Liker
 	for rows.Next() {
 		var id uint64
-		var updated_at time.Time
+		var updated_at, created_at, decided_at time.Time
+		var matched_at sql.NullTime
 		var actor_id string
-		err := rows.Scan(&id, &actor_id, &updated_at)
+		err := rows.Scan(&id, &actor_id, &updated_at, &created_at, &decided_at, &matched_at)
 		if err != nil {
 			return nil, err
 		}
@@ -126,17 +409,21 @@ func (s *Storage) GetLikedDecisions(ctx context.Context, recipientID string, lik
 			ID:        id,
 			ActorID:   actor_id,
 			UpdatedAt: uint64(updated_at.Unix()),
+			CreatedAt: uint64(created_at.Unix()),
+			DecidedAt: uint64(decided_at.Unix()),
+			MatchedAt: unixTime(matched_at),
+			Cursor:    newCursor(sort, id, updated_at, matched_at),
 		})
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	return likers, nil
 }
 
-func (s *Storage) GetNewLikedDecisions(ctx context.Context, recipientID string, liked bool, token *uint64, limit *uint32) ([]*Liker, error) {
-	queryBuilder := sq.Select("id", "actor_id", "updated_at").
+func (s *Storage) GetNewLikedDecisions(ctx context.Context, recipientID string, liked bool, sort Sort, cursor *Cursor, limit *uint32) ([]*Liker, error) {
+	queryBuilder := sq.Select("id", "actor_id", "updated_at", "created_at", "decided_at", "matched_at").
 		From("decisions").
 		Where(sq.Eq{
 			"recipient_id": recipientID,
@@ -147,12 +434,12 @@ func (s *Storage) GetNewLikedDecisions(ctx context.Context, recipientID string,
 		Where(sq.Eq{
 			"mutually_liked": nil,
 		}).
-		PlaceholderFormat(sq.Dollar).OrderBy("id DESC")
+		Where(notBlocked).
+		PlaceholderFormat(sq.Dollar)
 
-	if token != nil {
-		queryBuilder = queryBuilder.Where(sq.Lt{
-			"id": *token,
-		})
+	queryBuilder, err := orderLikers(queryBuilder, sort, cursor)
+	if err != nil {
+		return nil, err
 	}
 
 	if limit != nil {
@@ -173,9 +460,10 @@ func (s *Storage) GetNewLikedDecisions(ctx context.Context, recipientID string,
 	var likers []*Liker
 	for rows.Next() {
 		var id uint64
-		var updated_at time.Time
+		var updated_at, created_at, decided_at time.Time
+		var matched_at sql.NullTime
 		var actor_id string
-		err := rows.Scan(&id, &actor_id, &updated_at)
+		err := rows.Scan(&id, &actor_id, &updated_at, &created_at, &decided_at, &matched_at)
 		if err != nil {
 			return nil, err
 		}
@@ -184,17 +472,81 @@ func (s *Storage) GetNewLikedDecisions(ctx context.Context, recipientID string,
 			ID:        id,
 			ActorID:   actor_id,
 			UpdatedAt: uint64(updated_at.Unix()),
+			CreatedAt: uint64(created_at.Unix()),
+			DecidedAt: uint64(decided_at.Unix()),
+			MatchedAt: unixTime(matched_at),
+			Cursor:    newCursor(sort, id, updated_at, matched_at),
 		})
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	return likers, nil
 }
 
+func (s *Storage) GetMatches(ctx context.Context, userID string, token *uint64, limit *uint32) ([]*Match, error) {
+	// A match is a decision for the user which they have liked in return
+	queryBuilder := sq.Select("id", "actor_id", "matched_at").
+		From("decisions").
+		Where(sq.Eq{
+			"recipient_id": userID,
+		}).
+		Where(sq.Eq{
+			"liked": true,
+		}).
+		Where(sq.Eq{
+			"mutually_liked": true,
+		}).
+		Where(notBlocked).
+		PlaceholderFormat(sq.Dollar).OrderBy("id DESC")
+
+	if token != nil {
+		queryBuilder = queryBuilder.Where(sq.Lt{
+			"id": *token,
+		})
+	}
+
+	if limit != nil {
+		queryBuilder = queryBuilder.Limit(uint64(*limit))
+	}
+
+	query, args, err := queryBuilder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []*Match
+	for rows.Next() {
+		var id uint64
+		var matched_at time.Time
+		var actor_id string
+		err := rows.Scan(&id, &actor_id, &matched_at)
+		if err != nil {
+			return nil, err
+		}
+
+		matches = append(matches, &Match{
+			ID:        id,
+			UserID:    actor_id,
+			MatchedAt: uint64(matched_at.Unix()),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
 func (s *Storage) GetLikedDecisionsCount(ctx context.Context, recipientID string, liked bool) (int, error) {
-	row := s.db.QueryRowContext(ctx, "SELECT count(*) FROM decisions WHERE recipient_id = $1 AND liked = $2;", recipientID, liked)
+	row := s.db.QueryRowContext(ctx, "SELECT count(*) FROM decisions WHERE recipient_id = $1 AND liked = $2 AND "+notBlocked+";", recipientID, liked)
 
 	var count int
 	err := row.Scan(&count)
@@ -208,19 +560,155 @@ func (s *Storage) GetLikedDecisionsCount(ctx context.Context, recipientID string
 	return count, nil
 }
 
-func (s *Storage) GetLikedDecision(ctx context.Context, recipientID, actorID string) (bool, error) {
-	row := s.db.QueryRowContext(ctx, "SELECT liked FROM decisions WHERE recipient_id = $1 AND actor_id = $2;", recipientID, actorID)
+// upsertDecision stores the decision of the actor for the recipient without updating the recipient's decision,
+// returning the decision it replaced or nil if there wasn't one
+func upsertDecision(ctx context.Context, tx *sql.Tx, recipientID, actorID string, liked bool) (*bool, error) {
+	var previous *bool
+	row := tx.QueryRowContext(ctx, "SELECT liked FROM decisions WHERE recipient_id = $1 AND actor_id = $2;", recipientID, actorID)
+	err := row.Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// Decided and updated at only move when the decision changes, so repeating a decision doesn't make it look new.
+	// A changed decision keeps the one it replaced so it can be undone.
+	_, err = tx.ExecContext(ctx,
+		`
+		INSERT INTO decisions (recipient_id, actor_id, liked, created_at, decided_at, updated_at, undoable) 
+		VALUES ($1, $2, $3, now(), now(), now(), TRUE)
+		ON CONFLICT (recipient_id, actor_id) 
+		DO UPDATE 
+		SET liked = EXCLUDED.liked,
+		decided_at = CASE WHEN decisions.liked = EXCLUDED.liked THEN decisions.decided_at ELSE EXCLUDED.decided_at END,
+		previous_liked = CASE WHEN decisions.liked = EXCLUDED.liked THEN decisions.previous_liked ELSE decisions.liked END,
+		previous_decided_at = CASE WHEN decisions.liked = EXCLUDED.liked THEN decisions.previous_decided_at ELSE decisions.decided_at END,
+		undoable = CASE WHEN decisions.liked = EXCLUDED.liked THEN decisions.undoable ELSE TRUE END,
+		updated_at = CASE WHEN decisions.liked = EXCLUDED.liked THEN decisions.updated_at ELSE EXCLUDED.updated_at END;
+		`,
+		recipientID, actorID, liked)
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// syncMutualDecisions sets the mutually liked flag of both decisions between two users from the other's decision,
+// and the matched at time of both decisions when they like each other. The updated at time is left alone, as it is
+// when the actor changed the decision rather than when the other user answered it.
+func syncMutualDecisions(ctx context.Context, tx *sql.Tx, recipientID, actorID string) error {
+	_, err := tx.ExecContext(ctx,
+		`
+		UPDATE decisions AS d
+		SET mutually_liked = r.liked,
+		matched_at = CASE WHEN d.liked AND r.liked THEN COALESCE(d.matched_at, now()) END
+		FROM decisions AS r
+		WHERE r.recipient_id = d.actor_id AND r.actor_id = d.recipient_id
+		AND ((d.recipient_id = $1 AND d.actor_id = $2) OR (d.recipient_id = $2 AND d.actor_id = $1));
+		`,
+		recipientID, actorID)
+	return err
+}
 
-	var liked bool
-	err := row.Scan(&liked)
+func isMatched(ctx context.Context, tx *sql.Tx, recipientID, actorID string) (bool, error) {
+	var matched bool
+	row := tx.QueryRowContext(ctx, "SELECT matched_at IS NOT NULL FROM decisions WHERE recipient_id = $1 AND actor_id = $2;", recipientID, actorID)
+	err := row.Scan(&matched)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return matched, err
+}
+
+// endMatch records a pass of the actor for the recipient which can't be undone, ending any match between them
+func endMatch(ctx context.Context, tx *sql.Tx, recipientID, actorID string) error {
+	_, err := upsertDecision(ctx, tx, recipientID, actorID, false)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, ErrDecisionNotFound
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`
+		UPDATE decisions 
+		SET previous_liked = NULL,
+		previous_decided_at = NULL,
+		undoable = FALSE
+		WHERE recipient_id = $1 AND actor_id = $2;
+		`,
+		recipientID, actorID)
+	if err != nil {
+		return err
+	}
+
+	err = syncMutualDecisions(ctx, tx, recipientID, actorID)
+	if err != nil {
+		return err
+	}
+
+	return recordEvent(ctx, tx, recipientID, actorID, EventUnmatched)
+}
+
+func isBlocked(ctx context.Context, tx *sql.Tx, recipientID, actorID string) (bool, error) {
+	var blocked bool
+	row := tx.QueryRowContext(ctx,
+		`
+		SELECT EXISTS (
+			SELECT 1 FROM blocks 
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		);
+		`,
+		recipientID, actorID)
+	err := row.Scan(&blocked)
+	return blocked, err
+}
+
+// withSerializableTx runs fn in a serializable transaction, retrying it when postgres aborts the transaction
+// because it conflicted with a concurrent one
+func (s *Storage) withSerializableTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := s.withTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}, fn)
+		if err == nil || attempt >= maxTxAttempts || !isSerializationFailure(err) {
+			return err
 		}
-		return false, err
+
+		// Back off for a random interval so the conflicting transactions don't collide again straight away
+		backoff := time.Duration(rand.Int64N(int64(attempt) * int64(txRetryBackoff)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (s *Storage) withTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
 	}
+	return tx.Commit()
+}
 
-	return liked, nil
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected
+	}
+	return false
+}
+
+func unixTime(t sql.NullTime) *uint64 {
+	if !t.Valid {
+		return nil
+	}
+	res := uint64(t.Time.Unix())
+	return &res
 }
 
 func (s *Storage) Close() error {
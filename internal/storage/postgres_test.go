@@ -5,11 +5,15 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"sync"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/neiln3121/explore-service/database/migrations"
+	"github.com/neiln3121/explore-service/internal/api"
 	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/storage/storetest"
 	migrate "github.com/rubenv/sql-migrate"
 	"github.com/stretchr/testify/suite"
 	"github.com/testcontainers/testcontainers-go"
@@ -19,6 +23,7 @@ import (
 type StorageSuite struct {
 	suite.Suite
 	container testcontainers.Container
+	db        *sql.DB
 	repo      *storage.Storage
 }
 
@@ -58,9 +63,17 @@ func (s *StorageSuite) SetupSuite() {
 	}
 
 	s.container = ctr
+	s.db = db
 	s.repo = storage.New(db)
 }
 
+// TestConformance checks the postgres storage behaves like every other api.Store implementation
+func (s *StorageSuite) TestConformance() {
+	storetest.Run(s.T(), func(t *testing.T) api.Store {
+		return s.repo
+	})
+}
+
 func (s *StorageSuite) TearDownSuite() {
 	err := s.repo.Close()
 	s.Require().NoError(err)
@@ -75,55 +88,409 @@ func (s *StorageSuite) TestGetLikedDecisionsCount() {
 	s.Assert().Equal(3, res)
 }
 
-func (s *StorageSuite) TestGetLikedDecision() {
+func (s *StorageSuite) TestGetLikedDecisions() {
 	ctx := context.Background()
 
-	res, err := s.repo.GetLikedDecision(ctx, "user-1", "user-2")
+	res, err := s.repo.GetLikedDecisions(ctx, "user-1", true, storage.SortID, nil, nil)
+	s.Require().NoError(err)
+	s.Assert().Len(res, 3)
+
+	res, err = s.repo.GetLikedDecisions(ctx, "user-1", false, storage.SortID, nil, nil)
+	s.Require().NoError(err)
+	s.Assert().Len(res, 1)
+
+	// Pagination tests
+	limit := uint32(2)
+	res, err = s.repo.GetLikedDecisions(ctx, "user-1", true, storage.SortID, nil, &limit)
 	s.Require().NoError(err)
-	s.Assert().Equal(true, res)
+	s.Assert().Len(res, 2)
 
-	res, err = s.repo.GetLikedDecision(ctx, "user-1", "user-3")
+	nextCursor := &res[len(res)-1].Cursor
+	res, err = s.repo.GetLikedDecisions(ctx, "user-1", true, storage.SortID, nextCursor, nil)
 	s.Require().NoError(err)
-	s.Assert().Equal(false, res)
+	s.Assert().Len(res, 1)
 }
 
-func (s *StorageSuite) TestGetLikedDecisions() {
+func (s *StorageSuite) TestGetMatches() {
 	ctx := context.Background()
 
-	res, err := s.repo.GetLikedDecisions(ctx, "user-1", true, nil, nil)
+	// Match user 1 likes users 2, 3 and 4 but only users 2 and 3 like back
+	for _, actorID := range []string{"match-2", "match-3", "match-4"} {
+		_, err := s.repo.RecordDecision(ctx, actorID, "match-1", true)
+		s.Require().NoError(err)
+	}
+	_, err := s.repo.RecordDecision(ctx, "match-1", "match-2", true)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "match-1", "match-3", true)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "match-1", "match-4", false)
+	s.Require().NoError(err)
+
+	res, err := s.repo.GetMatches(ctx, "match-1", nil, nil)
 	s.Require().NoError(err)
-	s.Assert().Len(res, 3)
+	s.Require().Len(res, 2)
+	s.Assert().Equal("match-3", res[0].UserID)
+	s.Assert().Equal("match-2", res[1].UserID)
 
-	res, err = s.repo.GetLikedDecisions(ctx, "user-1", false, nil, nil)
+	// Matches are listed for both users
+	res, err = s.repo.GetMatches(ctx, "match-2", nil, nil)
+	s.Require().NoError(err)
+	s.Require().Len(res, 1)
+	s.Assert().Equal("match-1", res[0].UserID)
+
+	// Pagination tests
+	limit := uint32(1)
+	res, err = s.repo.GetMatches(ctx, "match-1", nil, &limit)
+	s.Require().NoError(err)
+	s.Assert().Len(res, 1)
+
+	nextToken := &res[len(res)-1].ID
+	res, err = s.repo.GetMatches(ctx, "match-1", nextToken, nil)
 	s.Require().NoError(err)
 	s.Assert().Len(res, 1)
+	s.Assert().Equal("match-2", res[0].UserID)
+}
+
+func (s *StorageSuite) Test_RecordDecision() {
+	ctx := context.Background()
+
+	res, err := s.repo.RecordDecision(ctx, "user-2", "user-3", true)
+	s.Require().NoError(err)
+	s.Assert().False(res.RecipientDecided)
+
+	res, err = s.repo.RecordDecision(ctx, "user-3", "user-4", false)
+	s.Require().NoError(err)
+	s.Assert().False(res.RecipientDecided)
+
+	// User 2 passes on user 3 in return
+	res, err = s.repo.RecordDecision(ctx, "user-3", "user-2", false)
+	s.Require().NoError(err)
+	s.Assert().True(res.RecipientDecided)
+	s.Assert().True(res.RecipientLiked)
+}
+
+func (s *StorageSuite) Test_RecordDecisionTimestamps() {
+	ctx := context.Background()
+
+	decisionTimes := func(recipientID, actorID string) (createdAt, decidedAt time.Time, matchedAt sql.NullTime) {
+		row := s.db.QueryRowContext(ctx, "SELECT created_at, decided_at, matched_at FROM decisions WHERE recipient_id = $1 AND actor_id = $2;", recipientID, actorID)
+		s.Require().NoError(row.Scan(&createdAt, &decidedAt, &matchedAt))
+		return
+	}
+
+	_, err := s.repo.RecordDecision(ctx, "time-1", "time-2", false)
+	s.Require().NoError(err)
+	createdAt, decidedAt, matchedAt := decisionTimes("time-1", "time-2")
+	s.Assert().Equal(createdAt, decidedAt)
+	s.Assert().False(matchedAt.Valid)
+
+	// Repeating the same decision doesn't move decided at
+	_, err = s.repo.RecordDecision(ctx, "time-1", "time-2", false)
+	s.Require().NoError(err)
+	_, repeatedAt, _ := decisionTimes("time-1", "time-2")
+	s.Assert().Equal(decidedAt, repeatedAt)
+
+	// Changing the decision moves decided at but not created at
+	_, err = s.repo.RecordDecision(ctx, "time-1", "time-2", true)
+	s.Require().NoError(err)
+	changedCreatedAt, changedAt, matchedAt := decisionTimes("time-1", "time-2")
+	s.Assert().Equal(createdAt, changedCreatedAt)
+	s.Assert().True(changedAt.After(decidedAt))
+	s.Assert().False(matchedAt.Valid)
+
+	// Liking in return sets matched at on both decisions
+	_, err = s.repo.RecordDecision(ctx, "time-2", "time-1", true)
+	s.Require().NoError(err)
+	_, _, matchedAt = decisionTimes("time-1", "time-2")
+	s.Require().True(matchedAt.Valid)
+	_, _, reverseMatchedAt := decisionTimes("time-2", "time-1")
+	s.Assert().Equal(matchedAt, reverseMatchedAt)
+
+	res, err := s.repo.GetLikedDecisions(ctx, "time-1", true, storage.SortID, nil, nil)
+	s.Require().NoError(err)
+	s.Require().Len(res, 1)
+	s.Require().NotNil(res[0].MatchedAt)
+	s.Assert().Equal(uint64(matchedAt.Time.Unix()), *res[0].MatchedAt)
+
+	// Passing ends the match
+	_, err = s.repo.RecordDecision(ctx, "time-1", "time-2", false)
+	s.Require().NoError(err)
+	_, _, matchedAt = decisionTimes("time-1", "time-2")
+	s.Assert().False(matchedAt.Valid)
+	_, _, reverseMatchedAt = decisionTimes("time-2", "time-1")
+	s.Assert().False(reverseMatchedAt.Valid)
+}
+
+func (s *StorageSuite) Test_UndoDecision() {
+	ctx := context.Background()
+
+	_, err := s.repo.UndoDecision(ctx, "undo-1", "undo-2", time.Minute)
+	s.Assert().ErrorIs(err, storage.ErrDecisionNotFound)
+
+	// Both users like each other, then user 2 changes their mind
+	_, err = s.repo.RecordDecision(ctx, "undo-1", "undo-2", true)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "undo-2", "undo-1", true)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "undo-1", "undo-2", false)
+	s.Require().NoError(err)
+
+	res, err := s.repo.GetMatches(ctx, "undo-1", nil, nil)
+	s.Require().NoError(err)
+	s.Assert().Len(res, 0)
+
+	// Undoing the pass restores the like and the match
+	undone, err := s.repo.UndoDecision(ctx, "undo-1", "undo-2", time.Minute)
+	s.Require().NoError(err)
+	s.Assert().Equal(&storage.UndoResult{Restored: true, Liked: true}, undone)
+
+	res, err = s.repo.GetMatches(ctx, "undo-1", nil, nil)
+	s.Require().NoError(err)
+	s.Require().Len(res, 1)
+	s.Assert().Equal("undo-2", res[0].UserID)
+
+	// The decision can only be undone once
+	_, err = s.repo.UndoDecision(ctx, "undo-1", "undo-2", time.Minute)
+	s.Assert().ErrorIs(err, storage.ErrNothingToUndo)
+
+	// Undoing the first decision of user 1 removes it and ends the match
+	undone, err = s.repo.UndoDecision(ctx, "undo-2", "undo-1", time.Minute)
+	s.Require().NoError(err)
+	s.Assert().Equal(&storage.UndoResult{}, undone)
+
+	likers, err := s.repo.GetLikedDecisions(ctx, "undo-2", true, storage.SortID, nil, nil)
+	s.Require().NoError(err)
+	s.Assert().Len(likers, 0)
+
+	res, err = s.repo.GetMatches(ctx, "undo-2", nil, nil)
+	s.Require().NoError(err)
+	s.Assert().Len(res, 0)
+
+	newLikes, err := s.repo.GetNewLikedDecisions(ctx, "undo-1", true, storage.SortID, nil, nil)
+	s.Require().NoError(err)
+	s.Require().Len(newLikes, 1)
+	s.Assert().Nil(newLikes[0].MatchedAt)
+
+	// Decisions outside the window can't be undone
+	_, err = s.repo.RecordDecision(ctx, "undo-3", "undo-4", true)
+	s.Require().NoError(err)
+	_, err = s.repo.UndoDecision(ctx, "undo-3", "undo-4", 0)
+	s.Assert().ErrorIs(err, storage.ErrUndoWindowExpired)
+}
+
+func (s *StorageSuite) Test_Unmatch() {
+	ctx := context.Background()
+
+	err := s.repo.Unmatch(ctx, "unmatch-1", "unmatch-2")
+	s.Assert().ErrorIs(err, storage.ErrMatchNotFound)
+
+	_, err = s.repo.RecordDecision(ctx, "unmatch-1", "unmatch-2", true)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "unmatch-2", "unmatch-1", true)
+	s.Require().NoError(err)
+
+	err = s.repo.Unmatch(ctx, "unmatch-1", "unmatch-2")
+	s.Require().NoError(err)
+
+	for _, userID := range []string{"unmatch-1", "unmatch-2"} {
+		res, err := s.repo.GetMatches(ctx, userID, nil, nil)
+		s.Require().NoError(err)
+		s.Assert().Len(res, 0)
+	}
+
+	// Unmatching can't be undone
+	_, err = s.repo.UndoDecision(ctx, "unmatch-2", "unmatch-1", time.Minute)
+	s.Assert().ErrorIs(err, storage.ErrNothingToUndo)
+}
+
+func (s *StorageSuite) Test_BlockUser() {
+	ctx := context.Background()
+
+	// Users 1 and 2 match, user 3 likes user 1
+	_, err := s.repo.RecordDecision(ctx, "block-1", "block-2", true)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "block-2", "block-1", true)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "block-1", "block-3", true)
+	s.Require().NoError(err)
+
+	// User 1 blocks both
+	err = s.repo.BlockUser(ctx, "block-1", "block-2")
+	s.Require().NoError(err)
+	err = s.repo.BlockUser(ctx, "block-1", "block-3")
+	s.Require().NoError(err)
+
+	// Blocking twice is fine
+	err = s.repo.BlockUser(ctx, "block-1", "block-3")
+	s.Require().NoError(err)
+
+	likers, err := s.repo.GetLikedDecisions(ctx, "block-1", true, storage.SortID, nil, nil)
+	s.Require().NoError(err)
+	s.Assert().Len(likers, 0)
+
+	likers, err = s.repo.GetNewLikedDecisions(ctx, "block-1", true, storage.SortID, nil, nil)
+	s.Require().NoError(err)
+	s.Assert().Len(likers, 0)
+
+	count, err := s.repo.GetLikedDecisionsCount(ctx, "block-1", true)
+	s.Require().NoError(err)
+	s.Assert().Equal(0, count)
+
+	// The match has ended for both users
+	for _, userID := range []string{"block-1", "block-2"} {
+		matches, err := s.repo.GetMatches(ctx, userID, nil, nil)
+		s.Require().NoError(err)
+		s.Assert().Len(matches, 0)
+	}
+
+	// User 1 liking user 3 in return is never reported as mutual while blocked
+	res, err := s.repo.RecordDecision(ctx, "block-3", "block-1", true)
+	s.Require().NoError(err)
+	s.Assert().False(res.RecipientDecided)
+
+	// User 3 liking again is accepted but still hidden from user 1
+	res, err = s.repo.RecordDecision(ctx, "block-1", "block-3", true)
+	s.Require().NoError(err)
+	s.Assert().False(res.RecipientDecided)
+
+	count, err = s.repo.GetLikedDecisionsCount(ctx, "block-1", true)
+	s.Require().NoError(err)
+	s.Assert().Equal(0, count)
+
+	matches, err := s.repo.GetMatches(ctx, "block-3", nil, nil)
+	s.Require().NoError(err)
+	s.Assert().Len(matches, 0)
+
+	// Unblocking user 3 surfaces the match made while blocked
+	err = s.repo.UnblockUser(ctx, "block-1", "block-3")
+	s.Require().NoError(err)
+
+	matches, err = s.repo.GetMatches(ctx, "block-1", nil, nil)
+	s.Require().NoError(err)
+	s.Require().Len(matches, 1)
+	s.Assert().Equal("block-3", matches[0].UserID)
+
+	err = s.repo.UnblockUser(ctx, "block-1", "block-3")
+	s.Assert().ErrorIs(err, storage.ErrBlockNotFound)
+}
+
+func (s *StorageSuite) Test_GetDecisionHistory() {
+	ctx := context.Background()
+
+	// User 1 passes then likes user 2, repeats the like, and undoes it
+	_, err := s.repo.RecordDecision(ctx, "history-2", "history-1", false)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "history-2", "history-1", true)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "history-2", "history-1", true)
+	s.Require().NoError(err)
+	_, err = s.repo.UndoDecision(ctx, "history-2", "history-1", time.Minute)
+	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "history-3", "history-1", true)
+	s.Require().NoError(err)
+
+	liked, passed := true, false
+	res, err := s.repo.GetDecisionHistory(ctx, "history-1", nil, nil, nil)
+	s.Require().NoError(err)
+	s.Require().Len(res, 4)
+	s.Assert().Equal(storage.EventDecided, res[0].Type)
+	s.Assert().Equal(&passed, res[0].Liked)
+	s.Assert().Equal(storage.EventDecided, res[1].Type)
+	s.Assert().Equal(&liked, res[1].Liked)
+	s.Assert().Equal(storage.EventUndone, res[2].Type)
+	s.Assert().Equal(&passed, res[2].Liked)
+	s.Assert().Equal("history-3", res[3].RecipientID)
+
+	recipientID := "history-2"
+	res, err = s.repo.GetDecisionHistory(ctx, "history-1", &recipientID, nil, nil)
+	s.Require().NoError(err)
+	s.Assert().Len(res, 3)
 
 	// Pagination tests
 	limit := uint32(2)
-	res, err = s.repo.GetLikedDecisions(ctx, "user-1", true, nil, &limit)
+	res, err = s.repo.GetDecisionHistory(ctx, "history-1", nil, nil, &limit)
 	s.Require().NoError(err)
 	s.Assert().Len(res, 2)
 
 	nextToken := &res[len(res)-1].ID
-	res, err = s.repo.GetLikedDecisions(ctx, "user-1", true, nextToken, nil)
+	res, err = s.repo.GetDecisionHistory(ctx, "history-1", nil, nextToken, nil)
 	s.Require().NoError(err)
-	s.Assert().Len(res, 1)
+	s.Require().Len(res, 2)
+	s.Assert().Equal(storage.EventUndone, res[0].Type)
 }
 
-func (s *StorageSuite) Test_PutDecision() {
+func (s *StorageSuite) Test_RebuildDecisions() {
 	ctx := context.Background()
 
-	err := s.repo.PutDecision(ctx, "user-2", "user-3", true)
+	_, err := s.repo.RecordDecision(ctx, "rebuild-1", "rebuild-2", true)
 	s.Require().NoError(err)
+	_, err = s.repo.RecordDecision(ctx, "rebuild-2", "rebuild-1", true)
+	s.Require().NoError(err)
+
+	report, err := s.repo.RebuildDecisions(ctx, false)
+	s.Require().NoError(err)
+	s.Assert().True(report.Consistent())
+
+	// Break the decisions behind the log's back
+	_, err = s.db.ExecContext(ctx, "UPDATE decisions SET liked = FALSE WHERE recipient_id = 'rebuild-1' AND actor_id = 'rebuild-2';")
+	s.Require().NoError(err)
+	_, err = s.db.ExecContext(ctx, "DELETE FROM decisions WHERE recipient_id = 'rebuild-2' AND actor_id = 'rebuild-1';")
+	s.Require().NoError(err)
+
+	report, err = s.repo.RebuildDecisions(ctx, false)
+	s.Require().NoError(err)
+	s.Assert().Equal(&storage.RebuildReport{Missing: 1, Mismatched: 1}, report)
+
+	report, err = s.repo.RebuildDecisions(ctx, true)
+	s.Require().NoError(err)
+	s.Assert().True(report.Repaired)
 
-	err = s.repo.PutDecision(ctx, "user-3", "user-4", false)
+	report, err = s.repo.RebuildDecisions(ctx, false)
 	s.Require().NoError(err)
+	s.Assert().True(report.Consistent())
+
+	matches, err := s.repo.GetMatches(ctx, "rebuild-1", nil, nil)
+	s.Require().NoError(err)
+	s.Require().Len(matches, 1)
+	s.Assert().Equal("rebuild-2", matches[0].UserID)
+}
+
+func (s *StorageSuite) Test_RecordDecisionConcurrent() {
+	ctx := context.Background()
+
+	// Both users like each other repeatedly from many goroutines at once
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		recipientID, actorID := "race-1", "race-2"
+		if i%2 == 0 {
+			recipientID, actorID = actorID, recipientID
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.repo.RecordDecision(ctx, recipientID, actorID, true)
+			s.Assert().NoError(err)
+		}()
+	}
+	wg.Wait()
+
+	// Neither decision can be left without the mutual flag set
+	for _, pair := range [][2]string{{"race-1", "race-2"}, {"race-2", "race-1"}} {
+		var liked bool
+		var mutuallyLiked sql.NullBool
+		row := s.db.QueryRowContext(ctx, "SELECT liked, mutually_liked FROM decisions WHERE recipient_id = $1 AND actor_id = $2;", pair[0], pair[1])
+		s.Require().NoError(row.Scan(&liked, &mutuallyLiked))
+		s.Assert().True(liked)
+		s.Assert().True(mutuallyLiked.Valid)
+		s.Assert().True(mutuallyLiked.Bool)
+	}
 }
 
 func (s *StorageSuite) Test_GetNewLikedDecisions() {
 	ctx := context.Background()
 
-	res, err := s.repo.GetNewLikedDecisions(ctx, "user-1", true, nil, nil)
+	res, err := s.repo.GetNewLikedDecisions(ctx, "user-1", true, storage.SortID, nil, nil)
 	s.Require().NoError(err)
 	s.Assert().Len(res, 3)
 
@@ -131,22 +498,22 @@ func (s *StorageSuite) Test_GetNewLikedDecisions() {
 	s.Assert().Equal(res[0].ActorID, "user-5")
 
 	// User 5 likes user 1 in return
-	err = s.repo.PutMutualDecisions(ctx, "user-5", "user-1", true, true)
+	_, err = s.repo.RecordDecision(ctx, "user-5", "user-1", true)
 	s.Require().NoError(err)
 
 	// Now only 2 new likes
-	res, err = s.repo.GetNewLikedDecisions(ctx, "user-1", true, nil, nil)
+	res, err = s.repo.GetNewLikedDecisions(ctx, "user-1", true, storage.SortID, nil, nil)
 	s.Require().NoError(err)
 	s.Assert().Len(res, 2)
 
 	// Pagination tests
 	limit := uint32(1)
-	res, err = s.repo.GetNewLikedDecisions(ctx, "user-1", true, nil, &limit)
+	res, err = s.repo.GetNewLikedDecisions(ctx, "user-1", true, storage.SortID, nil, &limit)
 	s.Require().NoError(err)
 	s.Assert().Len(res, 1)
 
-	nextToken := &res[len(res)-1].ID
-	res, err = s.repo.GetNewLikedDecisions(ctx, "user-1", true, nextToken, nil)
+	nextCursor := &res[len(res)-1].Cursor
+	res, err = s.repo.GetNewLikedDecisions(ctx, "user-1", true, storage.SortID, nextCursor, nil)
 	s.Require().NoError(err)
 	s.Assert().Len(res, 1)
 }
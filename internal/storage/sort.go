@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var ErrUnknownSort = errors.New("unknown sort")
+
+// Sort is an order decisions can be listed in. Every order lists the newest first, and decisions with the same time
+// by ID, newest first.
+type Sort int
+
+const (
+	// SortID orders decisions by when they were first created
+	SortID Sort = iota
+	// SortUpdatedAt orders decisions by when the actor last changed them, not by when the recipient answered them
+	SortUpdatedAt
+	// SortMatchedAt orders decisions by when the users matched, with decisions which haven't matched last
+	SortMatchedAt
+)
+
+func (s Sort) String() string {
+	switch s {
+	case SortID:
+		return "id"
+	case SortUpdatedAt:
+		return "updated_at"
+	case SortMatchedAt:
+		return "matched_at"
+	}
+	return fmt.Sprintf("Sort(%d)", int(s))
+}
+
+// Cursor is the position of a decision in a sorted list. Lists continue after the cursor.
+type Cursor struct {
+	ID uint64
+	// Time is the time the decision is sorted by in Unix microseconds, nil if the decision doesn't have one or the list
+	// is sorted by ID
+	Time *int64
+}
+
+// matchedAtOrder sorts decisions which haven't matched after every decision which has. It must match the expression
+// in the decisions_recipient_matched_at_idx index.
+const matchedAtOrder = "COALESCE(matched_at, '-infinity'::timestamp)"
+
+// orderLikers orders the query of decisions by the sort, starting after the cursor. The ordering is a key set of the
+// sorted time and the ID, so it is stable while decisions change.
+func orderLikers(queryBuilder sq.SelectBuilder, sort Sort, cursor *Cursor) (sq.SelectBuilder, error) {
+	switch sort {
+	case SortID:
+		queryBuilder = queryBuilder.OrderBy("id DESC")
+		if cursor != nil {
+			queryBuilder = queryBuilder.Where(sq.Lt{
+				"id": cursor.ID,
+			})
+		}
+	case SortUpdatedAt:
+		queryBuilder = queryBuilder.OrderBy("updated_at DESC", "id DESC")
+		if cursor != nil {
+			queryBuilder = queryBuilder.Where("(updated_at, id) < (?::timestamp, ?)", cursorTime(cursor), cursor.ID)
+		}
+	case SortMatchedAt:
+		queryBuilder = queryBuilder.OrderBy(matchedAtOrder+" DESC", "id DESC")
+		if cursor != nil {
+			queryBuilder = queryBuilder.Where("("+matchedAtOrder+", id) < (?::timestamp, ?)", cursorTime(cursor), cursor.ID)
+		}
+	default:
+		return queryBuilder, fmt.Errorf("%w %v", ErrUnknownSort, sort)
+	}
+	return queryBuilder, nil
+}
+
+// cursorTime formats the time of the cursor as a timestamp, where a cursor without a time is before every time
+func cursorTime(cursor *Cursor) string {
+	if cursor.Time == nil {
+		return "-infinity"
+	}
+	return time.UnixMicro(*cursor.Time).UTC().Format("2006-01-02 15:04:05.999999")
+}
+
+// newCursor returns the position of a decision in a list with the sort
+func newCursor(sort Sort, id uint64, updatedAt time.Time, matchedAt sql.NullTime) Cursor {
+	cursor := Cursor{
+		ID: id,
+	}
+	switch sort {
+	case SortUpdatedAt:
+		micro := updatedAt.UnixMicro()
+		cursor.Time = &micro
+	case SortMatchedAt:
+		if matchedAt.Valid {
+			micro := matchedAt.Time.UnixMicro()
+			cursor.Time = &micro
+		}
+	}
+	return cursor
+}
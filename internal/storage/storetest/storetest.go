@@ -0,0 +1,931 @@
+// Package storetest specifies the behaviour every api.Store implementation must have, as a table of tests any
+// implementation can run by providing a constructor.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/api"
+	"github.com/neiln3121/explore-service/internal/outbox"
+	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Users names users after the running test, so tests don't see each other's decisions when they share a store
+type Users func(n int) string
+
+// idempotencyPurger is a store which keeps idempotency keys until they are purged
+type idempotencyPurger interface {
+	PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit uint32) (int, error)
+}
+
+type storeTest struct {
+	name string
+	run  func(t *testing.T, store api.Store, user Users)
+}
+
+// Run runs every test against a store created by newStore. The store may already have data, and may be shared between tests.
+func Run(t *testing.T, newStore func(t *testing.T) api.Store) {
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t)
+			tc.run(t, store, func(n int) string {
+				return fmt.Sprintf("%s-%d", t.Name(), n)
+			})
+		})
+	}
+}
+
+var tests = []storeTest{
+	{
+		name: "first decision",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			res, err := store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			assert.Equal(t, &storage.DecisionResult{}, res)
+
+			likers, err := store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, likers, 1)
+			assert.Equal(t, user(2), likers[0].ActorID)
+			assert.Equal(t, likers[0].CreatedAt, likers[0].DecidedAt)
+			assert.Nil(t, likers[0].MatchedAt)
+
+			likers, err = store.GetNewLikedDecisions(ctx, user(1), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, likers, 1)
+		},
+	},
+	{
+		name: "upsert overwrites decision",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			_, err := store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(1), user(3), true)
+			require.NoError(t, err)
+
+			likers, err := store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, likers, 2)
+			id := likers[1].ID
+
+			// Changing the decision moves it between lists but keeps its ID
+			_, err = store.RecordDecision(ctx, user(1), user(2), false)
+			require.NoError(t, err)
+
+			likers, err = store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, likers, 1)
+			assert.Equal(t, user(3), likers[0].ActorID)
+
+			passes, err := store.GetLikedDecisions(ctx, user(1), false, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, passes, 1)
+			assert.Equal(t, user(2), passes[0].ActorID)
+			assert.Equal(t, id, passes[0].ID)
+		},
+	},
+	{
+		name: "mutual decisions",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			_, err := store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+
+			res, err := store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+			assert.Equal(t, &storage.DecisionResult{RecipientDecided: true, RecipientLiked: true}, res)
+
+			// Neither user has a new like once they have liked each other
+			for _, userID := range []string{user(1), user(2)} {
+				likers, err := store.GetNewLikedDecisions(ctx, userID, true, storage.SortID, nil, nil)
+				require.NoError(t, err)
+				assert.Len(t, likers, 0)
+
+				likers, err = store.GetLikedDecisions(ctx, userID, true, storage.SortID, nil, nil)
+				require.NoError(t, err)
+				require.Len(t, likers, 1)
+				require.NotNil(t, likers[0].MatchedAt)
+
+				matches, err := store.GetMatches(ctx, userID, nil, nil)
+				require.NoError(t, err)
+				require.Len(t, matches, 1)
+				assert.Equal(t, *likers[0].MatchedAt, matches[0].MatchedAt)
+			}
+
+			// Passing in return is a mutual decision but not a match
+			_, err = store.RecordDecision(ctx, user(3), user(1), true)
+			require.NoError(t, err)
+
+			res, err = store.RecordDecision(ctx, user(1), user(3), false)
+			require.NoError(t, err)
+			assert.Equal(t, &storage.DecisionResult{RecipientDecided: true, RecipientLiked: true}, res)
+
+			likers, err := store.GetNewLikedDecisions(ctx, user(3), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, likers, 0)
+
+			matches, err := store.GetMatches(ctx, user(3), nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, matches, 0)
+
+			// Changing a like to a pass ends the match
+			res, err = store.RecordDecision(ctx, user(2), user(1), false)
+			require.NoError(t, err)
+			liked := true
+			assert.Equal(t, &storage.DecisionResult{RecipientDecided: true, RecipientLiked: true, WasMatched: true, PreviousLiked: &liked}, res)
+
+			matches, err = store.GetMatches(ctx, user(1), nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, matches, 0)
+		},
+	},
+	{
+		name: "pagination boundaries",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			for n := 2; n <= 4; n++ {
+				_, err := store.RecordDecision(ctx, user(1), user(n), true)
+				require.NoError(t, err)
+			}
+
+			// Newest decisions come first
+			likers, err := store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, likers, 3)
+			assert.Equal(t, user(4), likers[0].ActorID)
+			assert.Equal(t, user(2), likers[2].ActorID)
+			first, last := likers[0].Cursor, likers[2].Cursor
+
+			limit := uint32(2)
+			page, err := store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, &limit)
+			require.NoError(t, err)
+			require.Len(t, page, 2)
+			assert.Equal(t, likers[:2], page)
+
+			// The cursor is exclusive
+			page, err = store.GetLikedDecisions(ctx, user(1), true, storage.SortID, &page[1].Cursor, &limit)
+			require.NoError(t, err)
+			require.Len(t, page, 1)
+			assert.Equal(t, user(2), page[0].ActorID)
+
+			page, err = store.GetLikedDecisions(ctx, user(1), true, storage.SortID, &first, nil)
+			require.NoError(t, err)
+			assert.Len(t, page, 2)
+
+			page, err = store.GetLikedDecisions(ctx, user(1), true, storage.SortID, &last, nil)
+			require.NoError(t, err)
+			assert.Len(t, page, 0)
+
+			// A limit larger than the results returns them all, a zero limit returns none
+			limit = 10
+			page, err = store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, &limit)
+			require.NoError(t, err)
+			assert.Len(t, page, 3)
+
+			limit = 0
+			page, err = store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, &limit)
+			require.NoError(t, err)
+			assert.Len(t, page, 0)
+
+			limit = 1
+			page, err = store.GetNewLikedDecisions(ctx, user(1), true, storage.SortID, &first, &limit)
+			require.NoError(t, err)
+			require.Len(t, page, 1)
+			assert.Equal(t, user(3), page[0].ActorID)
+		},
+	},
+	{
+		name: "sorts",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			// Times are only as precise as the store, so changes are spread out to be ordered by them
+			record := func(recipientID, actorID string, liked bool) {
+				time.Sleep(time.Millisecond)
+				_, err := store.RecordDecision(ctx, recipientID, actorID, liked)
+				require.NoError(t, err)
+			}
+			record(user(1), user(2), true)
+			record(user(1), user(3), false)
+			record(user(1), user(4), true)
+			// User 1 matches with user 2, which doesn't change the like of user 2, then user 3 changes their pass to a like
+			record(user(2), user(1), true)
+			record(user(1), user(3), true)
+
+			for _, tc := range []struct {
+				sort     storage.Sort
+				expected []string
+			}{
+				{sort: storage.SortID, expected: []string{user(4), user(3), user(2)}},
+				{sort: storage.SortUpdatedAt, expected: []string{user(3), user(4), user(2)}},
+				{sort: storage.SortMatchedAt, expected: []string{user(2), user(4), user(3)}},
+			} {
+				likers, err := store.GetLikedDecisions(ctx, user(1), true, tc.sort, nil, nil)
+				require.NoError(t, err)
+				var actorIDs []string
+				for _, liker := range likers {
+					actorIDs = append(actorIDs, liker.ActorID)
+				}
+				assert.Equal(t, tc.expected, actorIDs, tc.sort.String())
+
+				// Paging one at a time from the cursor of the last liker lists every liker once, in the same order
+				limit := uint32(1)
+				var cursor *storage.Cursor
+				var paged []string
+				for range len(tc.expected) + 1 {
+					page, err := store.GetLikedDecisions(ctx, user(1), true, tc.sort, cursor, &limit)
+					require.NoError(t, err)
+					if len(page) == 0 {
+						break
+					}
+					paged = append(paged, page[0].ActorID)
+					cursor = &page[0].Cursor
+				}
+				assert.Equal(t, tc.expected, paged, tc.sort.String())
+			}
+
+			_, err := store.GetLikedDecisions(ctx, user(1), true, storage.Sort(-1), nil, nil)
+			assert.ErrorIs(t, err, storage.ErrUnknownSort)
+		},
+	},
+	{
+		name: "repeated decisions keep their place",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			record := func(recipientID, actorID string, liked bool) {
+				time.Sleep(time.Millisecond)
+				_, err := store.RecordDecision(ctx, recipientID, actorID, liked)
+				require.NoError(t, err)
+			}
+			record(user(1), user(2), true)
+			record(user(1), user(3), true)
+			// A retried like doesn't change the decision, so it doesn't move user 2 to the top
+			record(user(1), user(2), true)
+
+			likers, err := store.GetLikedDecisions(ctx, user(1), true, storage.SortUpdatedAt, nil, nil)
+			require.NoError(t, err)
+			var actorIDs []string
+			for _, liker := range likers {
+				actorIDs = append(actorIDs, liker.ActorID)
+			}
+			assert.Equal(t, []string{user(3), user(2)}, actorIDs)
+		},
+	},
+	{
+		name: "liking back keeps the order",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			record := func(recipientID, actorID string, liked bool) {
+				time.Sleep(time.Millisecond)
+				_, err := store.RecordDecision(ctx, recipientID, actorID, liked)
+				require.NoError(t, err)
+			}
+			list := func() []string {
+				likers, err := store.GetLikedDecisions(ctx, user(1), true, storage.SortUpdatedAt, nil, nil)
+				require.NoError(t, err)
+				var actorIDs []string
+				for _, liker := range likers {
+					actorIDs = append(actorIDs, liker.ActorID)
+				}
+				return actorIDs
+			}
+			record(user(1), user(2), true)
+			record(user(1), user(3), true)
+			require.Equal(t, []string{user(3), user(2)}, list())
+
+			// User 1 liking user 2 back, or undoing it, is their own activity, so it doesn't move user 2 to the top
+			record(user(2), user(1), true)
+			assert.Equal(t, []string{user(3), user(2)}, list())
+			_, err := store.UndoDecision(ctx, user(2), user(1), time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, []string{user(3), user(2)}, list())
+		},
+	},
+	{
+		name: "counts",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			count, err := store.GetLikedDecisionsCount(ctx, user(1), true)
+			require.NoError(t, err)
+			assert.Equal(t, 0, count)
+
+			_, err = store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(1), user(3), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(1), user(4), false)
+			require.NoError(t, err)
+
+			// Repeating a decision doesn't count twice
+			_, err = store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+
+			count, err = store.GetLikedDecisionsCount(ctx, user(1), true)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+
+			count, err = store.GetLikedDecisionsCount(ctx, user(1), false)
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+		},
+	},
+	{
+		name: "not found errors",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			_, err := store.UndoDecision(ctx, user(1), user(2), time.Minute)
+			assert.ErrorIs(t, err, storage.ErrDecisionNotFound)
+
+			err = store.Unmatch(ctx, user(1), user(2))
+			assert.ErrorIs(t, err, storage.ErrMatchNotFound)
+
+			err = store.UnblockUser(ctx, user(1), user(2))
+			assert.ErrorIs(t, err, storage.ErrBlockNotFound)
+
+			// Liking without being liked back isn't a match
+			_, err = store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			err = store.Unmatch(ctx, user(2), user(1))
+			assert.ErrorIs(t, err, storage.ErrMatchNotFound)
+
+			likers, err := store.GetLikedDecisions(ctx, user(3), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, likers, 0)
+
+			events, err := store.GetDecisionHistory(ctx, user(3), nil, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, events, 0)
+		},
+	},
+	{
+		name: "undo",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			_, err := store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(1), user(2), false)
+			require.NoError(t, err)
+
+			undone, err := store.UndoDecision(ctx, user(1), user(2), time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, &storage.UndoResult{Restored: true, Liked: true}, undone)
+
+			matches, err := store.GetMatches(ctx, user(1), nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, matches, 1)
+
+			_, err = store.UndoDecision(ctx, user(1), user(2), time.Minute)
+			assert.ErrorIs(t, err, storage.ErrNothingToUndo)
+
+			undone, err = store.UndoDecision(ctx, user(2), user(1), time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, &storage.UndoResult{}, undone)
+
+			likers, err := store.GetNewLikedDecisions(ctx, user(1), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, likers, 1)
+
+			_, err = store.RecordDecision(ctx, user(3), user(1), true)
+			require.NoError(t, err)
+			_, err = store.UndoDecision(ctx, user(3), user(1), 0)
+			assert.ErrorIs(t, err, storage.ErrUndoWindowExpired)
+		},
+	},
+	{
+		name: "unmatch",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			_, err := store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+
+			err = store.Unmatch(ctx, user(1), user(2))
+			require.NoError(t, err)
+
+			for _, userID := range []string{user(1), user(2)} {
+				matches, err := store.GetMatches(ctx, userID, nil, nil)
+				require.NoError(t, err)
+				assert.Len(t, matches, 0)
+			}
+
+			_, err = store.UndoDecision(ctx, user(2), user(1), time.Minute)
+			assert.ErrorIs(t, err, storage.ErrNothingToUndo)
+		},
+	},
+	{
+		name: "block",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			_, err := store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+
+			err = store.BlockUser(ctx, user(1), user(2))
+			require.NoError(t, err)
+			err = store.BlockUser(ctx, user(1), user(2))
+			require.NoError(t, err)
+
+			count, err := store.GetLikedDecisionsCount(ctx, user(1), true)
+			require.NoError(t, err)
+			assert.Equal(t, 0, count)
+
+			likers, err := store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, likers, 0)
+
+			matches, err := store.GetMatches(ctx, user(2), nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, matches, 0)
+
+			res, err := store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+			assert.False(t, res.RecipientDecided)
+
+			err = store.UnblockUser(ctx, user(1), user(2))
+			require.NoError(t, err)
+
+			matches, err = store.GetMatches(ctx, user(2), nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, matches, 1)
+		},
+	},
+	{
+		name: "history",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			_, err := store.RecordDecision(ctx, user(2), user(1), false)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(3), user(1), true)
+			require.NoError(t, err)
+
+			events, err := store.GetDecisionHistory(ctx, user(1), nil, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, events, 3)
+			assert.Equal(t, storage.EventDecided, events[0].Type)
+			assert.False(t, *events[0].Liked)
+			assert.True(t, *events[1].Liked)
+			assert.Equal(t, user(3), events[2].RecipientID)
+
+			recipientID := user(2)
+			events, err = store.GetDecisionHistory(ctx, user(1), &recipientID, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, events, 2)
+
+			// History is paginated oldest first
+			limit := uint32(2)
+			events, err = store.GetDecisionHistory(ctx, user(1), nil, nil, &limit)
+			require.NoError(t, err)
+			require.Len(t, events, 2)
+
+			events, err = store.GetDecisionHistory(ctx, user(1), nil, &events[1].ID, &limit)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, user(3), events[0].RecipientID)
+		},
+	},
+	{
+		name: "idempotent decisions",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			res, err := store.RecordIdempotentDecision(ctx, "key-1", time.Hour, user(1), user(2), true)
+			require.NoError(t, err)
+			assert.Equal(t, &storage.DecisionResult{}, res)
+			_, err = store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+			likers, err := store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			require.Len(t, likers, 1)
+
+			// A retry gets the original result, without recording the decision again
+			res, err = store.RecordIdempotentDecision(ctx, "key-1", time.Hour, user(1), user(2), true)
+			require.NoError(t, err)
+			assert.Equal(t, &storage.DecisionResult{}, res)
+			history, err := store.GetDecisionHistory(ctx, user(2), nil, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, history, 1)
+			replayed, err := store.GetLikedDecisions(ctx, user(1), true, storage.SortID, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, likers, replayed)
+
+			_, err = store.RecordIdempotentDecision(ctx, "key-1", time.Hour, user(1), user(2), false)
+			assert.ErrorIs(t, err, storage.ErrIdempotencyKeyReused)
+			_, err = store.RecordIdempotentDecision(ctx, "key-1", time.Hour, user(3), user(2), true)
+			assert.ErrorIs(t, err, storage.ErrIdempotencyKeyReused)
+
+			// Keys are unique to the actor
+			res, err = store.RecordIdempotentDecision(ctx, "key-1", time.Hour, user(2), user(1), true)
+			require.NoError(t, err)
+			liked := true
+			assert.Equal(t, &storage.DecisionResult{RecipientDecided: true, RecipientLiked: true, WasMatched: true, PreviousLiked: &liked}, res)
+
+			// Expired keys can be used for another decision
+			_, err = store.RecordIdempotentDecision(ctx, "key-2", time.Millisecond, user(3), user(2), true)
+			require.NoError(t, err)
+			time.Sleep(10 * time.Millisecond)
+			_, err = store.RecordIdempotentDecision(ctx, "key-2", time.Millisecond, user(3), user(2), false)
+			require.NoError(t, err)
+			history, err = store.GetDecisionHistory(ctx, user(2), nil, nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, history, 3)
+		},
+	},
+	{
+		name: "purge idempotency keys",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+			purger, ok := store.(idempotencyPurger)
+			if !ok {
+				t.Skip("the store doesn't purge idempotency keys")
+			}
+			purge := func(ttl time.Duration) {
+				for {
+					purged, err := purger.PurgeIdempotencyKeys(ctx, ttl, 10)
+					require.NoError(t, err)
+					if purged < 10 {
+						return
+					}
+				}
+			}
+
+			for n := 2; n <= 3; n++ {
+				_, err := store.RecordIdempotentDecision(ctx, "key-1", time.Hour, user(1), user(n), true)
+				require.NoError(t, err)
+			}
+
+			// Keys within the TTL are kept
+			purge(time.Hour)
+			_, err := store.RecordIdempotentDecision(ctx, "key-1", time.Hour, user(1), user(2), false)
+			assert.ErrorIs(t, err, storage.ErrIdempotencyKeyReused)
+
+			// Expired keys of every actor are removed, so they can be used again even within a longer TTL
+			time.Sleep(10 * time.Millisecond)
+			purge(5 * time.Millisecond)
+			for n := 2; n <= 3; n++ {
+				_, err := store.RecordIdempotentDecision(ctx, "key-1", time.Hour, user(1), user(n), false)
+				assert.NoError(t, err)
+			}
+		},
+	},
+	{
+		name: "like events",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			after, err := store.GetLastLikeEventID(ctx, user(1))
+			require.NoError(t, err)
+			assert.Zero(t, after)
+
+			_, err = store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(1), user(3), false)
+			require.NoError(t, err)
+			// Repeating a like doesn't record it again
+			_, err = store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			// A like by the user is only an event for them if it forms a match
+			_, err = store.RecordDecision(ctx, user(4), user(1), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(1), user(5), true)
+			require.NoError(t, err)
+			err = store.BlockUser(ctx, user(1), user(5))
+			require.NoError(t, err)
+
+			events, err := store.GetLikeEvents(ctx, user(1), 0, 10)
+			require.NoError(t, err)
+			require.Len(t, events, 2)
+			assert.Equal(t, user(2), events[0].UserID)
+			assert.Nil(t, events[0].MatchedAt)
+			assert.Equal(t, user(2), events[1].UserID)
+			assert.NotNil(t, events[1].MatchedAt)
+			assert.Greater(t, events[1].ID, events[0].ID)
+
+			// The other user sees the like which formed the match as a match
+			events, err = store.GetLikeEvents(ctx, user(2), 0, 10)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, user(1), events[0].UserID)
+			assert.NotNil(t, events[0].MatchedAt)
+
+			events, err = store.GetLikeEvents(ctx, user(1), 0, 1)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			events, err = store.GetLikeEvents(ctx, user(1), events[0].ID, 10)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.NotNil(t, events[0].MatchedAt)
+
+			// Only likes recorded after the last one are listed after it
+			after, err = store.GetLastLikeEventID(ctx, user(1))
+			require.NoError(t, err)
+			events, err = store.GetLikeEvents(ctx, user(1), after, 10)
+			require.NoError(t, err)
+			assert.Len(t, events, 0)
+
+			_, err = store.RecordDecision(ctx, user(1), user(6), true)
+			require.NoError(t, err)
+			events, err = store.GetLikeEvents(ctx, user(1), after, 10)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, user(6), events[0].UserID)
+		},
+	},
+	{
+		name: "outbox",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+			relayer, ok := store.(outbox.Store)
+			if !ok {
+				t.Skip("the store has no outbox")
+			}
+
+			// The store may be shared, so only the events of this test are kept
+			var events []storage.OutboxEvent
+			relay := func(publish func(event *storage.OutboxEvent) error) (int, error) {
+				return relayer.RelayOutbox(ctx, 100, func(ctx context.Context, event *storage.OutboxEvent) error {
+					if !strings.HasPrefix(event.RecipientID, t.Name()+"-") {
+						return nil
+					}
+					if err := publish(event); err != nil {
+						return err
+					}
+					events = append(events, *event)
+					return nil
+				})
+			}
+			drain := func() {
+				for {
+					published, err := relay(func(*storage.OutboxEvent) error { return nil })
+					require.NoError(t, err)
+					if published < 100 {
+						return
+					}
+				}
+			}
+
+			_, err := store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			// Repeating a decision doesn't write an event
+			_, err = store.RecordDecision(ctx, user(1), user(2), true)
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(2), user(1), true)
+			require.NoError(t, err)
+			err = store.Unmatch(ctx, user(1), user(2))
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(3), user(1), false)
+			require.NoError(t, err)
+			// Decisions between blocked users aren't written
+			_, err = store.RecordDecision(ctx, user(1), user(4), true)
+			require.NoError(t, err)
+			err = store.BlockUser(ctx, user(1), user(4))
+			require.NoError(t, err)
+			_, err = store.RecordDecision(ctx, user(4), user(1), true)
+			require.NoError(t, err)
+
+			// An event which fails to publish is kept, and the events after it aren't published before it
+			failed := 0
+			_, err = relay(func(event *storage.OutboxEvent) error {
+				if event.Type == storage.OutboxMatchCreated && failed == 0 {
+					failed++
+					return errors.New("publish failed")
+				}
+				return nil
+			})
+			require.Error(t, err)
+			require.Len(t, events, 2)
+			drain()
+
+			type written struct {
+				eventType, recipientID, actorID string
+			}
+			var got []written
+			for i, event := range events {
+				got = append(got, written{event.Type, event.RecipientID, event.ActorID})
+				assert.NotZero(t, event.CreatedAt)
+				if i > 0 {
+					assert.Greater(t, event.ID, events[i-1].ID)
+				}
+			}
+			assert.Equal(t, []written{
+				{storage.OutboxLikeCreated, user(1), user(2)},
+				{storage.OutboxLikeCreated, user(2), user(1)},
+				{storage.OutboxMatchCreated, user(2), user(1)},
+				{storage.OutboxUnmatched, user(2), user(1)},
+				{storage.OutboxPassRecorded, user(3), user(1)},
+				{storage.OutboxLikeCreated, user(1), user(4)},
+			}, got)
+
+			// Published events are removed from the outbox
+			drain()
+			assert.Len(t, events, len(got))
+		},
+	},
+	{
+		name: "dead letters",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+			letters, ok := store.(webhook.Store)
+			if !ok {
+				t.Skip("the store has no dead letters")
+			}
+
+			// The store may be shared, so subscriptions are named after the test
+			subscription, other := t.Name()+"-partner", t.Name()+"-other"
+			for i, name := range []string{subscription, other, subscription} {
+				err := letters.AddWebhookDeliveries(ctx, []string{name}, &storage.OutboxEvent{
+					ID:          uint64(i + 1),
+					Type:        storage.OutboxMatchCreated,
+					RecipientID: user(1),
+					ActorID:     user(2),
+					CreatedAt:   uint64(time.Now().Unix()),
+				})
+				require.NoError(t, err)
+				delivery, err := letters.ClaimWebhookDelivery(ctx, name, time.Hour)
+				require.NoError(t, err)
+				require.NotNil(t, delivery)
+				err = letters.DeadLetterWebhookDelivery(ctx, delivery.ID, "failed with status 500")
+				require.NoError(t, err)
+			}
+
+			listed, err := letters.GetDeadLetters(ctx, &subscription, 0, 10)
+			require.NoError(t, err)
+			require.Len(t, listed, 2)
+			assert.Equal(t, uint64(1), listed[0].Event.ID)
+			assert.Equal(t, user(1), listed[0].Event.RecipientID)
+			assert.Equal(t, 1, listed[0].Attempts)
+			assert.NotZero(t, listed[0].FailedAt)
+			assert.NotZero(t, listed[0].Event.CreatedAt)
+			assert.Equal(t, uint64(3), listed[1].Event.ID)
+
+			// Dead letters are paged by their ID
+			page, err := letters.GetDeadLetters(ctx, &subscription, listed[0].ID, 1)
+			require.NoError(t, err)
+			require.Len(t, page, 1)
+			assert.Equal(t, listed[1].ID, page[0].ID)
+
+			err = letters.RecordDeadLetterAttempt(ctx, listed[0].ID, "failed with status 502")
+			require.NoError(t, err)
+			err = letters.DeleteDeadLetter(ctx, listed[1].ID)
+			require.NoError(t, err)
+
+			listed, err = letters.GetDeadLetters(ctx, &subscription, 0, 10)
+			require.NoError(t, err)
+			require.Len(t, listed, 1)
+			assert.Equal(t, 2, listed[0].Attempts)
+			assert.Equal(t, "failed with status 502", listed[0].LastError)
+
+			err = letters.DeleteDeadLetter(ctx, page[0].ID)
+			assert.ErrorIs(t, err, storage.ErrDeadLetterNotFound)
+			err = letters.RecordDeadLetterAttempt(ctx, page[0].ID, "")
+			assert.ErrorIs(t, err, storage.ErrDeadLetterNotFound)
+		},
+	},
+	{
+		name: "webhook deliveries",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+			deliveries, ok := store.(webhook.Store)
+			if !ok {
+				t.Skip("the store has no webhook deliveries")
+			}
+
+			// The store may be shared, so subscriptions are named after the test
+			subscription, other := t.Name()+"-partner", t.Name()+"-other"
+			event := func(id uint64) *storage.OutboxEvent {
+				return &storage.OutboxEvent{
+					ID:          id,
+					Type:        storage.OutboxMatchCreated,
+					RecipientID: user(1),
+					ActorID:     user(2),
+					CreatedAt:   uint64(time.Now().Unix()),
+				}
+			}
+			require.NoError(t, deliveries.AddWebhookDeliveries(ctx, []string{subscription, other}, event(1)))
+			require.NoError(t, deliveries.AddWebhookDeliveries(ctx, []string{subscription}, event(2)))
+			// An event published again while it is queued isn't queued twice
+			require.NoError(t, deliveries.AddWebhookDeliveries(ctx, []string{subscription}, event(1)))
+
+			first, err := deliveries.ClaimWebhookDelivery(ctx, subscription, time.Hour)
+			require.NoError(t, err)
+			require.NotNil(t, first)
+			assert.Equal(t, subscription, first.Subscription)
+			assert.Equal(t, uint64(1), first.Event.ID)
+			assert.Equal(t, user(1), first.Event.RecipientID)
+			assert.NotZero(t, first.Event.CreatedAt)
+			assert.Zero(t, first.Attempts)
+
+			// While the oldest delivery is claimed the ones after it wait, but other subscriptions don't
+			claimed, err := deliveries.ClaimWebhookDelivery(ctx, subscription, time.Hour)
+			require.NoError(t, err)
+			assert.Nil(t, claimed)
+			claimed, err = deliveries.ClaimWebhookDelivery(ctx, other, time.Hour)
+			require.NoError(t, err)
+			require.NotNil(t, claimed)
+			assert.Equal(t, uint64(1), claimed.Event.ID)
+
+			// A failed attempt is retried after the backoff
+			err = deliveries.RetryWebhookDelivery(ctx, first.ID, "failed with status 502", 0)
+			require.NoError(t, err)
+			retried, err := deliveries.ClaimWebhookDelivery(ctx, subscription, 0)
+			require.NoError(t, err)
+			require.NotNil(t, retried)
+			assert.Equal(t, first.ID, retried.ID)
+			assert.Equal(t, 1, retried.Attempts)
+			assert.Equal(t, "failed with status 502", retried.LastError)
+
+			// A delivery which fails every attempt is dead lettered, and the next one can be made
+			err = deliveries.DeadLetterWebhookDelivery(ctx, first.ID, "failed with status 500")
+			require.NoError(t, err)
+			letters, err := deliveries.GetDeadLetters(ctx, &subscription, 0, 10)
+			require.NoError(t, err)
+			require.Len(t, letters, 1)
+			assert.Equal(t, uint64(1), letters[0].Event.ID)
+			assert.Equal(t, 2, letters[0].Attempts)
+			assert.Equal(t, "failed with status 500", letters[0].LastError)
+
+			second, err := deliveries.ClaimWebhookDelivery(ctx, subscription, 0)
+			require.NoError(t, err)
+			require.NotNil(t, second)
+			assert.Equal(t, uint64(2), second.Event.ID)
+			require.NoError(t, deliveries.DeleteWebhookDelivery(ctx, second.ID))
+			require.NoError(t, deliveries.DeleteWebhookDelivery(ctx, claimed.ID))
+
+			claimed, err = deliveries.ClaimWebhookDelivery(ctx, subscription, 0)
+			require.NoError(t, err)
+			assert.Nil(t, claimed)
+			err = deliveries.DeleteWebhookDelivery(ctx, second.ID)
+			assert.ErrorIs(t, err, storage.ErrWebhookDeliveryNotFound)
+			err = deliveries.RetryWebhookDelivery(ctx, second.ID, "", 0)
+			assert.ErrorIs(t, err, storage.ErrWebhookDeliveryNotFound)
+			err = deliveries.DeadLetterWebhookDelivery(ctx, second.ID, "")
+			assert.ErrorIs(t, err, storage.ErrWebhookDeliveryNotFound)
+		},
+	},
+	{
+		name: "concurrent writes",
+		run: func(t *testing.T, store api.Store, user Users) {
+			ctx := context.Background()
+
+			// Both users like each other repeatedly at the same time
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				recipientID, actorID := user(1), user(2)
+				if i%2 == 0 {
+					recipientID, actorID = actorID, recipientID
+				}
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := store.RecordDecision(ctx, recipientID, actorID, true)
+					assert.NoError(t, err)
+				}()
+			}
+			wg.Wait()
+
+			// Neither decision can be left unmatched
+			for _, userID := range []string{user(1), user(2)} {
+				matches, err := store.GetMatches(ctx, userID, nil, nil)
+				require.NoError(t, err)
+				assert.Len(t, matches, 1)
+
+				likers, err := store.GetNewLikedDecisions(ctx, userID, true, storage.SortID, nil, nil)
+				require.NoError(t, err)
+				assert.Len(t, likers, 0)
+			}
+		},
+	},
+}
@@ -0,0 +1,51 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/x509"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Identity is who a client proved it is with a verified certificate
+type Identity struct {
+	// SPIFFEID is the spiffe:// URI of the certificate, empty if it doesn't have one
+	SPIFFEID string
+	// CommonName is the common name of the subject of the certificate
+	CommonName string
+}
+
+// Name is the SPIFFE ID of the client, or its common name if it doesn't have one
+func (i Identity) Name() string {
+	if i.SPIFFEID != "" {
+		return i.SPIFFEID
+	}
+	return i.CommonName
+}
+
+// ClientIdentity returns the identity of the client of the request, if it sent a certificate which was verified
+func ClientIdentity(ctx context.Context) (Identity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+	return identityOf(info.State.VerifiedChains[0][0]), true
+}
+
+func identityOf(cert *x509.Certificate) Identity {
+	identity := Identity{
+		CommonName: cert.Subject.CommonName,
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			identity.SPIFFEID = uri.String()
+			break
+		}
+	}
+	return identity
+}
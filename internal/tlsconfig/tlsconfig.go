@@ -0,0 +1,160 @@
+// Package tlsconfig serves TLS with certificates which are reloaded from disk when they change, optionally verifying
+// client certificates, and reports the identity of verified clients
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"sync"
+	"time"
+)
+
+// Files are the files the TLS configuration is loaded from
+type Files struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is the CA client certificates must be signed by. Clients aren't asked for a certificate if it isn't
+	// set.
+	ClientCAFile string
+}
+
+// DefaultCheckInterval is how often the files are checked for changes by default
+const DefaultCheckInterval = time.Second
+
+// Reloader serves the certificate and client CA in its files, reloading them on the next handshake after any of the
+// files change. If the files can't be loaded the last configuration which could be is kept.
+type Reloader struct {
+	files         Files
+	logger        *slog.Logger
+	checkInterval time.Duration
+
+	mu      sync.Mutex
+	config  *tls.Config
+	modTime map[string]time.Time
+	checked time.Time
+}
+
+// Option configures a Reloader
+type Option func(*Reloader)
+
+// WithCheckInterval sets how long handshakes reuse the loaded configuration before the files are checked for changes
+// again, so handshakes don't stat the files every time
+func WithCheckInterval(interval time.Duration) Option {
+	return func(r *Reloader) {
+		r.checkInterval = interval
+	}
+}
+
+// NewReloader loads the files, failing if they can't be loaded
+func NewReloader(files Files, logger *slog.Logger, opts ...Option) (*Reloader, error) {
+	r := &Reloader{
+		files:         files,
+		logger:        logger,
+		checkInterval: DefaultCheckInterval,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	modTime, err := r.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	config, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.config = config
+	r.modTime = modTime
+	r.checked = time.Now()
+	return r, nil
+}
+
+// TLSConfig is the configuration to serve with, taking the certificate and client CA from the latest files for each
+// connection
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+	}
+}
+
+// current returns the configuration, reloading it first if the files have changed since it was loaded. The files are
+// checked at most once per check interval.
+func (r *Reloader) current() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.checked) < r.checkInterval {
+		return r.config
+	}
+	r.checked = now
+
+	modTime, err := r.modTimes()
+	if err != nil {
+		r.logger.Error("failed to check TLS files, serving the loaded certificate", "error", err)
+		return r.config
+	}
+	if maps.Equal(modTime, r.modTime) {
+		return r.config
+	}
+
+	// The modification times are recorded even if loading fails, so a broken file isn't reloaded on every handshake
+	r.modTime = modTime
+	config, err := r.load()
+	if err != nil {
+		r.logger.Error("failed to reload TLS files, serving the loaded certificate", "error", err)
+		return r.config
+	}
+	r.logger.Info("reloaded TLS files")
+	r.config = config
+	return r.config
+}
+
+// load reads the certificate and client CA from the files
+func (r *Reloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if r.files.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.files.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", r.files.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// modTimes returns when each of the files was last modified
+func (r *Reloader) modTimes() (map[string]time.Time, error) {
+	modTime := map[string]time.Time{}
+	for _, file := range []string{r.files.CertFile, r.files.KeyFile, r.files.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTime[file] = info.ModTime()
+	}
+	return modTime, nil
+}
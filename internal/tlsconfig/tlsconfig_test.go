@@ -0,0 +1,297 @@
+package tlsconfig_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/tlsconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// testCA signs certificates for the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// issue creates a certificate signed by the CA, returning it and its key as PEM
+func (ca *testCA) issue(t *testing.T, serial int64, commonName string, spiffeID string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if spiffeID != "" {
+		uri, err := url.Parse(spiffeID)
+		require.NoError(t, err)
+		template.URIs = []*url.URL{uri}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) clientCert(t *testing.T, commonName string, spiffeID string) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, 100, commonName, spiffeID, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return cert
+}
+
+func writeFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+}
+
+// serve starts a server with the TLS configuration, recording the identity of the clients of its requests
+func serve(t *testing.T, config *tls.Config) (string, <-chan *tlsconfig.Identity) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	identities := make(chan *tlsconfig.Identity, 10)
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(config)),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if identity, ok := tlsconfig.ClientIdentity(ctx); ok {
+				identities <- &identity
+			} else {
+				identities <- nil
+			}
+			return handler(ctx, req)
+		}),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+	return lis.Addr().String(), identities
+}
+
+// check makes a request to the server, returning the serial number of the certificate the server presented
+func check(t *testing.T, address string, config *tls.Config) (*big.Int, error) {
+	t.Helper()
+	var serial *big.Int
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		serial = state.PeerCertificates[0].SerialNumber
+		return nil
+	}
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return serial, err
+}
+
+func Test_ServerTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	files := tlsconfig.Files{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	certPEM, keyPEM := ca.issue(t, 1, "server", "", x509.ExtKeyUsageServerAuth)
+	writeFile(t, files.CertFile, certPEM)
+	writeFile(t, files.KeyFile, keyPEM)
+
+	// The files are checked on every handshake, so changes are picked up straight away
+	reloader, err := tlsconfig.NewReloader(files, slog.New(slog.NewTextHandler(io.Discard, nil)), tlsconfig.WithCheckInterval(0))
+	require.NoError(t, err)
+	address, identities := serve(t, reloader.TLSConfig())
+
+	serial, err := check(t, address, &tls.Config{RootCAs: ca.pool()})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), serial.Int64())
+	// Clients aren't asked for a certificate without a client CA
+	assert.Nil(t, <-identities)
+
+	t.Run("certificate is reloaded when it changes", func(t *testing.T) {
+		certPEM, keyPEM := ca.issue(t, 2, "server", "", x509.ExtKeyUsageServerAuth)
+		writeFile(t, files.CertFile, certPEM)
+		writeFile(t, files.KeyFile, keyPEM)
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(files.CertFile, later, later))
+		require.NoError(t, os.Chtimes(files.KeyFile, later, later))
+
+		serial, err := check(t, address, &tls.Config{RootCAs: ca.pool()})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), serial.Int64())
+		<-identities
+	})
+
+	t.Run("invalid certificate keeps the loaded certificate", func(t *testing.T) {
+		writeFile(t, files.CertFile, []byte("not a certificate"))
+		later := time.Now().Add(2 * time.Minute)
+		require.NoError(t, os.Chtimes(files.CertFile, later, later))
+
+		serial, err := check(t, address, &tls.Config{RootCAs: ca.pool()})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), serial.Int64())
+		<-identities
+	})
+}
+
+func Test_ReloaderCheckInterval(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	files := tlsconfig.Files{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	certPEM, keyPEM := ca.issue(t, 1, "server", "", x509.ExtKeyUsageServerAuth)
+	writeFile(t, files.CertFile, certPEM)
+	writeFile(t, files.KeyFile, keyPEM)
+
+	reloader, err := tlsconfig.NewReloader(files, slog.New(slog.NewTextHandler(io.Discard, nil)), tlsconfig.WithCheckInterval(time.Hour))
+	require.NoError(t, err)
+	address, identities := serve(t, reloader.TLSConfig())
+
+	certPEM, keyPEM = ca.issue(t, 2, "server", "", x509.ExtKeyUsageServerAuth)
+	writeFile(t, files.CertFile, certPEM)
+	writeFile(t, files.KeyFile, keyPEM)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(files.CertFile, later, later))
+	require.NoError(t, os.Chtimes(files.KeyFile, later, later))
+
+	// The files were checked when they were loaded, so they aren't checked again within the interval
+	serial, err := check(t, address, &tls.Config{RootCAs: ca.pool()})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), serial.Int64())
+	<-identities
+}
+
+func Test_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	dir := t.TempDir()
+	files := tlsconfig.Files{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	certPEM, keyPEM := ca.issue(t, 1, "server", "", x509.ExtKeyUsageServerAuth)
+	writeFile(t, files.CertFile, certPEM)
+	writeFile(t, files.KeyFile, keyPEM)
+	writeFile(t, files.ClientCAFile, ca.pem)
+
+	reloader, err := tlsconfig.NewReloader(files, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	address, identities := serve(t, reloader.TLSConfig())
+
+	testCases := []struct {
+		description      string
+		certificates     []tls.Certificate
+		expectedIdentity *tlsconfig.Identity
+		expectedName     string
+	}{
+		{
+			description:      "SPIFFE ID",
+			certificates:     []tls.Certificate{ca.clientCert(t, "matcher", "spiffe://example.org/matcher")},
+			expectedIdentity: &tlsconfig.Identity{SPIFFEID: "spiffe://example.org/matcher", CommonName: "matcher"},
+			expectedName:     "spiffe://example.org/matcher",
+		},
+		{
+			description:      "common name",
+			certificates:     []tls.Certificate{ca.clientCert(t, "matcher", "")},
+			expectedIdentity: &tlsconfig.Identity{CommonName: "matcher"},
+			expectedName:     "matcher",
+		},
+		{
+			description: "no certificate",
+		},
+		{
+			description:  "certificate from another CA",
+			certificates: []tls.Certificate{otherCA.clientCert(t, "matcher", "")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := check(t, address, &tls.Config{RootCAs: ca.pool(), Certificates: tc.certificates})
+
+			if tc.expectedIdentity == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			identity := <-identities
+			assert.Equal(t, tc.expectedIdentity, identity)
+			assert.Equal(t, tc.expectedName, identity.Name())
+		})
+	}
+}
+
+func Test_NewReloader(t *testing.T) {
+	dir := t.TempDir()
+	_, err := tlsconfig.NewReloader(tlsconfig.Files{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}, slog.Default())
+	assert.Error(t, err)
+}
@@ -0,0 +1,294 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/api"
+	"github.com/neiln3121/explore-service/internal/outbox"
+	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/webhook"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/neiln3121/explore-service/internal/tracing"
+
+	// redacted replaces user IDs in spans when they are redacted
+	redacted = "redacted"
+)
+
+// idempotencyPurger is a store which keeps idempotency keys until they are purged
+type idempotencyPurger interface {
+	PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit uint32) (int, error)
+}
+
+// Store records a span for every call to the store it wraps. Calls the wrapped store doesn't have a method for, such as
+// relaying an outbox, fail with errors.ErrUnsupported.
+type Store struct {
+	next   api.Store
+	tracer trace.Tracer
+	redact bool
+}
+
+// Option configures optional behaviour of the Store
+type Option func(*Store)
+
+// WithRedactedUserIDs leaves user IDs out of span attributes
+func WithRedactedUserIDs() Option {
+	return func(s *Store) {
+		s.redact = true
+	}
+}
+
+// WithTracerProvider sets the provider spans are recorded with, instead of the global tracer provider
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(s *Store) {
+		s.tracer = provider.Tracer(instrumentationName)
+	}
+}
+
+// InstrumentStore wraps the store so every call to it is recorded as a span
+func InstrumentStore(store api.Store, opts ...Option) *Store {
+	s := &Store{
+		next:   store,
+		tracer: otel.Tracer(instrumentationName),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Store) RecordDecision(ctx context.Context, recipientID, actorID string, liked bool) (*storage.DecisionResult, error) {
+	ctx, span := s.start(ctx, "RecordDecision", s.userID("recipient_id", recipientID), s.userID("actor_id", actorID), attribute.Bool("explore.liked", liked))
+	res, err := s.next.RecordDecision(ctx, recipientID, actorID, liked)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) RecordIdempotentDecision(ctx context.Context, key string, ttl time.Duration, recipientID, actorID string, liked bool) (*storage.DecisionResult, error) {
+	ctx, span := s.start(ctx, "RecordIdempotentDecision", s.userID("recipient_id", recipientID), s.userID("actor_id", actorID), attribute.Bool("explore.liked", liked))
+	res, err := s.next.RecordIdempotentDecision(ctx, key, ttl, recipientID, actorID, liked)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) GetLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error) {
+	ctx, span := s.start(ctx, "GetLikedDecisions", s.userID("recipient_id", recipientID), attribute.Bool("explore.liked", liked), attribute.String("explore.sort", sort.String()))
+	res, err := s.next.GetLikedDecisions(ctx, recipientID, liked, sort, cursor, limit)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) GetNewLikedDecisions(ctx context.Context, recipientID string, liked bool, sort storage.Sort, cursor *storage.Cursor, limit *uint32) ([]*storage.Liker, error) {
+	ctx, span := s.start(ctx, "GetNewLikedDecisions", s.userID("recipient_id", recipientID), attribute.Bool("explore.liked", liked), attribute.String("explore.sort", sort.String()))
+	res, err := s.next.GetNewLikedDecisions(ctx, recipientID, liked, sort, cursor, limit)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) GetLikedDecisionsCount(ctx context.Context, recipientID string, liked bool) (int, error) {
+	ctx, span := s.start(ctx, "GetLikedDecisionsCount", s.userID("recipient_id", recipientID), attribute.Bool("explore.liked", liked))
+	res, err := s.next.GetLikedDecisionsCount(ctx, recipientID, liked)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) GetMatches(ctx context.Context, userID string, token *uint64, limit *uint32) ([]*storage.Match, error) {
+	ctx, span := s.start(ctx, "GetMatches", s.userID("user_id", userID))
+	res, err := s.next.GetMatches(ctx, userID, token, limit)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) UndoDecision(ctx context.Context, recipientID, actorID string, window time.Duration) (*storage.UndoResult, error) {
+	ctx, span := s.start(ctx, "UndoDecision", s.userID("recipient_id", recipientID), s.userID("actor_id", actorID))
+	res, err := s.next.UndoDecision(ctx, recipientID, actorID, window)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) Unmatch(ctx context.Context, userID, matchedUserID string) error {
+	ctx, span := s.start(ctx, "Unmatch", s.userID("user_id", userID), s.userID("matched_user_id", matchedUserID))
+	err := s.next.Unmatch(ctx, userID, matchedUserID)
+	end(span, err)
+	return err
+}
+
+func (s *Store) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	ctx, span := s.start(ctx, "BlockUser", s.userID("blocker_id", blockerID), s.userID("blocked_id", blockedID))
+	err := s.next.BlockUser(ctx, blockerID, blockedID)
+	end(span, err)
+	return err
+}
+
+func (s *Store) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	ctx, span := s.start(ctx, "UnblockUser", s.userID("blocker_id", blockerID), s.userID("blocked_id", blockedID))
+	err := s.next.UnblockUser(ctx, blockerID, blockedID)
+	end(span, err)
+	return err
+}
+
+func (s *Store) GetDecisionHistory(ctx context.Context, actorID string, recipientID *string, token *uint64, limit *uint32) ([]*storage.DecisionEvent, error) {
+	attrs := []attribute.KeyValue{s.userID("actor_id", actorID)}
+	if recipientID != nil {
+		attrs = append(attrs, s.userID("recipient_id", *recipientID))
+	}
+	ctx, span := s.start(ctx, "GetDecisionHistory", attrs...)
+	res, err := s.next.GetDecisionHistory(ctx, actorID, recipientID, token, limit)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) GetLikeEvents(ctx context.Context, userID string, after uint64, limit uint32) ([]*storage.LikeEvent, error) {
+	ctx, span := s.start(ctx, "GetLikeEvents", s.userID("user_id", userID))
+	res, err := s.next.GetLikeEvents(ctx, userID, after, limit)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) GetLastLikeEventID(ctx context.Context, userID string) (uint64, error) {
+	ctx, span := s.start(ctx, "GetLastLikeEventID", s.userID("user_id", userID))
+	res, err := s.next.GetLastLikeEventID(ctx, userID)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) RelayOutbox(ctx context.Context, limit uint32, publish func(context.Context, *storage.OutboxEvent) error) (int, error) {
+	next, ok := s.next.(outbox.Store)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	ctx, span := s.start(ctx, "RelayOutbox")
+	res, err := next.RelayOutbox(ctx, limit, publish)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit uint32) (int, error) {
+	next, ok := s.next.(idempotencyPurger)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	ctx, span := s.start(ctx, "PurgeIdempotencyKeys")
+	res, err := next.PurgeIdempotencyKeys(ctx, ttl, limit)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) AddWebhookDeliveries(ctx context.Context, subscriptions []string, event *storage.OutboxEvent) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	ctx, span := s.start(ctx, "AddWebhookDeliveries", attribute.StringSlice("explore.subscriptions", subscriptions))
+	err := next.AddWebhookDeliveries(ctx, subscriptions, event)
+	end(span, err)
+	return err
+}
+
+func (s *Store) ClaimWebhookDelivery(ctx context.Context, subscription string, lease time.Duration) (*storage.WebhookDelivery, error) {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	ctx, span := s.start(ctx, "ClaimWebhookDelivery", attribute.String("explore.subscription", subscription))
+	res, err := next.ClaimWebhookDelivery(ctx, subscription, lease)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) DeleteWebhookDelivery(ctx context.Context, id uint64) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	ctx, span := s.start(ctx, "DeleteWebhookDelivery", attribute.Int64("explore.delivery_id", int64(id)))
+	err := next.DeleteWebhookDelivery(ctx, id)
+	end(span, err)
+	return err
+}
+
+func (s *Store) RetryWebhookDelivery(ctx context.Context, id uint64, lastError string, backoff time.Duration) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	ctx, span := s.start(ctx, "RetryWebhookDelivery", attribute.Int64("explore.delivery_id", int64(id)))
+	err := next.RetryWebhookDelivery(ctx, id, lastError, backoff)
+	end(span, err)
+	return err
+}
+
+func (s *Store) DeadLetterWebhookDelivery(ctx context.Context, id uint64, lastError string) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	ctx, span := s.start(ctx, "DeadLetterWebhookDelivery", attribute.Int64("explore.delivery_id", int64(id)))
+	err := next.DeadLetterWebhookDelivery(ctx, id, lastError)
+	end(span, err)
+	return err
+}
+
+func (s *Store) GetDeadLetters(ctx context.Context, subscription *string, after uint64, limit uint32) ([]*storage.DeadLetter, error) {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	var attrs []attribute.KeyValue
+	if subscription != nil {
+		attrs = append(attrs, attribute.String("explore.subscription", *subscription))
+	}
+	ctx, span := s.start(ctx, "GetDeadLetters", attrs...)
+	res, err := next.GetDeadLetters(ctx, subscription, after, limit)
+	end(span, err)
+	return res, err
+}
+
+func (s *Store) DeleteDeadLetter(ctx context.Context, id uint64) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	ctx, span := s.start(ctx, "DeleteDeadLetter", attribute.Int64("explore.dead_letter_id", int64(id)))
+	err := next.DeleteDeadLetter(ctx, id)
+	end(span, err)
+	return err
+}
+
+func (s *Store) RecordDeadLetterAttempt(ctx context.Context, id uint64, lastError string) error {
+	next, ok := s.next.(webhook.Store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	ctx, span := s.start(ctx, "RecordDeadLetterAttempt", attribute.Int64("explore.dead_letter_id", int64(id)))
+	err := next.RecordDeadLetterAttempt(ctx, id, lastError)
+	end(span, err)
+	return err
+}
+
+func (s *Store) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "storage."+method, trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attrs...))
+}
+
+// userID is the attribute for a user ID, unless user IDs are redacted
+func (s *Store) userID(key, id string) attribute.KeyValue {
+	if s.redact {
+		id = redacted
+	}
+	return attribute.String("explore."+key, id)
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
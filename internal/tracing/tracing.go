@@ -0,0 +1,151 @@
+// Package tracing sets up OpenTelemetry tracing for the server, and records spans for the storage behind it
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Exporters spans can be sent to
+const (
+	// ExporterNone records no spans
+	ExporterNone = "none"
+	// ExporterOTLP sends spans to an OTLP collector over gRPC, configured with the OTEL_EXPORTER_OTLP_* environment variables
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON to stdout, or to a file if one is set
+	ExporterStdout = "stdout"
+)
+
+// Config configures where spans are exported
+type Config struct {
+	ServiceName string
+	Exporter    string
+	// File is where the stdout exporter writes spans instead of stdout
+	File string
+}
+
+// Setup creates a tracer provider exporting spans as configured, and sets it as the global tracer provider along with
+// the W3C trace context propagator. The returned function flushes any spans not yet exported and stops the provider.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		otlp, err := otlptracegrpc.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = otlp
+	case ExporterStdout:
+		var writer io.Writer = os.Stdout
+		if cfg.File != "" {
+			file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open trace file: %w", err)
+			}
+			writer = file
+			closer = file
+		}
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(writer))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		exporter = stdout
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// ServerOption records a span for every request to the gRPC server, continuing any trace propagated by the client
+func ServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler())
+}
+
+// UnaryServerInterceptor records a span for every request through it, continuing any trace propagated in the request
+// metadata. It is for requests which aren't served by the gRPC server, such as those from the HTTP gateway, as the
+// ServerOption only sees requests which are.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	tracer := otel.Tracer(instrumentationName)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+		// Spans are named and described the same way as those recorded by the ServerOption
+		name := strings.TrimPrefix(info.FullMethod, "/")
+		attrs := []attribute.KeyValue{semconv.RPCSystemGRPC}
+		if service, method, ok := strings.Cut(name, "/"); ok {
+			attrs = append(attrs, semconv.RPCService(service), semconv.RPCMethod(method))
+		}
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		res, err := handler(ctx, req)
+		code := status.Code(err)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return res, err
+	}
+}
+
+// metadataCarrier reads and writes propagated trace context in gRPC metadata
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	values := metadata.MD(m).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
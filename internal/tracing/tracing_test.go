@@ -0,0 +1,250 @@
+package tracing_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	contract "github.com/neiln3121/explore-service/explore"
+	"github.com/neiln3121/explore-service/internal/api"
+	"github.com/neiln3121/explore-service/internal/api/mocks"
+	"github.com/neiln3121/explore-service/internal/gateway"
+	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/storage/memory"
+	"github.com/neiln3121/explore-service/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func Test_InstrumentStore(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		description        string
+		opts               []tracing.Option
+		mockError          error
+		expectedAttributes []attribute.KeyValue
+		expectedStatus     codes.Code
+	}{
+		{
+			description: "user IDs",
+			expectedAttributes: []attribute.KeyValue{
+				attribute.String("explore.user_id", "1"),
+				attribute.String("explore.matched_user_id", "2"),
+			},
+			expectedStatus: codes.Unset,
+		},
+		{
+			description: "redacted user IDs",
+			opts:        []tracing.Option{tracing.WithRedactedUserIDs()},
+			expectedAttributes: []attribute.KeyValue{
+				attribute.String("explore.user_id", "redacted"),
+				attribute.String("explore.matched_user_id", "redacted"),
+			},
+			expectedStatus: codes.Unset,
+		},
+		{
+			description: "error",
+			mockError:   errors.New("db error"),
+			expectedAttributes: []attribute.KeyValue{
+				attribute.String("explore.user_id", "1"),
+				attribute.String("explore.matched_user_id", "2"),
+			},
+			expectedStatus: codes.Error,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			store := mocks.NewStore(t)
+			store.EXPECT().Unmatch(mock.Anything, "1", "2").Return(tc.mockError).Once()
+
+			traced := tracing.InstrumentStore(store, append(tc.opts, tracing.WithTracerProvider(provider))...)
+			err := traced.Unmatch(ctx, "1", "2")
+			assert.Equal(t, tc.mockError, err)
+
+			spans := recorder.Ended()
+			require.Len(t, spans, 1)
+			assert.Equal(t, "storage.Unmatch", spans[0].Name())
+			assert.Equal(t, tc.expectedAttributes, spans[0].Attributes())
+			assert.Equal(t, tc.expectedStatus, spans[0].Status().Code)
+		})
+	}
+}
+
+func Test_InstrumentStoreOutbox(t *testing.T) {
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	publish := func(context.Context, *storage.OutboxEvent) error { return nil }
+
+	store := memory.New()
+	_, err := store.RecordDecision(ctx, "1", "2", true)
+	require.NoError(t, err)
+	relayed, err := tracing.InstrumentStore(store, tracing.WithTracerProvider(provider)).RelayOutbox(ctx, 10, publish)
+	require.NoError(t, err)
+	assert.Equal(t, 1, relayed)
+
+	// A store without an outbox has nothing to relay
+	_, err = tracing.InstrumentStore(mocks.NewStore(t), tracing.WithTracerProvider(provider)).RelayOutbox(ctx, 10, publish)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "storage.RelayOutbox", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
+
+func Test_InstrumentStoreWebhooks(t *testing.T) {
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	traced := tracing.InstrumentStore(memory.New(), tracing.WithTracerProvider(provider))
+	err := traced.AddWebhookDeliveries(ctx, []string{"partner"}, &storage.OutboxEvent{ID: 1, Type: storage.OutboxMatchCreated})
+	require.NoError(t, err)
+	delivery, err := traced.ClaimWebhookDelivery(ctx, "partner", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, delivery)
+
+	// A store without webhook deliveries can't queue them
+	_, err = tracing.InstrumentStore(mocks.NewStore(t), tracing.WithTracerProvider(provider)).ClaimWebhookDelivery(ctx, "partner", time.Minute)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "storage.AddWebhookDeliveries", spans[0].Name())
+	assert.Equal(t, []attribute.KeyValue{attribute.StringSlice("explore.subscriptions", []string{"partner"})}, spans[0].Attributes())
+	assert.Equal(t, "storage.ClaimWebhookDelivery", spans[1].Name())
+	assert.Equal(t, []attribute.KeyValue{attribute.String("explore.subscription", "partner")}, spans[1].Attributes())
+}
+
+func Test_InstrumentStorePurge(t *testing.T) {
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	_, err := tracing.InstrumentStore(memory.New(), tracing.WithTracerProvider(provider)).PurgeIdempotencyKeys(ctx, time.Hour, 10)
+	require.NoError(t, err)
+
+	// A store without idempotency keys has nothing to purge
+	_, err = tracing.InstrumentStore(mocks.NewStore(t), tracing.WithTracerProvider(provider)).PurgeIdempotencyKeys(ctx, time.Hour, 10)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "storage.PurgeIdempotencyKeys", spans[0].Name())
+}
+
+func Test_ServerSpans(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "spans.json")
+
+	shutdown, err := tracing.Setup(ctx, tracing.Config{
+		ServiceName: "explore-service-test",
+		Exporter:    tracing.ExporterStdout,
+		File:        file,
+	})
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(tracing.ServerOption())
+	contract.RegisterExploreAPIServer(server, api.New(tracing.InstrumentStore(memory.New())))
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The client's trace is continued by the server
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	outgoing := metadata.AppendToOutgoingContext(ctx, "traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	_, err = contract.NewExploreAPIClient(conn).CountLikedYou(outgoing, &contract.CountLikedYouRequest{RecipientUserId: "1"})
+	require.NoError(t, err)
+
+	require.NoError(t, shutdown(ctx))
+
+	assert.Equal(t, map[string]string{
+		"explore.ExploreAPI/CountLikedYou": traceID,
+		"storage.GetLikedDecisionsCount":   traceID,
+	}, readSpans(t, file))
+}
+
+func Test_GatewaySpans(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "spans.json")
+
+	shutdown, err := tracing.Setup(ctx, tracing.Config{
+		ServiceName: "explore-service-test",
+		Exporter:    tracing.ExporterStdout,
+		File:        file,
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(gateway.New(api.New(tracing.InstrumentStore(memory.New())), tracing.UnaryServerInterceptor()))
+	defer server.Close()
+
+	// The client's trace is continued by the gateway
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/users/1/liked-you/count", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	res, err := server.Client().Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	require.NoError(t, shutdown(ctx))
+
+	assert.Equal(t, map[string]string{
+		"explore.ExploreAPI/CountLikedYou": traceID,
+		"storage.GetLikedDecisionsCount":   traceID,
+	}, readSpans(t, file))
+}
+
+// readSpans reads the trace IDs of the spans written by the stdout exporter, by span name
+func readSpans(t *testing.T, file string) map[string]string {
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+
+	spans := map[string]string{}
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	for decoder.More() {
+		var span struct {
+			Name        string
+			SpanContext struct {
+				TraceID string
+			}
+		}
+		require.NoError(t, decoder.Decode(&span))
+		spans[span.Name] = span.SpanContext.TraceID
+	}
+	return spans
+}
@@ -0,0 +1,326 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/outbox"
+	"github.com/neiln3121/explore-service/internal/storage"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a delivery is attempted before it is dead lettered, unless set with
+	// WithRetries
+	DefaultMaxAttempts = 5
+	// DefaultInitialBackoff is the wait before the first retry, doubling for each retry after it
+	DefaultInitialBackoff = time.Second
+	// DefaultMaxBackoff is the longest wait between retries
+	DefaultMaxBackoff = 30 * time.Second
+	// DefaultTimeout is how long a receiver is given to respond, unless set with WithClient
+	DefaultTimeout = 10 * time.Second
+	// DefaultReplayLimit is the number of dead letters replayed when no limit is given
+	DefaultReplayLimit = 100
+	// DefaultInterval is how often the queue is checked for deliveries which are due, unless set with WithInterval
+	DefaultInterval = time.Second
+)
+
+// Store is a store of the deliveries waiting to be made and of dead letters
+type Store interface {
+	AddWebhookDeliveries(ctx context.Context, subscriptions []string, event *storage.OutboxEvent) error
+	ClaimWebhookDelivery(ctx context.Context, subscription string, lease time.Duration) (*storage.WebhookDelivery, error)
+	DeleteWebhookDelivery(ctx context.Context, id uint64) error
+	RetryWebhookDelivery(ctx context.Context, id uint64, lastError string, backoff time.Duration) error
+	DeadLetterWebhookDelivery(ctx context.Context, id uint64, lastError string) error
+	GetDeadLetters(ctx context.Context, subscription *string, after uint64, limit uint32) ([]*storage.DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, id uint64) error
+	RecordDeadLetterAttempt(ctx context.Context, id uint64, lastError string) error
+}
+
+// ErrUnknownSubscription is returned when replaying the dead letters of a subscription which isn't configured
+var ErrUnknownSubscription = errors.New("unknown webhook subscription")
+
+// Dispatcher delivers events to the subscriptions to them. It is an outbox.Publisher which queues the events it is
+// published in the store, and Run delivers them from the queue, so the outbox isn't held up while receivers are
+// retried. The events of a subscription are delivered in the order they were queued: a delivery being retried holds up
+// the events after it for that subscription only.
+type Dispatcher struct {
+	store          Store
+	subscriptions  []Subscription
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	interval       time.Duration
+	logger         *slog.Logger
+}
+
+var _ outbox.Publisher = (*Dispatcher)(nil)
+
+// Option configures optional behaviour of the Dispatcher
+type Option func(*Dispatcher)
+
+// WithClient sets the client deliveries are made with, instead of a client with the default timeout
+func WithClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithRetries sets how many times a delivery is attempted, and the backoff between attempts, which starts at the
+// initial backoff and doubles up to the max backoff
+func WithRetries(maxAttempts int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = maxAttempts
+		d.initialBackoff = initialBackoff
+		d.maxBackoff = maxBackoff
+	}
+}
+
+// WithInterval sets how often the queue is checked for deliveries which are due
+func WithInterval(interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.interval = interval
+	}
+}
+
+// WithLogger sets the logger failures are logged to, instead of the default logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(d *Dispatcher) {
+		d.logger = logger
+	}
+}
+
+func NewDispatcher(store Store, subscriptions []Subscription, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		store:          store,
+		subscriptions:  subscriptions,
+		client:         &http.Client{Timeout: DefaultTimeout},
+		maxAttempts:    DefaultMaxAttempts,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		interval:       DefaultInterval,
+		logger:         slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Publish queues the event to be delivered to every subscription to it. It doesn't wait for the deliveries, so the
+// relay publishing the event isn't held up by receivers which are slow or failing.
+func (d *Dispatcher) Publish(ctx context.Context, event *storage.OutboxEvent) error {
+	var subscriptions []string
+	for _, subscription := range d.subscriptions {
+		if subscription.wants(event.Type) {
+			subscriptions = append(subscriptions, subscription.Name)
+		}
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	err := d.store.AddWebhookDeliveries(ctx, subscriptions, event)
+	if err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// Run delivers the queued events of every subscription until the context is done, checking for deliveries which are
+// due every interval. Each subscription is delivered to on its own, so a failing receiver doesn't hold up the others.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range d.subscriptions {
+		wg.Add(1)
+		go func(subscription *Subscription) {
+			defer wg.Done()
+			for {
+				_, err := d.deliverDue(ctx, subscription)
+				if err != nil && ctx.Err() == nil {
+					d.logger.ErrorContext(ctx, "failed to deliver webhooks", "subscription", subscription.Name, "error", err)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(d.interval):
+				}
+			}
+		}(&d.subscriptions[i])
+	}
+	wg.Wait()
+}
+
+// DeliverOnce makes the deliveries which are due to every subscription, returning the number delivered
+func (d *Dispatcher) DeliverOnce(ctx context.Context) (int, error) {
+	total := 0
+	for i := range d.subscriptions {
+		delivered, err := d.deliverDue(ctx, &d.subscriptions[i])
+		total += delivered
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Replay makes one more attempt at delivering up to limit dead letters, oldest first, optionally only those of one
+// subscription. Dead letters which are delivered are removed, and the others are kept for the next replay. It returns
+// the number delivered and the number which failed again. Replayed events may arrive after later events between the
+// same users, which receivers can tell from their IDs.
+func (d *Dispatcher) Replay(ctx context.Context, subscription *string, limit uint32) (delivered, failed int, err error) {
+	if subscription != nil && d.subscription(*subscription) == nil {
+		return 0, 0, ErrUnknownSubscription
+	}
+	if limit == 0 {
+		limit = DefaultReplayLimit
+	}
+
+	letters, err := d.store.GetDeadLetters(ctx, subscription, 0, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, letter := range letters {
+		// The subscription may have been removed since the delivery failed
+		deliverErr := ErrUnknownSubscription
+		if s := d.subscription(letter.Subscription); s != nil {
+			deliverErr = d.deliver(ctx, s, &letter.Event)
+		}
+		if deliverErr != nil {
+			if ctx.Err() != nil {
+				return delivered, failed, ctx.Err()
+			}
+			failed++
+			err = d.store.RecordDeadLetterAttempt(ctx, letter.ID, deliverErr.Error())
+		} else {
+			delivered++
+			err = d.store.DeleteDeadLetter(ctx, letter.ID)
+		}
+		if err != nil {
+			return delivered, failed, err
+		}
+	}
+	return delivered, failed, nil
+}
+
+func (d *Dispatcher) subscription(name string) *Subscription {
+	for i := range d.subscriptions {
+		if d.subscriptions[i].Name == name {
+			return &d.subscriptions[i]
+		}
+	}
+	return nil
+}
+
+// deliverDue makes the deliveries queued for the subscription in order, until one fails or none are due, returning
+// the number delivered. A delivery which fails is retried after a backoff, and dead lettered once it is rejected outright
+// or every attempt has failed.
+func (d *Dispatcher) deliverDue(ctx context.Context, subscription *Subscription) (int, error) {
+	delivered := 0
+	for {
+		delivery, err := d.store.ClaimWebhookDelivery(ctx, subscription.Name, d.lease())
+		if err != nil || delivery == nil {
+			return delivered, err
+		}
+
+		deliverErr := d.deliver(ctx, subscription, &delivery.Event)
+		if deliverErr == nil {
+			delivered++
+			err = d.store.DeleteWebhookDelivery(ctx, delivery.ID)
+			if err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			// The delivery is attempted again once its lease runs out
+			return delivered, ctx.Err()
+		}
+
+		attempts := delivery.Attempts + 1
+		var rejected *rejectedError
+		if errors.As(deliverErr, &rejected) || attempts >= d.maxAttempts {
+			d.logger.WarnContext(ctx, "webhook delivery failed every attempt",
+				"subscription", subscription.Name, "event_id", delivery.Event.ID, "attempts", attempts, "error", deliverErr)
+			err = d.store.DeadLetterWebhookDelivery(ctx, delivery.ID, deliverErr.Error())
+			if err != nil {
+				return delivered, fmt.Errorf("failed to keep dead letter for %s: %w", subscription.Name, err)
+			}
+			continue
+		}
+
+		err = d.store.RetryWebhookDelivery(ctx, delivery.ID, deliverErr.Error(), d.backoff(attempts))
+		return delivered, err
+	}
+}
+
+// backoff returns the wait before the next attempt at a delivery which has failed the number of attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.initialBackoff
+	for i := 1; i < attempts && backoff < d.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.maxBackoff)
+}
+
+// lease is how long a delivery is kept from being claimed again while it is being made, long enough for the receiver
+// to respond
+func (d *Dispatcher) lease() time.Duration {
+	if d.client.Timeout == 0 {
+		return 2 * DefaultTimeout
+	}
+	return 2 * d.client.Timeout
+}
+
+// rejectedError is a response to a delivery which won't succeed if it is retried
+type rejectedError struct {
+	status int
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("rejected with status %d", e.status)
+}
+
+// deliver makes one attempt at delivering the event to the subscription
+func (d *Dispatcher) deliver(ctx context.Context, subscription *Subscription, event *storage.OutboxEvent) error {
+	body, err := json.Marshal(outbox.NewMessage(event))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, strconv.FormatUint(event.ID, 10))
+	req.Header.Set(EventTypeHeader, event.Type)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, time.Now(), body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// The body is drained so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode >= 400 && res.StatusCode < 500 &&
+		res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests:
+		return &rejectedError{status: res.StatusCode}
+	}
+	return fmt.Errorf("failed with status %d", res.StatusCode)
+}
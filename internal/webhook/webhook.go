@@ -0,0 +1,150 @@
+// Package webhook delivers match and unmatch events from the outbox to the HTTP endpoints of partners. Every delivery
+// is a POST of the JSON encoded outbox.Message, signed with the secret of the subscription. Events are queued when
+// they are published from the outbox and delivered from the queue, so receivers don't hold up the outbox. Deliveries
+// are retried with exponential backoff, and a delivery which fails every attempt is kept as a dead letter until it is
+// replayed.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// Headers sent with every delivery
+const (
+	// SignatureHeader is the signature of the delivery, as t=<unix timestamp>,v1=<hex HMAC-SHA256>. The HMAC is of the
+	// timestamp, a dot and the body, keyed with the secret of the subscription.
+	SignatureHeader = "X-Explore-Signature"
+	// EventIDHeader is the ID of the event, the same every time the event is delivered, for receivers to ignore repeats
+	EventIDHeader = "X-Explore-Event-Id"
+	// EventTypeHeader is the type of the event
+	EventTypeHeader = "X-Explore-Event"
+)
+
+// Events are the types of event which can be subscribed to
+var Events = []string{storage.OutboxMatchCreated, storage.OutboxUnmatched}
+
+// Subscription is an endpoint events are delivered to
+type Subscription struct {
+	// Name identifies the subscription, in dead letters and when replaying them
+	Name   string `yaml:"name"`
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+	// Events are the types of event delivered, every type if empty
+	Events []string `yaml:"events"`
+}
+
+// wants returns whether events of the type are delivered to the subscription
+func (s *Subscription) wants(eventType string) bool {
+	if !slices.Contains(Events, eventType) {
+		return false
+	}
+	return len(s.Events) == 0 || slices.Contains(s.Events, eventType)
+}
+
+// ValidateSubscriptions checks every subscription has a unique name, an HTTP URL, a secret and known events
+func ValidateSubscriptions(subscriptions []Subscription) error {
+	names := map[string]bool{}
+	for index, subscription := range subscriptions {
+		if subscription.Name == "" {
+			return fmt.Errorf("subscription %d: empty name", index)
+		}
+		if names[subscription.Name] {
+			return fmt.Errorf("subscription %s: duplicate name", subscription.Name)
+		}
+		names[subscription.Name] = true
+
+		u, err := url.Parse(subscription.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("subscription %s: url must be an http or https URL", subscription.Name)
+		}
+		if subscription.Secret == "" {
+			return fmt.Errorf("subscription %s: empty secret", subscription.Name)
+		}
+		for _, event := range subscription.Events {
+			if !slices.Contains(Events, event) {
+				return fmt.Errorf("subscription %s: unknown event %q, must be one of %s", subscription.Name, event, strings.Join(Events, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// LoadSubscriptions reads the subscriptions in a YAML file, which is a list of subscriptions
+func LoadSubscriptions(file string) ([]Subscription, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook subscriptions: %w", err)
+	}
+	var subscriptions []Subscription
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&subscriptions); err != nil {
+		return nil, fmt.Errorf("invalid webhook subscriptions file %s: %w", file, err)
+	}
+	if err := ValidateSubscriptions(subscriptions); err != nil {
+		return nil, fmt.Errorf("invalid webhook subscriptions file %s: %w", file, err)
+	}
+	return subscriptions, nil
+}
+
+// Sign returns the signature header of a body sent at the time
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+// Verify checks the signature header was made for the body with the secret, no more than tolerance before now, so
+// receivers can reject forged and replayed deliveries
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature, err := hex.DecodeString(value)
+			if err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing signature timestamp")
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return errors.New("signature timestamp is outside the tolerance")
+	}
+
+	expected := mac(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return errors.New("invalid signature")
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,381 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neiln3121/explore-service/internal/outbox"
+	"github.com/neiln3121/explore-service/internal/storage"
+	"github.com/neiln3121/explore-service/internal/storage/memory"
+	"github.com/neiln3121/explore-service/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "test-secret"
+
+// receiver is a webhook endpoint which responds with the statuses it is given in turn, and then with 200
+type receiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	received []outbox.Message
+	attempts int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	require.NoError(r.t, err)
+	assert.NoError(r.t, webhook.Verify(secret, req.Header.Get(webhook.SignatureHeader), body, time.Now(), time.Minute))
+
+	var message outbox.Message
+	require.NoError(r.t, json.Unmarshal(body, &message))
+	assert.Equal(r.t, message.Type, req.Header.Get(webhook.EventTypeHeader))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+	r.received = append(r.received, message)
+}
+
+func (r *receiver) respond(statuses ...int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = statuses
+	r.attempts = 0
+}
+
+func Test_Dispatcher(t *testing.T) {
+	ctx := context.Background()
+	rec := &receiver{t: t}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	store := memory.New()
+	dispatcher := webhook.NewDispatcher(store,
+		[]webhook.Subscription{{Name: "partner", URL: server.URL, Secret: secret}},
+		webhook.WithRetries(3, time.Millisecond, 2*time.Millisecond),
+		webhook.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	match := &storage.OutboxEvent{ID: 1, Type: storage.OutboxMatchCreated, RecipientID: "1", ActorID: "2", CreatedAt: 1700000000}
+
+	testCases := []struct {
+		description         string
+		event               *storage.OutboxEvent
+		statuses            []int
+		expectedAttempts    int
+		expectedDeadLetters int
+	}{
+		{
+			description:      "delivered",
+			event:            match,
+			expectedAttempts: 1,
+		},
+		{
+			description: "likes aren't delivered",
+			event:       &storage.OutboxEvent{ID: 2, Type: storage.OutboxLikeCreated, RecipientID: "1", ActorID: "2"},
+		},
+		{
+			description:      "retried until delivered",
+			event:            match,
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusTooManyRequests},
+			expectedAttempts: 3,
+		},
+		{
+			description:         "dead lettered after every attempt fails",
+			event:               match,
+			statuses:            []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			expectedAttempts:    3,
+			expectedDeadLetters: 1,
+		},
+		{
+			description:         "rejected deliveries aren't retried",
+			event:               match,
+			statuses:            []int{http.StatusBadRequest},
+			expectedAttempts:    1,
+			expectedDeadLetters: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			rec.respond(tc.statuses...)
+			before, err := store.GetDeadLetters(ctx, nil, 0, 100)
+			require.NoError(t, err)
+
+			err = dispatcher.Publish(ctx, tc.event)
+			require.NoError(t, err)
+			// Publishing only queues the event, which is delivered once the backoff between attempts has passed
+			assert.Zero(t, rec.attempts)
+			for range 20 {
+				_, err = dispatcher.DeliverOnce(ctx)
+				require.NoError(t, err)
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			assert.Equal(t, tc.expectedAttempts, rec.attempts)
+			letters, err := store.GetDeadLetters(ctx, nil, 0, 100)
+			require.NoError(t, err)
+			assert.Len(t, letters, len(before)+tc.expectedDeadLetters)
+		})
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		rec.respond(http.StatusInternalServerError)
+		rec.received = nil
+
+		delivered, failed, err := dispatcher.Replay(ctx, nil, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, 1, failed)
+
+		// The delivery which failed again is kept with the replay counted as an attempt
+		letters, err := store.GetDeadLetters(ctx, nil, 0, 100)
+		require.NoError(t, err)
+		require.Len(t, letters, 1)
+		assert.Equal(t, 4, letters[0].Attempts)
+		assert.Equal(t, "failed with status 500", letters[0].LastError)
+
+		delivered, failed, err = dispatcher.Replay(ctx, nil, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Zero(t, failed)
+		// Replayed events keep their ID
+		require.Len(t, rec.received, 2)
+		assert.Equal(t, uint64(1), rec.received[1].ID)
+
+		letters, err = store.GetDeadLetters(ctx, nil, 0, 100)
+		require.NoError(t, err)
+		assert.Empty(t, letters)
+
+		unknown := "unknown"
+		_, _, err = dispatcher.Replay(ctx, &unknown, 0)
+		assert.ErrorIs(t, err, webhook.ErrUnknownSubscription)
+	})
+}
+
+func Test_DispatcherDoesntHoldRelay(t *testing.T) {
+	ctx := context.Background()
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	store := memory.New()
+	dispatcher := webhook.NewDispatcher(store,
+		[]webhook.Subscription{{Name: "partner", URL: server.URL, Secret: secret}},
+		webhook.WithRetries(3, time.Hour, time.Hour),
+		webhook.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	relay := outbox.NewRelay(store, dispatcher)
+
+	for _, users := range [][2]string{{"1", "2"}, {"2", "1"}} {
+		_, err := store.RecordDecision(ctx, users[0], users[1], true)
+		require.NoError(t, err)
+	}
+	published, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, published)
+
+	// The match fails to be delivered and waits an hour to be retried, without the relay waiting for it
+	delivered, err := dispatcher.DeliverOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+	assert.Equal(t, int32(1), attempts.Load())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := store.Unmatch(ctx, "1", "2")
+		assert.NoError(t, err)
+		published, err := relay.RelayOnce(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, published)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the relay was held up by the delivery backing off")
+	}
+
+	// The unmatch waits for the match to be delivered
+	delivered, err = dispatcher.DeliverOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+	assert.Equal(t, int32(1), attempts.Load())
+	letters, err := store.GetDeadLetters(ctx, nil, 0, 100)
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func Test_DispatcherShutdown(t *testing.T) {
+	// The receiver doesn't respond until the client goes away
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	store := memory.New()
+	dispatcher := webhook.NewDispatcher(store,
+		[]webhook.Subscription{{Name: "partner", URL: server.URL, Secret: secret}},
+		webhook.WithRetries(1, time.Hour, time.Hour),
+	)
+	err := dispatcher.Publish(context.Background(), &storage.OutboxEvent{ID: 1, Type: storage.OutboxUnmatched, RecipientID: "1", ActorID: "2"})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// A delivery interrupted by shutdown is left queued rather than dead lettered
+	_, err = dispatcher.DeliverOnce(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	letters, err := store.GetDeadLetters(context.Background(), nil, 0, 100)
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func Test_Verify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id": 1}`)
+	signature := webhook.Sign(secret, now, body)
+
+	testCases := []struct {
+		description string
+		secret      string
+		header      string
+		body        []byte
+		expectedErr string
+	}{
+		{
+			description: "valid",
+			secret:      secret,
+			header:      signature,
+			body:        body,
+		},
+		{
+			description: "changed body",
+			secret:      secret,
+			header:      signature,
+			body:        []byte(`{"id": 2}`),
+			expectedErr: "invalid signature",
+		},
+		{
+			description: "other secret",
+			secret:      "other-secret",
+			header:      signature,
+			body:        body,
+			expectedErr: "invalid signature",
+		},
+		{
+			description: "old signature",
+			secret:      secret,
+			header:      webhook.Sign(secret, now.Add(-time.Hour), body),
+			body:        body,
+			expectedErr: "signature timestamp is outside the tolerance",
+		},
+		{
+			description: "missing timestamp",
+			secret:      secret,
+			header:      "v1=00",
+			body:        body,
+			expectedErr: "missing signature timestamp",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := webhook.Verify(tc.secret, tc.header, tc.body, now, 5*time.Minute)
+
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func Test_LoadSubscriptions(t *testing.T) {
+	testCases := []struct {
+		description string
+		content     string
+		expectedErr string
+	}{
+		{
+			description: "valid",
+			content: `
+- name: partner
+  url: https://partner.example.com/hooks
+  secret: s3cret
+  events: [match_created]
+`,
+		},
+		{
+			description: "unknown event",
+			content: `
+- name: partner
+  url: https://partner.example.com/hooks
+  secret: s3cret
+  events: [like_created]
+`,
+			expectedErr: `subscription partner: unknown event "like_created", must be one of match_created, unmatched`,
+		},
+		{
+			description: "duplicate name",
+			content: `
+- {name: partner, url: "https://a.example.com", secret: a}
+- {name: partner, url: "https://b.example.com", secret: b}
+`,
+			expectedErr: "subscription partner: duplicate name",
+		},
+		{
+			description: "invalid url",
+			content:     `[{name: partner, url: "partner.example.com", secret: a}]`,
+			expectedErr: "subscription partner: url must be an http or https URL",
+		},
+		{
+			description: "missing secret",
+			content:     `[{name: partner, url: "https://partner.example.com"}]`,
+			expectedErr: "subscription partner: empty secret",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "webhooks.yaml")
+			require.NoError(t, os.WriteFile(file, []byte(tc.content), 0o600))
+
+			subscriptions, err := webhook.LoadSubscriptions(file)
+
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, []webhook.Subscription{{
+					Name:   "partner",
+					URL:    "https://partner.example.com/hooks",
+					Secret: "s3cret",
+					Events: []string{storage.OutboxMatchCreated},
+				}}, subscriptions)
+				return
+			}
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
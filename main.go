@@ -1,60 +1,96 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
+	"time"
 
-	_ "github.com/lib/pq"
-	"github.com/neiln3121/explore-service/database/migrations"
-	contract "github.com/neiln3121/explore-service/explore"
-	"github.com/neiln3121/explore-service/internal/api"
-	"github.com/neiln3121/explore-service/internal/storage"
-	migrate "github.com/rubenv/sql-migrate"
+	"github.com/neiln3121/explore-service/internal/config"
+	"github.com/neiln3121/explore-service/internal/health"
+	"github.com/neiln3121/explore-service/internal/logging"
+	"github.com/neiln3121/explore-service/internal/server"
 
-	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var (
-	port = flag.Int("port", 3000, "the port for the server")
+	printConfig = flag.Bool("print-config", false, "print the configuration with secrets redacted and exit")
+	healthCheck = flag.Bool("health-check", false, "check the health of the server running on the listen address and exit, with status 0 if it is serving")
 )
 
 func main() {
-	flag.Parse()
-
-	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], os.Getenv)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	defer db.Close()
 
-	// run migrations + seeds
-	mg := migrations.GetMigrationSource()
-	migrate.SetTable("migrations")
+	if *healthCheck {
+		os.Exit(checkHealth(cfg))
+	}
 
-	_, err = migrate.Exec(db, "postgres", mg, migrate.Up)
+	err = cfg.Validate()
+	if *printConfig {
+		fmt.Print(cfg.Redacted())
+	}
 	if err != nil {
-		log.Fatal(fmt.Errorf("migrations failed: %w", err))
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		os.Exit(0)
 	}
 
-	repo := storage.New(db)
+	logger := logging.NewLogger(os.Stdout, cfg.LogLevel())
+	slog.SetDefault(logger)
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	err = server.New(*cfg, server.WithLogger(logger)).Run(context.Background())
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		logger.Error("server failed", "error", err)
+		os.Exit(1)
 	}
-	defer lis.Close()
-
-	s := grpc.NewServer()
+}
 
-	api := api.New(repo)
-	contract.RegisterExploreAPIServer(s, api)
+// checkHealth returns the exit status of a health check of the server running on the listen address
+func checkHealth(cfg *config.Config) int {
+	host, port, err := net.SplitHostPort(cfg.Server.ListenAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	var tlsConfig *tls.Config
+	if cfg.TLS.CertFile != "" {
+		// The server is checked from the same host, so its certificate isn't verified
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+		// A server requiring client certificates needs one for the check too
+		if cfg.TLS.HealthCheckCertFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.TLS.HealthCheckCertFile, cfg.TLS.HealthCheckKeyFile)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
 
-	log.Printf("server listening at %v", lis.Addr())
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status, err := health.Check(ctx, net.JoinHostPort(host, port), tlsConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(status)
+	if status != healthpb.HealthCheckResponse_SERVING {
+		return 1
 	}
+	return 0
 }